@@ -56,7 +56,7 @@ async function updateConnectionStatus() {
     const statusIndicator = document.getElementById('statusIndicator');
     const statusText = document.getElementById('statusText');
     try {
-        const response = await fetch('http://localhost:1942/status');
+        const response = await fetch('http://localhost:1942/api/v1/status');
         const data = await response.json();
 
         if (data.status === 'Connected') {
@@ -11,6 +11,8 @@ document.addEventListener('DOMContentLoaded', async () => {
     await loadTasks();
 });
 
+const API_URL = 'http://localhost:1942/api/v1';
+
 // Store term descriptions
 let termDescriptions = {};
 
@@ -26,7 +28,7 @@ async function fetchTerms() {
 
 // Load tasks from the server and populate the table
 async function loadTasks() {
-    const response = await fetch(`http://localhost:1942/tasks/all`);
+    const response = await fetch(`${API_URL}/tasks`);
     const tasks = await response.json();
     tasks.forEach(task => {
         const termDescription = termDescriptions[task.term] || task.term;
@@ -103,18 +105,16 @@ async function pollTaskStatus(taskId, startImg, statusCell) {
 // Toggle the task status between running and stopped
 async function toggleTaskStatus(startImg, statusCell, taskId) {
     if (statusCell.textContent === 'Stopped') {
-        const response = await fetch(`http://localhost:1942/tasks/run?id=${taskId}`);
-        const data = await response.json();
-        if (data.message === "Task is running") {
+        const response = await fetch(`${API_URL}/tasks/${taskId}/start`, { method: 'POST' });
+        if (response.ok) {
             statusCell.textContent = 'Running';
             startImg.src = './img/stop.png';
             startImg.alt = 'Stop';
             pollTaskStatus(taskId, startImg, statusCell);
         }
     } else {
-        const response = await fetch(`http://localhost:1942/tasks/delete?id=${taskId}`);
-        const data = await response.json();
-        if (data.message === 'Task deleted') {
+        const response = await fetch(`${API_URL}/tasks/${taskId}`, { method: 'DELETE' });
+        if (response.ok) {
             statusCell.textContent = 'Stopped';
             startImg.src = './img/play.png';
             startImg.alt = 'Start';
@@ -125,13 +125,15 @@ async function toggleTaskStatus(startImg, statusCell, taskId) {
 // Delete a task from the table and server
 async function deleteTask(row, taskId) {
     row.remove();
-    const response = await fetch(`http://localhost:1942/tasks/delete?id=${taskId}`);
-    const data = await response.json();
+    await fetch(`${API_URL}/tasks/${taskId}`, { method: 'DELETE' });
 }
 
 // Fetch the status of a specific task
 async function getTaskStatus(taskId) {
-    const response = await fetch(`http://localhost:1942/tasks/status?id=${taskId}`);
+    const response = await fetch(`${API_URL}/tasks/${taskId}/status`);
+    if (response.status === 404) {
+        return 'Task not found';
+    }
     const data = await response.json();
     return data.status;
 }
@@ -166,14 +168,17 @@ function openCreateModal() {
 
         const credentials = await window.electron.getCredentials();
         const webhookUrl = await window.electron.getWebhookUrl();
-        const response = await fetch('http://localhost:1942/tasks/create', {
+        const response = await fetch(`${API_URL}/tasks`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ id: taskId, mode, term, crns, username: credentials.username, password: credentials.password, status: "Created", webhook_url: webhookUrl })
         });
         const data = await response.json();
-        if (data.message === 'Task created') {
+        if (response.ok) {
             addTask(taskId, mode, createTerm.selectedOptions[0].text, crns, 'Stopped');
+        } else {
+            showError(createCrns, createCrnsError, data.error.message);
+            modal.style.display = 'block';
         }
     };
 
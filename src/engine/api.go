@@ -0,0 +1,721 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"proj/tasks"
+	"proj/vault"
+	"strings"
+)
+
+const apiPrefix = "/api/v1"
+
+// apiError is the JSON body returned for every failed API request.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+	Index   *int   `json:"index,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// API serves the versioned REST interface on top of a TaskManager.
+type API struct {
+	taskManager *tasks.TaskManager
+	// vault stores the accounts tasks sign in with; nil when the engine runs
+	// without one.
+	vault *vault.Vault
+}
+
+// writeJSON encodes value as the JSON response body with the given status.
+func writeJSON(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		slog.Error("encoding response", "error", err)
+	}
+}
+
+// writeError writes a structured error body.
+func writeError(writer http.ResponseWriter, status int, code, message string) {
+	writeJSON(writer, status, map[string]apiError{"error": {Code: code, Message: message}})
+}
+
+// writeTaskError maps errors from the tasks package onto HTTP responses.
+func writeTaskError(writer http.ResponseWriter, err error) {
+	body := apiError{Message: err.Error()}
+	status := http.StatusInternalServerError
+
+	var bulkErr *tasks.BulkError
+	if errors.As(err, &bulkErr) {
+		index := bulkErr.Index
+		body.Index = &index
+	}
+
+	var validationErr *tasks.ValidationError
+	var fileErrs tasks.FileErrors
+	switch {
+	case errors.As(err, &fileErrs):
+		status, body.Code, body.Details = http.StatusUnprocessableEntity, "invalid_task_file", fileErrs
+	case errors.As(err, &validationErr):
+		status, body.Code, body.Field = http.StatusUnprocessableEntity, "validation_failed", validationErr.Field
+	case errors.Is(err, tasks.ErrTaskNotFound):
+		status, body.Code = http.StatusNotFound, "task_not_found"
+	case errors.Is(err, tasks.ErrTaskExists):
+		status, body.Code = http.StatusConflict, "task_exists"
+	case errors.Is(err, tasks.ErrTaskRunning):
+		status, body.Code = http.StatusConflict, "task_running"
+	case errors.Is(err, tasks.ErrShuttingDown):
+		status, body.Code = http.StatusServiceUnavailable, "shutting_down"
+	case errors.Is(err, tasks.ErrMFANotPending):
+		status, body.Code = http.StatusConflict, "mfa_not_pending"
+	case errors.Is(err, vault.ErrAccountNotFound):
+		status, body.Code = http.StatusNotFound, "account_not_found"
+	case errors.Is(err, vault.ErrAccountExists):
+		status, body.Code = http.StatusConflict, "account_exists"
+	default:
+		body.Code = "internal_error"
+	}
+	writeJSON(writer, status, map[string]apiError{"error": body})
+}
+
+// allowMethods rejects the request with 405 unless its method is listed.
+func allowMethods(writer http.ResponseWriter, request *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	writer.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(writer, http.StatusMethodNotAllowed, "method_not_allowed",
+		fmt.Sprintf("%s is not allowed on %s", request.Method, request.URL.Path))
+	return false
+}
+
+// decodeBody decodes a JSON request body, rejecting unknown fields.
+func decodeBody(writer http.ResponseWriter, request *http.Request, value any) bool {
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid_body", fmt.Sprintf("Invalid JSON body: %v", err))
+		return false
+	}
+	return true
+}
+
+// Register mounts the v1 routes on mux.
+func (api *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc(apiPrefix+"/status", api.handleStatus)
+	mux.HandleFunc(apiPrefix+"/tasks", api.handleTasks)
+	mux.HandleFunc(apiPrefix+"/tasks/", api.handleTask)
+	mux.HandleFunc(apiPrefix+"/events", api.handleEvents)
+	mux.HandleFunc(apiPrefix+"/search", api.handleSearch)
+	mux.HandleFunc(apiPrefix+"/institutions", api.handleInstitutions)
+	mux.HandleFunc(apiPrefix+"/fingerprints", api.handleFingerprints)
+	mux.HandleFunc(apiPrefix+"/accounts", api.handleAccounts)
+	mux.HandleFunc(apiPrefix+"/accounts/", api.handleAccount)
+	mux.HandleFunc(apiPrefix+"/proxies", api.handleProxies)
+	mux.HandleFunc(apiPrefix+"/watches", api.handleWatches)
+	mux.HandleFunc(apiPrefix+"/schedule", api.handleSchedule)
+	mux.HandleFunc(apiPrefix+"/schedule/refresh", api.handleScheduleRefresh)
+	mux.HandleFunc("/openapi.json", handleOpenAPI)
+	mux.Handle("/metrics", tasks.MetricsHandler())
+}
+
+// handleStatus is the health check endpoint.
+func (api *API) handleStatus(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]string{"status": "Connected"})
+}
+
+// handleTasks serves GET and POST on the task collection.
+func (api *API) handleTasks(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if request.Method == http.MethodGet {
+		writeJSON(writer, http.StatusOK, api.taskManager.GetAllSanitizedTasks())
+		return
+	}
+
+	var input tasks.TaskInput
+	if !decodeBody(writer, request, &input) {
+		return
+	}
+	task := tasks.NewTask(&input)
+	if err := api.taskManager.CreateTask(task); err != nil {
+		var bulkErr *tasks.BulkError
+		if errors.As(err, &bulkErr) {
+			err = bulkErr.Err
+		}
+		writeTaskError(writer, err)
+		return
+	}
+	created, _ := api.taskManager.GetTask(task.ID)
+	writeJSON(writer, http.StatusCreated, created)
+}
+
+// handleTask routes /tasks/{id}, /tasks/{id}/..., and the bulk endpoints.
+func (api *API) handleTask(writer http.ResponseWriter, request *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(request.URL.Path, apiPrefix+"/tasks/"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "":
+		api.handleTasks(writer, request)
+	case path == "bulk":
+		api.handleBulkCreate(writer, request)
+	case path == "start":
+		api.handleBulkStart(writer, request)
+	case path == "import":
+		api.handleImport(writer, request)
+	case path == "export":
+		api.handleExport(writer, request)
+	case len(parts) == 1:
+		api.handleTaskItem(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "start":
+		api.handleStart(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "stop":
+		api.handleStop(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "status":
+		api.handleTaskStatus(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "logs":
+		api.handleTaskLogs(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "mfa":
+		api.handleMFA(writer, request, parts[0])
+	default:
+		writeError(writer, http.StatusNotFound, "route_not_found", fmt.Sprintf("No route for %s", request.URL.Path))
+	}
+}
+
+// handleTaskItem serves GET, PATCH and DELETE on a single task.
+func (api *API) handleTaskItem(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodGet, http.MethodPatch, http.MethodDelete) {
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		task, exists := api.taskManager.GetTask(id)
+		if !exists {
+			writeTaskError(writer, tasks.ErrTaskNotFound)
+			return
+		}
+		writeJSON(writer, http.StatusOK, task)
+	case http.MethodPatch:
+		var patch tasks.TaskPatch
+		if !decodeBody(writer, request, &patch) {
+			return
+		}
+		task, err := api.taskManager.UpdateTask(id, &patch)
+		if err != nil {
+			writeTaskError(writer, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, task)
+	case http.MethodDelete:
+		if !api.taskManager.DeleteTask(id) {
+			writeTaskError(writer, tasks.ErrTaskNotFound)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleTaskStatus returns only the status string of a task.
+func (api *API) handleTaskStatus(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	task, exists := api.taskManager.GetTask(id)
+	if !exists {
+		writeTaskError(writer, tasks.ErrTaskNotFound)
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]string{"id": task.ID, "status": task.Status})
+}
+
+// handleTaskLogs returns the recent log entries of a task, optionally only
+// those at or above ?level=.
+func (api *API) handleTaskLogs(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	if _, exists := api.taskManager.GetTask(id); !exists {
+		writeTaskError(writer, tasks.ErrTaskNotFound)
+		return
+	}
+
+	level := slog.LevelDebug
+	if value := request.URL.Query().Get("level"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			writeError(writer, http.StatusBadRequest, "invalid_level", "level must be debug, info, warn or error")
+			return
+		}
+	}
+	writeJSON(writer, http.StatusOK, api.taskManager.Logs.Entries(id, level))
+}
+
+// handleMFA answers the MFA challenge a task is paused on.
+func (api *API) handleMFA(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+	var response tasks.MFAResponse
+	if !decodeBody(writer, request, &response) {
+		return
+	}
+	if err := api.taskManager.SubmitMFA(id, response); err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusAccepted, map[string]string{"id": id, "status": "Verifying MFA"})
+}
+
+// handleStart runs a single task.
+func (api *API) handleStart(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+	if err := api.taskManager.StartTask(id); err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusAccepted, map[string]string{"id": id, "status": "Running"})
+}
+
+// handleStop asks a running task to stop.
+func (api *API) handleStop(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+	if err := api.taskManager.StopTask(id); err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusAccepted, map[string]string{"id": id, "status": "Stopping"})
+}
+
+// handleBulkCreate creates every task in the request body or none of them.
+func (api *API) handleBulkCreate(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+
+	var inputs []*tasks.TaskInput
+	if !decodeBody(writer, request, &inputs) {
+		return
+	}
+	if len(inputs) == 0 {
+		writeError(writer, http.StatusBadRequest, "invalid_body", "Expected a non-empty array of tasks")
+		return
+	}
+	batch := make([]*tasks.Task, len(inputs))
+	for i, input := range inputs {
+		batch[i] = tasks.NewTask(input)
+	}
+	if err := api.taskManager.CreateTasks(batch); err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+
+	created := make([]*tasks.SanitizedTask, 0, len(batch))
+	for _, task := range batch {
+		if sanitized, exists := api.taskManager.GetTask(task.ID); exists {
+			created = append(created, sanitized)
+		}
+	}
+	writeJSON(writer, http.StatusCreated, created)
+}
+
+// handleBulkStart runs every listed task and reports which IDs were unknown.
+func (api *API) handleBulkStart(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if !decodeBody(writer, request, &body) {
+		return
+	}
+	if len(body.IDs) == 0 {
+		writeError(writer, http.StatusBadRequest, "invalid_body", "Expected a non-empty \"ids\" array")
+		return
+	}
+
+	started, missing, running := []string{}, []string{}, []string{}
+	for _, id := range body.IDs {
+		switch err := api.taskManager.StartTask(id); {
+		case err == nil:
+			started = append(started, id)
+		case errors.Is(err, tasks.ErrTaskNotFound):
+			missing = append(missing, id)
+		case errors.Is(err, tasks.ErrTaskRunning):
+			running = append(running, id)
+		default:
+			writeTaskError(writer, err)
+			return
+		}
+	}
+	writeJSON(writer, http.StatusAccepted, map[string][]string{"started": started, "not_found": missing, "running": running})
+}
+
+// taskFileFormat picks the task file format from ?format= or a media type.
+func taskFileFormat(request *http.Request, mediaType string) string {
+	if format := request.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	return tasks.FormatFromName(mediaType)
+}
+
+// handleImport loads a YAML, JSON or TOML task file. Existing tasks with the
+// same IDs are replaced when ?replace=true.
+func (api *API) handleImport(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(request.Body, 1<<20))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+	file, err := tasks.ParseTaskFile(data, taskFileFormat(request, request.Header.Get("Content-Type")))
+	if err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+
+	imported, err := api.taskManager.ImportTasks(file, request.URL.Query().Get("replace") == "true")
+	if err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+	sanitized := make([]*tasks.SanitizedTask, 0, len(imported))
+	for _, task := range imported {
+		sanitized = append(sanitized, tasks.SanitizeTask(task))
+	}
+	writeJSON(writer, http.StatusCreated, sanitized)
+}
+
+// handleExport writes every task as a task file without secrets.
+func (api *API) handleExport(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+
+	format := taskFileFormat(request, request.Header.Get("Accept"))
+	data, err := api.taskManager.ExportTasks().Encode(format)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "unsupported_format", err.Error())
+		return
+	}
+	contentTypes := map[string]string{
+		tasks.FormatJSON: "application/json",
+		tasks.FormatTOML: "application/toml",
+		tasks.FormatYAML: "application/yaml",
+	}
+	writer.Header().Set("Content-Type", contentTypes[format])
+	writer.Write(data)
+}
+
+// handleEvents streams task events to the client as server-sent events.
+func (api *API) handleEvents(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, http.StatusInternalServerError, "streaming_unsupported", "Streaming is not supported")
+		return
+	}
+
+	events, unsubscribe := api.taskManager.Events.Subscribe()
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleSearch runs an anonymous class search.
+func (api *API) handleSearch(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+
+	query := request.URL.Query()
+	courses, err := tasks.SearchCourses(tasks.SearchQuery{
+		Term:         query.Get("term"),
+		Institution:  query.Get("institution"),
+		Subject:      query.Get("subject"),
+		CourseNumber: query.Get("course_number"),
+	})
+	if err != nil {
+		var validationErr *tasks.ValidationError
+		if errors.As(err, &validationErr) {
+			writeTaskError(writer, err)
+			return
+		}
+		writeError(writer, http.StatusBadGateway, "search_failed", err.Error())
+		return
+	}
+	writeJSON(writer, http.StatusOK, courses)
+}
+
+// handleInstitutions lists the institution profiles tasks can select.
+func (api *API) handleInstitutions(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	writeJSON(writer, http.StatusOK, tasks.Institutions())
+}
+
+// handleFingerprints lists the browser fingerprints tasks can pose as.
+func (api *API) handleFingerprints(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	writeJSON(writer, http.StatusOK, tasks.Fingerprints())
+}
+
+// handleProxies reports the health of the proxy pool, with passwords
+// redacted. Engines without a pool report an empty list.
+func (api *API) handleProxies(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	if api.taskManager.Proxies == nil {
+		writeJSON(writer, http.StatusOK, []tasks.ProxyStatus{})
+		return
+	}
+	writeJSON(writer, http.StatusOK, api.taskManager.Proxies.Status())
+}
+
+// handleSchedule lists upcoming task starts, as JSON or, with
+// ?format=ics or an Accept of text/calendar, as an iCalendar feed.
+func (api *API) handleSchedule(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	starts := api.taskManager.Schedule()
+	format := request.URL.Query().Get("format")
+	if format == "" && strings.Contains(request.Header.Get("Accept"), "text/calendar") {
+		format = "ics"
+	}
+	switch format {
+	case "", "json":
+		writeJSON(writer, http.StatusOK, starts)
+	case "ics":
+		writer.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		writer.Write(tasks.ICalendar(starts))
+	default:
+		writeError(writer, http.StatusBadRequest, "unsupported_format", fmt.Sprintf("Unsupported schedule format %q; use json or ics", format))
+	}
+}
+
+// handleScheduleRefresh reads the registration windows of time ticket tasks
+// now instead of waiting for the next refresh.
+func (api *API) handleScheduleRefresh(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodPost) {
+		return
+	}
+	api.taskManager.RefreshTimeTickets(request.Context())
+	writeJSON(writer, http.StatusOK, api.taskManager.Schedule())
+}
+
+// handleWatches lists the sections the watch scheduler polls and the tasks
+// watching each.
+func (api *API) handleWatches(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	writeJSON(writer, http.StatusOK, api.taskManager.Watches.Status())
+}
+
+// accountRequest is the body of account create and rotate requests.
+type accountRequest struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// requireVault answers 503 when the engine runs without a credential vault.
+func (api *API) requireVault(writer http.ResponseWriter) bool {
+	if api.vault == nil {
+		writeError(writer, http.StatusServiceUnavailable, "vault_unavailable", "The engine was started without a credential vault")
+		return false
+	}
+	return true
+}
+
+// handleAccounts serves GET and POST on the account collection. Passwords
+// go in but never come back out.
+func (api *API) handleAccounts(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet, http.MethodPost) || !api.requireVault(writer) {
+		return
+	}
+
+	if request.Method == http.MethodGet {
+		writeJSON(writer, http.StatusOK, api.vault.List())
+		return
+	}
+
+	var body accountRequest
+	if !decodeBody(writer, request, &body) {
+		return
+	}
+	account, err := api.vault.Add(body.ID, body.Username, body.Password)
+	if err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusCreated, account)
+}
+
+// handleAccount routes /accounts/{id}, /accounts/{id}/rotate,
+// /accounts/{id}/eligibility and /accounts/{id}/schedule.
+func (api *API) handleAccount(writer http.ResponseWriter, request *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(request.URL.Path, apiPrefix+"/accounts/"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "":
+		api.handleAccounts(writer, request)
+	case len(parts) == 1:
+		api.handleAccountItem(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "rotate":
+		api.handleRotate(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "eligibility":
+		api.handleEligibility(writer, request, parts[0])
+	case len(parts) == 2 && parts[1] == "schedule":
+		api.handleAccountSchedule(writer, request, parts[0])
+	default:
+		writeError(writer, http.StatusNotFound, "route_not_found", fmt.Sprintf("No route for %s", request.URL.Path))
+	}
+}
+
+// handleAccountItem serves GET and DELETE on a single account. Accounts that
+// tasks still sign in with cannot be deleted.
+func (api *API) handleAccountItem(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodGet, http.MethodDelete) || !api.requireVault(writer) {
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		account, err := api.vault.Get(id)
+		if err != nil {
+			writeTaskError(writer, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, account)
+	case http.MethodDelete:
+		users, err := api.taskManager.DeleteAccount(id, api.vault.Delete)
+		if err != nil {
+			writeTaskError(writer, err)
+			return
+		}
+		if len(users) > 0 {
+			writeJSON(writer, http.StatusConflict, map[string]apiError{"error": {
+				Code:    "account_in_use",
+				Message: fmt.Sprintf("Account %q is used by %d task(s)", id, len(users)),
+				Details: users,
+			}})
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleRotate replaces an account's password. Tasks pick it up the next
+// time they sign in.
+func (api *API) handleRotate(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodPost) || !api.requireVault(writer) {
+		return
+	}
+	var body struct {
+		Password string `json:"password"`
+	}
+	if !decodeBody(writer, request, &body) {
+		return
+	}
+	account, err := api.vault.Rotate(id, body.Password)
+	if err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusOK, account)
+}
+
+// handleEligibility signs in with an account and reports whether it may
+// register for ?term=, with each failure classified and its registration
+// window.
+func (api *API) handleEligibility(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodGet) || !api.requireVault(writer) {
+		return
+	}
+	if _, err := api.vault.Get(id); err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+
+	query := request.URL.Query()
+	eligibility, err := api.taskManager.CheckEligibility(request.Context(), id, query.Get("institution"), query.Get("term"))
+	if err != nil {
+		var validationErr *tasks.ValidationError
+		if errors.As(err, &validationErr) {
+			writeTaskError(writer, err)
+			return
+		}
+		writeError(writer, http.StatusBadGateway, "eligibility_check_failed", err.Error())
+		return
+	}
+	writeJSON(writer, http.StatusOK, eligibility)
+}
+
+// handleAccountSchedule signs in with an account and lists the classes it is
+// registered or waitlisted for in ?term=, with their meeting times.
+func (api *API) handleAccountSchedule(writer http.ResponseWriter, request *http.Request, id string) {
+	if !allowMethods(writer, request, http.MethodGet) || !api.requireVault(writer) {
+		return
+	}
+	if _, err := api.vault.Get(id); err != nil {
+		writeTaskError(writer, err)
+		return
+	}
+
+	query := request.URL.Query()
+	schedule, err := api.taskManager.CheckSchedule(request.Context(), id, query.Get("institution"), query.Get("term"))
+	if err != nil {
+		var validationErr *tasks.ValidationError
+		if errors.As(err, &validationErr) {
+			writeTaskError(writer, err)
+			return
+		}
+		writeError(writer, http.StatusBadGateway, "schedule_check_failed", err.Error())
+		return
+	}
+	writeJSON(writer, http.StatusOK, schedule)
+}
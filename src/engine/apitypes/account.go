@@ -0,0 +1,11 @@
+package apitypes
+
+import "time"
+
+// AccountInfo is a vault account without its password.
+type AccountInfo struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
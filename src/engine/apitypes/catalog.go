@@ -0,0 +1,69 @@
+package apitypes
+
+// SearchQuery narrows a class search to a subject and optional course number.
+type SearchQuery struct {
+	Term         string `json:"term"`
+	Institution  string `json:"institution,omitempty"`
+	Subject      string `json:"subject"`
+	CourseNumber string `json:"course_number"`
+}
+
+// CourseInfo is one section a class search found.
+type CourseInfo struct {
+	TermDesc              string `json:"term_desc"`
+	CourseReferenceNumber string `json:"crn"`
+	Subject               string `json:"subject"`
+	CourseNumber          string `json:"course_number"`
+	SequenceNumber        string `json:"sequence_number"`
+	CourseTitle           string `json:"course_title"`
+	DisplayName           string `json:"instructor"`
+	BeginTime             string `json:"begin_time"`
+	EndTime               string `json:"end_time"`
+	StartDate             string `json:"start_date"`
+	EndDate               string `json:"end_date"`
+	MeetingType           string `json:"meeting_type"`
+	Room                  string `json:"room"`
+	MaximumEnrollment     int    `json:"maximum_enrollment"`
+	Enrollment            int    `json:"enrollment"`
+	SeatsAvailable        int    `json:"seats_available"`
+	WaitAvailable         int    `json:"wait_available"`
+}
+
+// Institution describes where one school's SSO and Banner 9 systems live.
+type Institution struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	SSOProvider string `json:"sso_provider"`
+	// IdPHost serves the username and password form.
+	IdPHost string `json:"idp_host"`
+	// AuthHost brokers SAML between the IdP and the service providers.
+	AuthHost string `json:"auth_host"`
+	// BannerHost serves Banner 9 Student Registration under BannerPath.
+	BannerHost string `json:"banner_host"`
+	BannerPath string `json:"banner_path"`
+	// ServiceProvider is the SAML alias of the registration service provider.
+	ServiceProvider string `json:"service_provider"`
+	HomepageURL     string `json:"homepage_url"`
+	SSOManagerURL   string `json:"sso_manager_url"`
+	// LoginPath overrides where the provider's login form lives: the CAS
+	// login path on IdPHost, or Banner's login page under BannerPath.
+	LoginPath string `json:"login_path,omitempty"`
+	Timezone  string `json:"timezone"`
+	// TermPattern is a regular expression every term code must match, and
+	// TermExample a code that does.
+	TermPattern string `json:"term_pattern"`
+	TermExample string `json:"term_example"`
+}
+
+// Fingerprint is a browser a task poses as: the headers that browser sends,
+// in the order it sends them.
+type Fingerprint struct {
+	ID              string   `json:"id"`
+	UserAgent       string   `json:"user_agent"`
+	SecCHUA         string   `json:"sec_ch_ua,omitempty"`
+	SecCHUAMobile   string   `json:"sec_ch_ua_mobile,omitempty"`
+	SecCHUAPlatform string   `json:"sec_ch_ua_platform,omitempty"`
+	AcceptHTML      string   `json:"accept_html"`
+	AcceptLanguage  string   `json:"accept_language"`
+	HeaderOrder     []string `json:"header_order"`
+}
@@ -0,0 +1,199 @@
+package apitypes
+
+import (
+	"strings"
+	"time"
+)
+
+// Kinds of eligibility failure Banner reports for a term.
+const (
+	EligibilityHold             = "hold"
+	EligibilityTimeTicket       = "time_ticket"
+	EligibilityNotEnrolled      = "not_enrolled"
+	EligibilityAcademicStanding = "academic_standing"
+	EligibilityTermClosed       = "term_closed"
+	EligibilityOther            = "other"
+)
+
+// Outcomes of submitting a CRN for registration.
+const (
+	ResultRegistered = "registered"
+	ResultWaitlisted = "waitlisted"
+	ResultFailed     = "failed"
+	ResultDropped    = "dropped"
+	ResultPending    = "pending"
+	ResultUnknown    = "unknown"
+)
+
+// EligibilityFailure is one reason Banner gives for not letting the account
+// register.
+type EligibilityFailure struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Eligibility is whether an account may register for a term.
+type Eligibility struct {
+	Term        string `json:"term"`
+	Institution string `json:"institution"`
+	// Valid is Banner's verdict right now.
+	Valid bool `json:"valid"`
+	// Ready is whether the account can register once its window opens: the
+	// only failure, if any, is the time ticket.
+	Ready    bool                 `json:"ready"`
+	Failures []EligibilityFailure `json:"failures"`
+	// RegistrationOpens and RegistrationCloses are the account's time
+	// ticket, when Banner reports one.
+	RegistrationOpens  *time.Time `json:"registration_opens,omitempty"`
+	RegistrationCloses *time.Time `json:"registration_closes,omitempty"`
+	CheckedAt          time.Time  `json:"checked_at"`
+}
+
+// TimeTicket returns the time ticket failure, if any.
+func (e *Eligibility) TimeTicket() *EligibilityFailure {
+	for i := range e.Failures {
+		if e.Failures[i].Kind == EligibilityTimeTicket {
+			return &e.Failures[i]
+		}
+	}
+	return nil
+}
+
+// CRNReadiness is whether Banner accepted a CRN into the pending
+// registration, and what it said.
+type CRNReadiness struct {
+	CRN   string `json:"crn"`
+	Ready bool   `json:"ready"`
+	// Reason classifies Message when the CRN is not ready.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Model is the pending registration item Banner returned for the CRN.
+	Model map[string]interface{} `json:"model,omitempty"`
+}
+
+// DryRunReport is the outcome of a DryRun task.
+type DryRunReport struct {
+	Term        string         `json:"term"`
+	Ready       bool           `json:"ready"`
+	Eligibility *Eligibility   `json:"eligibility,omitempty"`
+	CRNs        []CRNReadiness `json:"crns"`
+	// Removed reports whether the pending items were removed again; they
+	// are never submitted either way.
+	Removed   bool      `json:"removed"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// RegistrationResult is what Banner did with one CRN of a batch submission.
+type RegistrationResult struct {
+	CRN    string `json:"crn"`
+	Title  string `json:"title,omitempty"`
+	Status string `json:"status"`
+	// StatusDescription is Banner's own wording of the status.
+	StatusDescription string   `json:"status_description,omitempty"`
+	Errors            []string `json:"errors,omitempty"`
+	CreditHours       *float64 `json:"credit_hours,omitempty"`
+	// AddDate and RegistrationStatusDate are Banner's MM/DD/YYYY dates the
+	// CRN was added and its status last changed.
+	AddDate                string `json:"add_date,omitempty"`
+	RegistrationStatusDate string `json:"registration_status_date,omitempty"`
+	StartDate              string `json:"start_date,omitempty"`
+	CompletionDate         string `json:"completion_date,omitempty"`
+	// Skipped is set when the CRN was not submitted because the account
+	// already held it.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Message is the status to show for the result: the errors that prevented
+// registration, or Banner's status.
+func (r *RegistrationResult) Message() string {
+	switch {
+	case r.Skipped:
+		return "Already " + r.Status
+	case len(r.Errors) > 0 && r.Status != ResultRegistered && r.Status != ResultWaitlisted:
+		return strings.Join(r.Errors, "; ")
+	case r.StatusDescription != "":
+		return r.StatusDescription
+	}
+	return "Unknown status"
+}
+
+// ScheduledStart is an upcoming start of a task, or a time ticket task whose
+// start is not known yet.
+type ScheduledStart struct {
+	TaskID      string `json:"task_id"`
+	Mode        string `json:"mode"`
+	Term        string `json:"term"`
+	Institution string `json:"institution"`
+	// Account is the vault account or username the task signs in with.
+	Account string     `json:"account,omitempty"`
+	CRNs    []string   `json:"crns"`
+	StartAt *time.Time `json:"start_at,omitempty"`
+	Source  string     `json:"source"`
+	// RegistrationOpens and RegistrationCloses are the account's time
+	// ticket, for time ticket tasks.
+	RegistrationOpens  *time.Time `json:"registration_opens,omitempty"`
+	RegistrationCloses *time.Time `json:"registration_closes,omitempty"`
+	CheckedAt          *time.Time `json:"checked_at,omitempty"`
+	// Error is why a time ticket task has no start yet.
+	Error string `json:"error,omitempty"`
+}
+
+// MeetingTime is when and where a class meets.
+type MeetingTime struct {
+	// Days are lower case weekday names; empty for classes without set
+	// meeting days, such as online ones.
+	Days []string `json:"days"`
+	// Start and End are HH:MM in the institution's timezone.
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	Building string `json:"building,omitempty"`
+	Room     string `json:"room,omitempty"`
+	Type     string `json:"type,omitempty"`
+	// StartDate and EndDate are Banner's MM/DD/YYYY dates the meetings run
+	// between.
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+}
+
+// RegisteredClass is a class on an account's schedule.
+type RegisteredClass struct {
+	CRN          string `json:"crn"`
+	Title        string `json:"title,omitempty"`
+	Subject      string `json:"subject,omitempty"`
+	CourseNumber string `json:"course_number,omitempty"`
+	// Status is one of the registration results, such as registered or
+	// waitlisted.
+	Status            string        `json:"status"`
+	StatusDescription string        `json:"status_description,omitempty"`
+	WaitlistPosition  int           `json:"waitlist_position,omitempty"`
+	CreditHours       *float64      `json:"credit_hours,omitempty"`
+	Meetings          []MeetingTime `json:"meetings"`
+}
+
+// Holds reports whether the class keeps the account's place: it is
+// registered or waitlisted.
+func (c *RegisteredClass) Holds() bool {
+	return c.Status == ResultRegistered || c.Status == ResultWaitlisted
+}
+
+// ClassSchedule is what an account is registered for in a term.
+type ClassSchedule struct {
+	Term        string            `json:"term"`
+	Institution string            `json:"institution"`
+	Classes     []RegisteredClass `json:"classes"`
+	CheckedAt   time.Time         `json:"checked_at"`
+}
+
+// Class returns the class with a CRN, or nil. A nil schedule has no
+// classes.
+func (s *ClassSchedule) Class(crn string) *RegisteredClass {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Classes {
+		if s.Classes[i].CRN == crn {
+			return &s.Classes[i]
+		}
+	}
+	return nil
+}
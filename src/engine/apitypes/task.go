@@ -0,0 +1,139 @@
+// Package apitypes holds the payloads of the engine's /api/v1 HTTP API. It
+// depends only on the standard library, so clients can use it without
+// pulling in the engine's HTTP and metrics dependencies.
+package apitypes
+
+import "time"
+
+// TaskInput is the body that creates a task.
+type TaskInput struct {
+	ID           string      `json:"id"`
+	Mode         string      `json:"mode"`
+	Term         string      `json:"term"`
+	Institution  string      `json:"institution,omitempty"`
+	Crns         string      `json:"crns"`
+	Subject      string      `json:"subject,omitempty"`
+	CourseNumber string      `json:"course_number,omitempty"`
+	Username     string      `json:"username,omitempty"`
+	Password     string      `json:"password,omitempty"`
+	Account      string      `json:"account,omitempty"`
+	Proxy        string      `json:"proxy,omitempty"`
+	Fingerprint  string      `json:"fingerprint,omitempty"`
+	Polling      *PollPolicy `json:"polling,omitempty"`
+	Condition    string      `json:"condition,omitempty"`
+	WebhookURL   string      `json:"webhook_url,omitempty"`
+	Capture      bool        `json:"capture,omitempty"`
+	TimeTicket   bool        `json:"time_ticket,omitempty"`
+}
+
+// SanitizedTask is a task as the API returns it, without its password.
+type SanitizedTask struct {
+	ID           string `json:"id"`
+	Mode         string `json:"mode"`
+	Term         string `json:"term"`
+	Institution  string `json:"institution,omitempty"`
+	Crns         string `json:"crns"`
+	Subject      string `json:"subject,omitempty"`
+	CourseNumber string `json:"course_number,omitempty"`
+	Status       string `json:"status"`
+	// Running is set from when the task starts until its run finishes.
+	Running       bool                 `json:"running"`
+	Username      string               `json:"username"`
+	Account       string               `json:"account,omitempty"`
+	Proxy         string               `json:"proxy,omitempty"`
+	Fingerprint   string               `json:"fingerprint,omitempty"`
+	Polling       *PollPolicy          `json:"polling,omitempty"`
+	Condition     string               `json:"condition,omitempty"`
+	WebhookURL    string               `json:"webhook_url"`
+	HomepageURL   string               `json:"homepage_url"`
+	SSOManagerURL string               `json:"sso_manager_url"`
+	StartAt       *time.Time           `json:"start_at,omitempty"`
+	Phase         string               `json:"phase,omitempty"`
+	WaitUntil     *time.Time           `json:"wait_until,omitempty"`
+	Capture       bool                 `json:"capture,omitempty"`
+	TimeTicket    bool                 `json:"time_ticket,omitempty"`
+	Readiness     *DryRunReport        `json:"readiness,omitempty"`
+	Results       []RegistrationResult `json:"results,omitempty"`
+	// MFA is the challenge the task is paused on, if any.
+	MFA *MFAChallenge `json:"mfa,omitempty"`
+}
+
+// TaskPatch holds the task fields a client may change after creation.
+// Nil fields are left untouched.
+type TaskPatch struct {
+	Mode         *string     `json:"mode"`
+	Term         *string     `json:"term"`
+	Institution  *string     `json:"institution"`
+	Crns         *string     `json:"crns"`
+	Subject      *string     `json:"subject"`
+	CourseNumber *string     `json:"course_number"`
+	Username     *string     `json:"username"`
+	Password     *string     `json:"password"`
+	Account      *string     `json:"account"`
+	Proxy        *string     `json:"proxy"`
+	Fingerprint  *string     `json:"fingerprint"`
+	Polling      *PollPolicy `json:"polling"`
+	Condition    *string     `json:"condition"`
+	WebhookURL   *string     `json:"webhook_url"`
+	Capture      *bool       `json:"capture"`
+	TimeTicket   *bool       `json:"time_ticket"`
+}
+
+// PollPolicy controls how often a Watch task polls for seats. Durations are
+// Go duration strings such as "2s" or "500ms".
+type PollPolicy struct {
+	Interval string `json:"interval,omitempty"`
+	// Jitter randomises each wait by up to this fraction of it, so tasks do
+	// not poll in lockstep. Zero uses the engine's default.
+	Jitter float64 `json:"jitter,omitempty"`
+	// FastInterval is used within FastWindow after each of FastTimes, which
+	// are "HH:MM" daily or ":MM" hourly in the institution's timezone.
+	FastInterval string   `json:"fast_interval,omitempty"`
+	FastTimes    []string `json:"fast_times,omitempty"`
+	FastWindow   string   `json:"fast_window,omitempty"`
+	// MaxBackoff caps the exponential backoff after errors and throttling.
+	MaxBackoff string `json:"max_backoff,omitempty"`
+}
+
+// Event is a single change to a task.
+type Event struct {
+	Type   string    `json:"type"`
+	TaskID string    `json:"task_id"`
+	Status string    `json:"status,omitempty"`
+	Time   time.Time `json:"time"`
+	// MFA is the challenge a task paused on, for task.mfa_required.
+	MFA *MFAChallenge `json:"mfa,omitempty"`
+	// SeatChange is the section a Notify task saw change, for
+	// task.seat_change.
+	SeatChange *SeatChange `json:"seat_change,omitempty"`
+}
+
+// LogEntry is one log line kept in memory for a task.
+type LogEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Step    string         `json:"step,omitempty"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+}
+
+// FileError is a single problem found in a task file.
+type FileError struct {
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// MFAChallenge is a second factor prompt the task is paused on.
+type MFAChallenge struct {
+	Methods []string `json:"methods"`
+	// Message is the IdP's feedback, such as a rejected code.
+	Message string `json:"message,omitempty"`
+}
+
+// MFAResponse answers a challenge with a one-time code, or confirms that a
+// push was approved on the user's device.
+type MFAResponse struct {
+	Code string `json:"code,omitempty"`
+	Push bool   `json:"push,omitempty"`
+}
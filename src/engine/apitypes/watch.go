@@ -0,0 +1,67 @@
+package apitypes
+
+import "time"
+
+// Seat states Notify tasks report changes between.
+const (
+	SeatsFull         = "full"
+	SeatsWaitlistOpen = "waitlist_open"
+	SeatsOpen         = "seats_open"
+)
+
+// Enrollment is the seat counts of one section.
+type Enrollment struct {
+	SeatsAvailable int `json:"seats_available"`
+	WaitCapacity   int `json:"wait_capacity"`
+	WaitCount      int `json:"wait_count"`
+	WaitAvailable  int `json:"wait_available"`
+}
+
+// Open reports whether a signup could get a seat or a waitlist spot.
+func (e *Enrollment) Open() bool {
+	return e.WaitCapacity > e.WaitCount && e.WaitAvailable > 0 || (e.SeatsAvailable > 0 && e.WaitAvailable > 0)
+}
+
+// State classifies the seat counts as full, waitlist open or seats open.
+func (e *Enrollment) State() string {
+	switch {
+	case e.SeatsAvailable > 0:
+		return SeatsOpen
+	case e.WaitAvailable > 0:
+		return SeatsWaitlistOpen
+	}
+	return SeatsFull
+}
+
+// SeatChange is a confirmed move of a section between seat states.
+type SeatChange struct {
+	CRN    string      `json:"crn"`
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Before *Enrollment `json:"before"`
+	After  *Enrollment `json:"after"`
+}
+
+// WatchStatus describes one section the scheduler polls.
+type WatchStatus struct {
+	Institution string      `json:"institution"`
+	Term        string      `json:"term"`
+	CRN         string      `json:"crn"`
+	Tasks       []string    `json:"tasks"`
+	Source      string      `json:"source"`
+	Polls       int         `json:"polls"`
+	NextPoll    time.Time   `json:"next_poll"`
+	LastPoll    *time.Time  `json:"last_poll,omitempty"`
+	Enrollment  *Enrollment `json:"enrollment,omitempty"`
+	LastError   string      `json:"last_error,omitempty"`
+}
+
+// ProxyStatus is the health of one proxy in a pool.
+type ProxyStatus struct {
+	URL       string     `json:"url"`
+	Healthy   bool       `json:"healthy"`
+	Failures  int        `json:"failures"`
+	DownUntil *time.Time `json:"down_until,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
@@ -1 +1 @@
-go build -ldflags -H=windowsgui -o engine.exe main.go
\ No newline at end of file
+go build -ldflags -H=windowsgui -o engine.exe .
\ No newline at end of file
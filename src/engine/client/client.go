@@ -0,0 +1,455 @@
+// Package client is a typed Go client for the engine's /api/v1 HTTP API.
+// The routes and payloads mirror openapi.json served by the engine.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"proj/apitypes"
+	"strings"
+)
+
+// DefaultBaseURL is where the engine listens by default.
+const DefaultBaseURL = "http://localhost:1942"
+
+// Client talks to a running engine.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// Error is a structured error returned by the API.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Field      string `json:"field,omitempty"`
+	Index      *int   `json:"index,omitempty"`
+	// Details depends on Code; FileErrors and AccountUsers decode it.
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s (%d): %s [%s]", e.Code, e.StatusCode, e.Message, e.Field)
+	}
+	return fmt.Sprintf("%s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// FileErrors returns the problems of an invalid_task_file error.
+func (e *Error) FileErrors() []apitypes.FileError {
+	var fileErrs []apitypes.FileError
+	if e.Code != "invalid_task_file" || json.Unmarshal(e.Details, &fileErrs) != nil {
+		return nil
+	}
+	return fileErrs
+}
+
+// AccountUsers returns the IDs of the tasks an account_in_use error says
+// still sign in with the account.
+func (e *Error) AccountUsers() []string {
+	var users []string
+	if e.Code != "account_in_use" || json.Unmarshal(e.Details, &users) != nil {
+		return nil
+	}
+	return users
+}
+
+// StartResult reports which tasks a bulk start launched.
+type StartResult struct {
+	Started  []string `json:"started"`
+	NotFound []string `json:"not_found"`
+	// Running lists tasks that were already running and were left alone.
+	Running []string `json:"running"`
+}
+
+// TaskStatus is the status of a single task.
+type TaskStatus struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// New creates a client for the engine at baseURL.
+func New(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// do sends a request and decodes a JSON response into out when non-nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return decodeError(response)
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// decodeError turns an error response into an *Error.
+func decodeError(response *http.Response) error {
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	data, _ := io.ReadAll(response.Body)
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Error == nil {
+		return &Error{StatusCode: response.StatusCode, Code: "unknown", Message: strings.TrimSpace(string(data))}
+	}
+	envelope.Error.StatusCode = response.StatusCode
+	return envelope.Error
+}
+
+// Status checks that the engine is reachable.
+func (c *Client) Status(ctx context.Context) (string, error) {
+	var out struct {
+		Status string `json:"status"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/status", nil, &out)
+	return out.Status, err
+}
+
+// ListTasks returns every task.
+func (c *Client) ListTasks(ctx context.Context) ([]apitypes.SanitizedTask, error) {
+	var out []apitypes.SanitizedTask
+	err := c.do(ctx, http.MethodGet, "/api/v1/tasks", nil, &out)
+	return out, err
+}
+
+// GetTask returns a single task.
+func (c *Client) GetTask(ctx context.Context, id string) (*apitypes.SanitizedTask, error) {
+	var out apitypes.SanitizedTask
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tasks/"+url.PathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTask creates a task.
+func (c *Client) CreateTask(ctx context.Context, task *apitypes.TaskInput) (*apitypes.SanitizedTask, error) {
+	var out apitypes.SanitizedTask
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tasks", task, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTasks creates several tasks; either all are created or none.
+func (c *Client) CreateTasks(ctx context.Context, batch []*apitypes.TaskInput) ([]apitypes.SanitizedTask, error) {
+	var out []apitypes.SanitizedTask
+	err := c.do(ctx, http.MethodPost, "/api/v1/tasks/bulk", batch, &out)
+	return out, err
+}
+
+// UpdateTask changes the non-nil fields of patch.
+func (c *Client) UpdateTask(ctx context.Context, id string, patch *apitypes.TaskPatch) (*apitypes.SanitizedTask, error) {
+	var out apitypes.SanitizedTask
+	if err := c.do(ctx, http.MethodPatch, "/api/v1/tasks/"+url.PathEscape(id), patch, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteTask deletes a task.
+func (c *Client) DeleteTask(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/tasks/"+url.PathEscape(id), nil, nil)
+}
+
+// StartTask starts a task.
+func (c *Client) StartTask(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/tasks/"+url.PathEscape(id)+"/start", nil, nil)
+}
+
+// StopTask asks a running task to stop.
+func (c *Client) StopTask(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/tasks/"+url.PathEscape(id)+"/stop", nil, nil)
+}
+
+// SubmitMFA answers the MFA challenge a task is paused on.
+func (c *Client) SubmitMFA(ctx context.Context, id string, response apitypes.MFAResponse) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/tasks/"+url.PathEscape(id)+"/mfa", response, nil)
+}
+
+// StartTasks starts several tasks.
+func (c *Client) StartTasks(ctx context.Context, ids []string) (*StartResult, error) {
+	var out StartResult
+	body := map[string][]string{"ids": ids}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tasks/start", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TaskStatus returns the status of a task.
+func (c *Client) TaskStatus(ctx context.Context, id string) (*TaskStatus, error) {
+	var out TaskStatus
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tasks/"+url.PathEscape(id)+"/status", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TaskLogs returns a task's recent log entries at or above level; an empty
+// level returns every entry.
+func (c *Client) TaskLogs(ctx context.Context, id, level string) ([]apitypes.LogEntry, error) {
+	path := "/api/v1/tasks/" + url.PathEscape(id) + "/logs"
+	if level != "" {
+		path += "?" + url.Values{"level": {level}}.Encode()
+	}
+	var out []apitypes.LogEntry
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ImportTasks uploads a task file in the given format ("yaml", "json" or
+// "toml"). With replace set, tasks with the same IDs are replaced.
+func (c *Client) ImportTasks(ctx context.Context, format string, data []byte, replace bool) ([]apitypes.SanitizedTask, error) {
+	values := url.Values{"format": {format}}
+	if replace {
+		values.Set("replace", "true")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/v1/tasks/import?"+values.Encode(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		return nil, decodeError(response)
+	}
+
+	var out []apitypes.SanitizedTask
+	err = json.NewDecoder(response.Body).Decode(&out)
+	return out, err
+}
+
+// ExportTasks downloads every task as a task file without secrets.
+func (c *Client) ExportTasks(ctx context.Context, format string) ([]byte, error) {
+	path := "/api/v1/tasks/export?" + url.Values{"format": {format}}.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		return nil, decodeError(response)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// Search runs a class search.
+func (c *Client) Search(ctx context.Context, query apitypes.SearchQuery) ([]apitypes.CourseInfo, error) {
+	values := url.Values{
+		"term":          {query.Term},
+		"subject":       {query.Subject},
+		"course_number": {query.CourseNumber},
+	}
+	if query.Institution != "" {
+		values.Set("institution", query.Institution)
+	}
+	var out []apitypes.CourseInfo
+	err := c.do(ctx, http.MethodGet, "/api/v1/search?"+values.Encode(), nil, &out)
+	return out, err
+}
+
+// Institutions lists the institution profiles tasks can select.
+func (c *Client) Institutions(ctx context.Context) ([]apitypes.Institution, error) {
+	var out []apitypes.Institution
+	err := c.do(ctx, http.MethodGet, "/api/v1/institutions", nil, &out)
+	return out, err
+}
+
+// Fingerprints lists the browser fingerprints tasks can pose as.
+func (c *Client) Fingerprints(ctx context.Context) ([]apitypes.Fingerprint, error) {
+	var out []apitypes.Fingerprint
+	err := c.do(ctx, http.MethodGet, "/api/v1/fingerprints", nil, &out)
+	return out, err
+}
+
+// Proxies reports the health of the engine's proxy pool.
+func (c *Client) Proxies(ctx context.Context) ([]apitypes.ProxyStatus, error) {
+	var out []apitypes.ProxyStatus
+	err := c.do(ctx, http.MethodGet, "/api/v1/proxies", nil, &out)
+	return out, err
+}
+
+// Watches lists the sections the engine's watch scheduler polls.
+func (c *Client) Watches(ctx context.Context) ([]apitypes.WatchStatus, error) {
+	var out []apitypes.WatchStatus
+	err := c.do(ctx, http.MethodGet, "/api/v1/watches", nil, &out)
+	return out, err
+}
+
+// Schedule lists upcoming task starts, including time ticket tasks whose
+// start is not known yet.
+func (c *Client) Schedule(ctx context.Context) ([]apitypes.ScheduledStart, error) {
+	var out []apitypes.ScheduledStart
+	err := c.do(ctx, http.MethodGet, "/api/v1/schedule", nil, &out)
+	return out, err
+}
+
+// RefreshSchedule reads the registration windows of time ticket tasks now
+// and returns the updated schedule.
+func (c *Client) RefreshSchedule(ctx context.Context) ([]apitypes.ScheduledStart, error) {
+	var out []apitypes.ScheduledStart
+	err := c.do(ctx, http.MethodPost, "/api/v1/schedule/refresh", nil, &out)
+	return out, err
+}
+
+// ListAccounts lists the vault's accounts. Passwords are never returned.
+func (c *Client) ListAccounts(ctx context.Context) ([]apitypes.AccountInfo, error) {
+	var out []apitypes.AccountInfo
+	err := c.do(ctx, http.MethodGet, "/api/v1/accounts", nil, &out)
+	return out, err
+}
+
+// GetAccount returns a vault account without its password.
+func (c *Client) GetAccount(ctx context.Context, id string) (*apitypes.AccountInfo, error) {
+	var out apitypes.AccountInfo
+	if err := c.do(ctx, http.MethodGet, "/api/v1/accounts/"+url.PathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddAccount stores a new account in the vault.
+func (c *Client) AddAccount(ctx context.Context, id, username, password string) (*apitypes.AccountInfo, error) {
+	var out apitypes.AccountInfo
+	body := map[string]string{"id": id, "username": username, "password": password}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/accounts", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RotateAccount replaces an account's password for every task that uses it.
+func (c *Client) RotateAccount(ctx context.Context, id, password string) (*apitypes.AccountInfo, error) {
+	var out apitypes.AccountInfo
+	body := map[string]string{"password": password}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/accounts/"+url.PathEscape(id)+"/rotate", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AccountEligibility signs in with an account and reports whether it may
+// register for term. An empty institution is the default one.
+func (c *Client) AccountEligibility(ctx context.Context, id, institution, term string) (*apitypes.Eligibility, error) {
+	query := url.Values{"term": {term}}
+	if institution != "" {
+		query.Set("institution", institution)
+	}
+	var out apitypes.Eligibility
+	if err := c.do(ctx, http.MethodGet, "/api/v1/accounts/"+url.PathEscape(id)+"/eligibility?"+query.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AccountSchedule signs in with an account and lists what it is registered
+// for in term. An empty institution is the default one.
+func (c *Client) AccountSchedule(ctx context.Context, id, institution, term string) (*apitypes.ClassSchedule, error) {
+	query := url.Values{"term": {term}}
+	if institution != "" {
+		query.Set("institution", institution)
+	}
+	var out apitypes.ClassSchedule
+	if err := c.do(ctx, http.MethodGet, "/api/v1/accounts/"+url.PathEscape(id)+"/schedule?"+query.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAccount removes an account no task uses any more.
+func (c *Client) DeleteAccount(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/accounts/"+url.PathEscape(id), nil, nil)
+}
+
+// Events subscribes to the event stream. The channel is closed when ctx is
+// cancelled or the engine closes the connection.
+func (c *Client) Events(ctx context.Context) (<-chan apitypes.Event, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/v1/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 400 {
+		defer response.Body.Close()
+		return nil, decodeError(response)
+	}
+
+	events := make(chan apitypes.Event)
+	go func() {
+		defer close(events)
+		defer response.Body.Close()
+
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			data, found := strings.CutPrefix(scanner.Text(), "data: ")
+			if !found {
+				continue
+			}
+			var event apitypes.Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,71 @@
+// Command mockbanner serves a scripted stand-in for the FHDA SSO and Banner
+// systems so tasks can be run without touching production.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"proj/mockbanner"
+	"sort"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:1943", "address to listen on")
+	name := flag.String("scenario", "open", "built-in scenario: "+strings.Join(scenarioNames(), ", "))
+	file := flag.String("file", "", "JSON scenario file; overrides -scenario")
+	flag.Parse()
+
+	scenario, err := loadScenario(*name, *file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mockbanner:", err)
+		os.Exit(2)
+	}
+
+	overrides := []string{}
+	for _, host := range mockbanner.Hosts {
+		overrides = append(overrides, host+"=http://"+*addr)
+	}
+	fmt.Printf("Serving scenario %q on %s\n", scenario.Name, *addr)
+	fmt.Printf("Start the engine with -host-overrides %s\n", strings.Join(overrides, ","))
+	fmt.Printf("and sign in as %s / %s\n", mockbanner.DefaultUsername, mockbanner.DefaultPassword)
+
+	if err := http.ListenAndServe(*addr, mockbanner.New(scenario)); err != nil {
+		fmt.Fprintln(os.Stderr, "mockbanner:", err)
+		os.Exit(1)
+	}
+}
+
+// loadScenario reads a scenario file or picks a built-in scenario.
+func loadScenario(name, file string) (mockbanner.Scenario, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return mockbanner.Scenario{}, err
+		}
+		var scenario mockbanner.Scenario
+		if err := json.Unmarshal(data, &scenario); err != nil {
+			return mockbanner.Scenario{}, fmt.Errorf("%s: %w", file, err)
+		}
+		return scenario, nil
+	}
+
+	build, exists := mockbanner.Scenarios[name]
+	if !exists {
+		return mockbanner.Scenario{}, fmt.Errorf("unknown scenario %q", name)
+	}
+	return build(), nil
+}
+
+// scenarioNames lists the built-in scenarios in order.
+func scenarioNames() []string {
+	names := make([]string, 0, len(mockbanner.Scenarios))
+	for name := range mockbanner.Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"proj/apitypes"
+	"proj/client"
+	"proj/tasks"
+)
+
+// errNeedsEngine is returned by the commands that act on tasks another
+// process runs. In-process tasks end with the command that ran them, so
+// there is nothing for them to find without an engine.
+var errNeedsEngine = errors.New("this command needs a running engine; pass -engine or set VEIL_ENGINE")
+
+// backend is where the CLI runs tasks: in this process or on an engine.
+type backend interface {
+	Create(ctx context.Context, task *tasks.Task) error
+	Start(ctx context.Context, id string) error
+	Stop(ctx context.Context, id string) error
+	Events(ctx context.Context) (<-chan tasks.Event, error)
+	List(ctx context.Context) ([]tasks.SanitizedTask, error)
+	Task(ctx context.Context, id string) (*tasks.SanitizedTask, error)
+	Status(ctx context.Context, id string) (string, error)
+	Search(ctx context.Context, query tasks.SearchQuery) ([]tasks.CourseInfo, error)
+}
+
+// newBackend returns a remote backend when engineURL is set, otherwise an
+// in-process TaskManager.
+func newBackend(engineURL string) backend {
+	if engineURL != "" {
+		return &remoteBackend{client: client.New(engineURL)}
+	}
+	return newLocalBackend()
+}
+
+// newLocalBackend creates an in-process TaskManager. Status changes are
+// printed from events, so only warnings and errors are logged.
+func newLocalBackend() *localBackend {
+	taskManager := tasks.NewTaskManager()
+	slog.SetDefault(tasks.NewLogger(tasks.LogOptions{Output: os.Stderr, Level: slog.LevelWarn}, taskManager.Logs))
+	return &localBackend{taskManager: taskManager}
+}
+
+// localBackend runs tasks inside the CLI process.
+type localBackend struct {
+	taskManager *tasks.TaskManager
+}
+
+func (b *localBackend) Create(ctx context.Context, task *tasks.Task) error {
+	return b.taskManager.CreateTask(task)
+}
+
+func (b *localBackend) Start(ctx context.Context, id string) error {
+	return b.taskManager.StartTask(id)
+}
+
+func (b *localBackend) Stop(ctx context.Context, id string) error {
+	return b.taskManager.StopTask(id)
+}
+
+func (b *localBackend) Events(ctx context.Context) (<-chan tasks.Event, error) {
+	events, unsubscribe := b.taskManager.Events.Subscribe()
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+	return events, nil
+}
+
+func (b *localBackend) List(ctx context.Context) ([]tasks.SanitizedTask, error) {
+	all := b.taskManager.GetAllSanitizedTasks()
+	list := make([]tasks.SanitizedTask, 0, len(all))
+	for _, task := range all {
+		list = append(list, *task)
+	}
+	return list, nil
+}
+
+func (b *localBackend) Task(ctx context.Context, id string) (*tasks.SanitizedTask, error) {
+	task, exists := b.taskManager.GetTask(id)
+	if !exists {
+		return nil, tasks.ErrTaskNotFound
+	}
+	return task, nil
+}
+
+func (b *localBackend) Status(ctx context.Context, id string) (string, error) {
+	task, exists := b.taskManager.GetTask(id)
+	if !exists {
+		return "", tasks.ErrTaskNotFound
+	}
+	return task.Status, nil
+}
+
+func (b *localBackend) Search(ctx context.Context, query tasks.SearchQuery) ([]tasks.CourseInfo, error) {
+	return tasks.SearchCourses(query)
+}
+
+// remoteBackend drives a running engine over its HTTP API.
+type remoteBackend struct {
+	client *client.Client
+}
+
+func (b *remoteBackend) Create(ctx context.Context, task *tasks.Task) error {
+	_, err := b.client.CreateTask(ctx, &apitypes.TaskInput{
+		ID:           task.ID,
+		Mode:         task.Mode,
+		Term:         task.Term,
+		Institution:  task.Institution,
+		Crns:         task.Crns,
+		Subject:      task.Subject,
+		CourseNumber: task.CourseNumber,
+		Username:     task.Username,
+		Password:     task.Password,
+		Account:      task.Account,
+		Proxy:        task.Proxy,
+		Fingerprint:  task.Fingerprint,
+		Polling:      task.Polling,
+		Condition:    task.Condition,
+		WebhookURL:   task.WebhookURL,
+		Capture:      task.Capture,
+		TimeTicket:   task.TimeTicket,
+	})
+	return err
+}
+
+func (b *remoteBackend) Start(ctx context.Context, id string) error {
+	return b.client.StartTask(ctx, id)
+}
+
+func (b *remoteBackend) Stop(ctx context.Context, id string) error {
+	return b.client.StopTask(ctx, id)
+}
+
+func (b *remoteBackend) Events(ctx context.Context) (<-chan tasks.Event, error) {
+	return b.client.Events(ctx)
+}
+
+func (b *remoteBackend) List(ctx context.Context) ([]tasks.SanitizedTask, error) {
+	return b.client.ListTasks(ctx)
+}
+
+func (b *remoteBackend) Task(ctx context.Context, id string) (*tasks.SanitizedTask, error) {
+	return b.client.GetTask(ctx, id)
+}
+
+func (b *remoteBackend) Status(ctx context.Context, id string) (string, error) {
+	status, err := b.client.TaskStatus(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return status.Status, nil
+}
+
+func (b *remoteBackend) Search(ctx context.Context, query tasks.SearchQuery) ([]tasks.CourseInfo, error) {
+	return b.client.Search(ctx, query)
+}
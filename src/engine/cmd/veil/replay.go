@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"proj/replay"
+	"proj/tasks"
+	"time"
+)
+
+// replayCommand re-runs a captured flow against a local stand-in server that
+// answers with the captured responses.
+func replayCommand(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	opts := commonFlags(flags)
+	timeout := flags.Duration("timeout", 2*time.Minute, "stop the replay after this long")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: veil replay [flags] <capture.har>")
+	}
+	if opts.engine != "" {
+		return errors.New("replay runs in-process only; drop -engine")
+	}
+
+	archive, err := tasks.ReadHAR(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if archive.Log.Task == nil {
+		return errors.New("capture does not record its task; it was not written by veil")
+	}
+
+	server := replay.NewServer(archive)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	go http.Serve(listener, server)
+
+	// Credentials are redacted in captures; the stand-in accepts any.
+	taskManager := newLocalBackend().taskManager
+	taskManager.HostOverrides = map[string]string{}
+	for _, host := range server.Hosts() {
+		taskManager.HostOverrides[host] = "http://" + listener.Addr().String()
+	}
+	task := &tasks.Task{
+		ID:          "replay-" + archive.Log.Task.ID,
+		Mode:        archive.Log.Task.Mode,
+		Term:        archive.Log.Task.Term,
+		Institution: archive.Log.Task.Institution,
+		Crns:        archive.Log.Task.Crns,
+		Username:    "replay",
+		Password:    "replay",
+	}
+
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+	if err := taskManager.CreateTask(task); err != nil {
+		return err
+	}
+	taskManager.RunTask(task.ID)
+
+	deadline := time.After(*timeout)
+	for finished := false; !finished; {
+		select {
+		case <-server.Exhausted():
+			taskManager.StopTask(task.ID)
+		case <-deadline:
+			fmt.Fprintln(os.Stderr, "Replay timed out")
+			taskManager.StopTask(task.ID)
+		case event := <-events:
+			if event.TaskID != task.ID {
+				continue
+			}
+			if err := printEvent(opts, event); err != nil {
+				return err
+			}
+			finished = event.Type == tasks.EventTaskFinished
+		}
+	}
+
+	summary := server.Summary()
+	if opts.json {
+		if err := printJSON(summary); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Replayed %d of %d captured requests\n", summary.Replayed, summary.Captured)
+		for _, request := range summary.Unmatched {
+			fmt.Println("  not captured:", request)
+		}
+		for _, request := range summary.Unused {
+			fmt.Println("  not requested:", request)
+		}
+	}
+	if len(summary.Unused) > 0 {
+		return errors.New("replayed flow diverged from the capture")
+	}
+	return nil
+}
@@ -1,94 +1,225 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"proj/tasks"
+	"proj/vault"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// Initialize TaskManager
-	taskManager := &tasks.TaskManager{
-		Tasks: make(map[string]*tasks.Task),
-	}
-
-	// Health check endpoint
-	http.HandleFunc("/status", func(writer http.ResponseWriter, request *http.Request) {
-		response := map[string]string{"status": "Connected"}
-		json.NewEncoder(writer).Encode(response)
-	})
-
-	// Get task status by ID
-	http.HandleFunc("/tasks/status", func(writer http.ResponseWriter, request *http.Request) {
-		id := request.URL.Query().Get("id")
-		if id == "" {
-			http.Error(writer, "Missing task ID", http.StatusBadRequest)
-			return
-		}
+	taskFile := flag.String("tasks", "", "YAML, JSON or TOML task file to load at startup")
+	checkpointFile := flag.String("checkpoint", "veil-checkpoint.json", "file that stores resumable task state; empty disables checkpoints")
+	institutionsFile := flag.String("institutions", "", "JSON file of extra institution profiles tasks can select")
+	vaultFile := flag.String("vault", "", "encrypted credential vault file; the passphrase is read from $VEIL_VAULT_PASSPHRASE")
+	vaultKeyring := flag.Bool("vault-keyring", false, "unlock the -vault file with a key kept in the OS keyring instead of a passphrase")
+	proxyFile := flag.String("proxies", "", "file of proxy URLs, one per line, for tasks with \"proxy\": \"pool\"")
+	proxyStrategy := flag.String("proxy-strategy", tasks.ProxySticky, "how pool proxies are assigned: sticky (one per account) or round-robin")
+	proxyCheckInterval := flag.Duration("proxy-check-interval", 5*time.Minute, "how often pool proxies are health checked; 0 disables checks")
+	proxyCheckURL := flag.String("proxy-check-url", "", "URL fetched through each pool proxy by health checks (default the default institution's homepage)")
+	timeTicketRefresh := flag.Duration("time-ticket-refresh", 6*time.Hour, "how often the registration windows of time ticket tasks are read; 0 disables time ticket scheduling")
+	timeTicketLead := flag.Duration("time-ticket-lead", tasks.DefaultTimeTicketLead, "how long before its registration window opens a time ticket task starts")
+	watchBudget := flag.Int("watch-budget", 0, "most enrollment polls per minute across all watched CRNs; 0 is unlimited")
+	captureDir := flag.String("capture-dir", "captures", "directory for HAR files of tasks with capture enabled")
+	hostOverrides := flag.String("host-overrides", "", "comma separated host=URL pairs that redirect requests, e.g. to a mock Banner server")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long running tasks get to finish in-flight work on shutdown")
+	logLevel := flag.String("log-level", "info", "minimum level written to the log: debug, info, warn or error")
+	logFile := flag.String("log-file", "", "also write logs to this file, rotated by size")
+	logJSON := flag.Bool("log-json", false, "write logs as JSON instead of key=value text")
+	flag.Parse()
 
-		status := taskManager.GetTaskStatus(id)
-		response := map[string]string{"status": status}
-		json.NewEncoder(writer).Encode(response)
-	})
-
-	// Create a new task
-	http.HandleFunc("/tasks/create", func(writer http.ResponseWriter, request *http.Request) {
-		var task tasks.Task
-		if err := json.NewDecoder(request.Body).Decode(&task); err != nil {
-			http.Error(writer, "Invalid task data", http.StatusBadRequest)
-			return
-		}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid -log-level:", err)
+		os.Exit(2)
+	}
 
-		taskManager.AddTask(&task)
-		response := map[string]string{"message": "Task created"}
-		json.NewEncoder(writer).Encode(response)
-	})
-
-	// Delete a task by ID
-	http.HandleFunc("/tasks/delete", func(writer http.ResponseWriter, request *http.Request) {
-		id := request.URL.Query().Get("id")
-		if id == "" {
-			http.Error(writer, "Missing task ID", http.StatusBadRequest)
-			return
+	// Initialize TaskManager and route every log line through its redacting
+	// logger
+	taskManager := tasks.NewTaskManager()
+	slog.SetDefault(tasks.NewLogger(tasks.LogOptions{
+		Level:      level,
+		JSON:       *logJSON,
+		File:       *logFile,
+		MaxSizeMB:  10,
+		MaxBackups: 5,
+		MaxAgeDays: 28,
+	}, taskManager.Logs))
+	taskManager.CaptureDir = *captureDir
+	if *institutionsFile != "" {
+		if err := tasks.LoadInstitutions(*institutionsFile); err != nil {
+			slog.Error("loading institutions", "path", *institutionsFile, "error", err)
+			os.Exit(1)
 		}
-
-		if taskManager.DeleteTask(id) {
-			response := map[string]string{"message": "Task deleted"}
-			json.NewEncoder(writer).Encode(response)
+	}
+	var accounts *vault.Vault
+	if *vaultFile != "" {
+		var err error
+		if *vaultKeyring {
+			accounts, err = vault.OpenWithKeyring(*vaultFile)
 		} else {
-			http.Error(writer, "Task not found", http.StatusNotFound)
+			accounts, err = vault.Open(*vaultFile, []byte(os.Getenv("VEIL_VAULT_PASSPHRASE")))
+		}
+		if err != nil {
+			slog.Error("opening credential vault", "path", *vaultFile, "error", err)
+			os.Exit(1)
+		}
+		taskManager.Accounts = accounts
+	}
+	if *proxyFile != "" {
+		pool, err := tasks.LoadProxyPool(*proxyFile, *proxyStrategy)
+		if err != nil {
+			slog.Error("loading proxies", "path", *proxyFile, "error", err)
+			os.Exit(1)
+		}
+		taskManager.Proxies = pool
+	}
+	if err := taskManager.Watches.SetBudget(*watchBudget); err != nil {
+		slog.Error("parsing -watch-budget", "error", err)
+		os.Exit(2)
+	}
+	taskManager.TimeTicketLead = *timeTicketLead
+	if *hostOverrides != "" {
+		overrides, err := parseHostOverrides(*hostOverrides)
+		if err != nil {
+			slog.Error("parsing -host-overrides", "error", err)
+			os.Exit(2)
 		}
-	})
-
-	// Run a task by ID
-	http.HandleFunc("/tasks/run", func(writer http.ResponseWriter, request *http.Request) {
-		id := request.URL.Query().Get("id")
-		if id == "" {
-			http.Error(writer, "Missing task ID", http.StatusBadRequest)
-			return
+		taskManager.HostOverrides = overrides
+	}
+
+	// Restore tasks from the last run before loading new ones
+	if *checkpointFile != "" {
+		restored, err := taskManager.LoadCheckpoint(*checkpointFile)
+		if err != nil {
+			slog.Error("loading checkpoint", "path", *checkpointFile, "error", err)
+			os.Exit(1)
+		}
+		if restored > 0 {
+			slog.Info("restored tasks", "count", restored, "path", *checkpointFile)
 		}
+		taskManager.EnableCheckpoints(*checkpointFile)
+	}
 
-		if taskManager.RunTask(id) {
-			response := map[string]string{"message": "Task is running"}
-			json.NewEncoder(writer).Encode(response)
-		} else {
-			http.Error(writer, "Task not found", http.StatusNotFound)
+	// Load the declarative task file, if any
+	if *taskFile != "" {
+		if err := loadTaskFile(taskManager, *taskFile); err != nil {
+			slog.Error("loading task file", "path", *taskFile, "error", err)
+			os.Exit(1)
 		}
-	})
-
-	// Get all sanitized tasks
-	http.HandleFunc("/tasks/all", func(writer http.ResponseWriter, request *http.Request) {
-		tasks := taskManager.GetAllSanitizedTasks()
-		writer.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(writer).Encode(tasks); err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			fmt.Printf("Error encoding tasks: %v\n", err)
+	}
+
+	// Mount the versioned API
+	mux := http.NewServeMux()
+	api := &API{taskManager: taskManager, vault: accounts}
+	api.Register(mux)
+
+	// Long-lived requests such as event streams end when the base context is
+	// cancelled at shutdown.
+	baseContext, cancelBase := context.WithCancel(context.Background())
+	if taskManager.Proxies != nil && *proxyCheckInterval > 0 {
+		target := *proxyCheckURL
+		if target == "" {
+			institution, _ := tasks.LookupInstitution("")
+			target = institution.HomepageURL
 		}
-	})
+		go taskManager.Proxies.RunHealthChecks(baseContext, target, *proxyCheckInterval)
+	}
+	if *timeTicketRefresh > 0 {
+		go taskManager.RunTimeTickets(baseContext, *timeTicketRefresh)
+	}
+	server := &http.Server{
+		Addr:        ":1942",
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return baseContext },
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
 	// Start HTTP server
-	if err := http.ListenAndServe(":1942", nil); err != nil {
-		fmt.Println("Error starting server:", err)
+	serverErrors := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", server.Addr)
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErrors:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("starting server", "error", err)
+		}
+	case received := <-signals:
+		slog.Info("shutting down", "signal", received.String())
+	}
+	signal.Stop(signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting requests first, then let running tasks wind down.
+	cancelBase()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("shutting down server", "error", err)
+	}
+	if err := taskManager.Shutdown(ctx); err != nil {
+		slog.Error("shutting down tasks", "error", err)
+	}
+}
+
+// loadTaskFile parses a task file and imports its tasks. Tasks already
+// restored from the checkpoint keep their saved progress and are skipped.
+func loadTaskFile(taskManager *tasks.TaskManager, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := tasks.ParseTaskFile(data, tasks.FormatFromName(path))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	pending := file.Tasks[:0]
+	for _, spec := range file.Tasks {
+		if _, exists := taskManager.GetTask(spec.ID); !exists {
+			pending = append(pending, spec)
+		}
+	}
+	if file.Tasks = pending; len(file.Tasks) == 0 {
+		return nil
+	}
+
+	imported, err := taskManager.ImportTasks(file, false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	slog.Info("loaded task file", "count", len(imported), "path", path)
+	return nil
+}
+
+// parseHostOverrides parses comma separated host=URL pairs.
+func parseHostOverrides(value string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		host, target, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || host == "" {
+			return nil, fmt.Errorf("%q is not a host=URL pair", pair)
+		}
+		if _, err := url.ParseRequestURI(target); err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+		overrides[host] = target
 	}
+	return overrides, nil
 }
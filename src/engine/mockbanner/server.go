@@ -0,0 +1,657 @@
+// Package mockbanner is a local stand-in for the FHDA SSO and Banner
+// registration systems. It implements the endpoints the engine calls and
+// plays scripted scenarios such as a wrong password, a registration window
+// that has not opened, a full class, a waitlist or a hold. Besides the FHDA
+// Shibboleth and WSO2 chain it accepts plain Shibboleth SAML, CAS and
+// Banner's own login page, so every authenticator can be exercised.
+package mockbanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hosts are the production hosts the engine talks to. Point each at the
+// mock server with HostOverrides.
+var Hosts = []string{
+	"ssoshib.fhda.edu",
+	"eis-prod.ec.fhda.edu",
+	"ssb-prod.ec.fhda.edu",
+	"reg-prod.ec.fhda.edu",
+}
+
+// HostOverrides maps every production host to the mock server at baseURL.
+func HostOverrides(baseURL string) map[string]string {
+	overrides := make(map[string]string, len(Hosts))
+	for _, host := range Hosts {
+		overrides[host] = baseURL
+	}
+	return overrides
+}
+
+// Default credentials accepted by the built-in scenarios.
+const (
+	DefaultUsername = "student"
+	DefaultPassword = "password"
+	DefaultMFACode  = "123456"
+)
+
+// Section is one class section and its enrollment counts.
+type Section struct {
+	CRN          string  `json:"crn"`
+	Subject      string  `json:"subject"`
+	CourseNumber string  `json:"course_number"`
+	Title        string  `json:"title"`
+	Credits      float64 `json:"credits"`
+	Capacity     int     `json:"capacity"`
+	Enrolled     int     `json:"enrolled"`
+	WaitCapacity int     `json:"wait_capacity"`
+	WaitActual   int     `json:"wait_actual"`
+	// Days are the meeting days as Banner letters, e.g. MW or TR, and
+	// BeginTime and EndTime are HHMM.
+	Days      string `json:"days,omitempty"`
+	BeginTime string `json:"begin_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
+	Building  string `json:"building,omitempty"`
+	Room      string `json:"room,omitempty"`
+}
+
+// SeatsAvailable is the number of open enrollment seats.
+func (s *Section) SeatsAvailable() int {
+	return max(s.Capacity-s.Enrolled, 0)
+}
+
+// WaitAvailable is the number of open waitlist seats.
+func (s *Section) WaitAvailable() int {
+	return max(s.WaitCapacity-s.WaitActual, 0)
+}
+
+// Scenario scripts how the mock systems respond.
+type Scenario struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// RegistrationOpensAt delays the registration window; zero means open.
+	RegistrationOpensAt time.Time `json:"registration_opens_at,omitempty"`
+	// Holds are eligibility failures reported for the term.
+	Holds []string `json:"holds,omitempty"`
+	// MFA makes the IdP challenge for a second factor after the password.
+	MFA *MFA `json:"mfa,omitempty"`
+	// EnrollmentFailures are HTTP statuses the next enrollment polls fail
+	// with, in order. A 200 serves an error page without seat counts.
+	EnrollmentFailures []int `json:"enrollment_failures,omitempty"`
+	// AddErrors rejects adding CRNs to the pending registration with a
+	// message, such as a prerequisite or time conflict error.
+	AddErrors map[string]string `json:"add_errors,omitempty"`
+	// SubmitErrors rejects submitting CRNs with these errors, such as a
+	// corequisite Banner only checks on submission.
+	SubmitErrors map[string][]string `json:"submit_errors,omitempty"`
+	// Schedule maps the CRNs the student already holds to their status,
+	// Registered or Waitlisted. Submitted CRNs are added to it.
+	Schedule map[string]string `json:"schedule,omitempty"`
+	Sections []Section         `json:"sections"`
+}
+
+// MFA is the second factor the mock IdP asks for.
+type MFA struct {
+	// Code is the one-time code the IdP accepts.
+	Code string `json:"code"`
+	// Push also offers push approval, which the mock treats as approved.
+	Push bool `json:"push,omitempty"`
+}
+
+// section returns the section with a CRN, or nil.
+func (s *Scenario) section(crn string) *Section {
+	for i := range s.Sections {
+		if s.Sections[i].CRN == crn {
+			return &s.Sections[i]
+		}
+	}
+	return nil
+}
+
+// Scenarios are the built-in scenarios by name. Each call returns a fresh copy.
+var Scenarios = map[string]func() Scenario{
+	"open": func() Scenario {
+		return baseScenario("open")
+	},
+	"wrong-password": func() Scenario {
+		scenario := baseScenario("wrong-password")
+		scenario.Password = "a-different-password"
+		return scenario
+	},
+	"not-yet-open": func() Scenario {
+		scenario := baseScenario("not-yet-open")
+		scenario.RegistrationOpensAt = time.Now().Add(24 * time.Hour)
+		return scenario
+	},
+	"full-class": func() Scenario {
+		scenario := baseScenario("full-class")
+		scenario.Sections[0].Enrolled = scenario.Sections[0].Capacity
+		scenario.Sections[0].WaitActual = scenario.Sections[0].WaitCapacity
+		return scenario
+	},
+	"waitlist": func() Scenario {
+		scenario := baseScenario("waitlist")
+		scenario.Sections[0].Enrolled = scenario.Sections[0].Capacity
+		return scenario
+	},
+	"mfa": func() Scenario {
+		scenario := baseScenario("mfa")
+		scenario.MFA = &MFA{Code: DefaultMFACode, Push: true}
+		return scenario
+	},
+	"hold": func() Scenario {
+		scenario := baseScenario("hold")
+		scenario.Holds = []string{"You have a Registration Hold on your account. Please contact the Admissions and Records office."}
+		return scenario
+	},
+}
+
+// baseScenario is an open registration window with two open sections.
+func baseScenario(name string) Scenario {
+	return Scenario{
+		Name:     name,
+		Username: DefaultUsername,
+		Password: DefaultPassword,
+		Sections: []Section{
+			{CRN: "12345", Subject: "CIS", CourseNumber: "22A", Title: "Intro to Programming", Credits: 4.5, Capacity: 40, Enrolled: 30, WaitCapacity: 15, WaitActual: 0,
+				Days: "MW", BeginTime: "0930", EndTime: "1045", Building: "ATC", Room: "203"},
+			{CRN: "23456", Subject: "MATH", CourseNumber: "1A", Title: "Calculus I", Credits: 5, Capacity: 35, Enrolled: 10, WaitCapacity: 10, WaitActual: 0,
+				Days: "TR", BeginTime: "1330", EndTime: "1520", Building: "S", Room: "42"},
+		},
+	}
+}
+
+// Server serves a Scenario over HTTP.
+type Server struct {
+	scenario Scenario
+	requests map[string]int
+	sessions map[string]bool
+	// mfaPending is set between a correct password and its second factor.
+	mfaPending bool
+	// pending are the CRNs added but neither submitted nor removed.
+	pending map[string]bool
+	mutex   sync.Mutex
+}
+
+// New creates a mock server playing scenario.
+func New(scenario Scenario) *Server {
+	server := &Server{
+		scenario: scenario,
+		requests: make(map[string]int),
+		sessions: make(map[string]bool),
+		pending:  make(map[string]bool),
+	}
+	if server.scenario.Schedule == nil {
+		server.scenario.Schedule = make(map[string]string)
+	}
+	return server
+}
+
+// Update changes the scenario while the server runs, e.g. to open a seat.
+func (s *Server) Update(change func(*Scenario)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	change(&s.scenario)
+}
+
+// Pending returns how many CRNs were added to the pending registration but
+// neither submitted nor removed.
+func (s *Server) Pending() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.pending)
+}
+
+// Requests returns how many requests were made to path.
+func (s *Server) Requests(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[path]
+}
+
+const (
+	sessionCookie = "JSESSIONID"
+	samlResponse  = "bW9jay1zYW1sLXJlc3BvbnNl"
+	samlRequest   = "bW9jay1zYW1sLXJlcXVlc3Q="
+	casTicket     = "ST-1-mock"
+	casExecution  = "e1s1-mock"
+)
+
+// ServeHTTP routes a request to the matching mock endpoint.
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests[request.URL.Path]++
+	request.ParseForm()
+
+	switch path := request.URL.Path; {
+	case path == "/ssomanager/saml/login":
+		writeHTML(writer, "<html><body>Sign in</body></html>")
+	case path == "/idp/profile/SAML2/Redirect/SSO":
+		s.handleLogin(writer, request)
+	case path == "/idp/profile/mfa":
+		s.handleMFA(writer, request)
+	case path == "/idp/profile/SAML2/POST/SSO":
+		if _, login := request.PostForm["j_username"]; login {
+			s.handleLogin(writer, request)
+			return
+		}
+		writeHTML(writer, `<form method="post" action="/idp/profile/SAML2/POST/SSO?execution=e1s1">`+
+			`<input type="text" name="j_username"/><input type="password" name="j_password"/>`+
+			`<button type="submit" name="_eventId_proceed">Login</button></form>`)
+	case path == "/StudentRegistrationSsb/saml/login":
+		writeHTML(writer, fmt.Sprintf(`<form method="post" action="https://ssoshib.fhda.edu/idp/profile/SAML2/POST/SSO">`+
+			`<input type="hidden" name="SAMLRequest" value="%s"/><input type="hidden" name="RelayState" value="ss:mem:sp"/></form>`, samlRequest))
+	case path == "/cas/login":
+		s.handleCASLogin(writer, request)
+	case path == "/StudentRegistrationSsb/login/auth", path == "/StudentRegistrationSsb/login/authfail":
+		writeHTML(writer, bannerLoginForm(request.URL.Query().Has("login_error")))
+	case path == "/StudentRegistrationSsb/j_spring_security_check":
+		if request.PostForm.Get("username") != s.scenario.Username || request.PostForm.Get("password") != s.scenario.Password {
+			http.Redirect(writer, request, "/StudentRegistrationSsb/login/authfail?login_error=1", http.StatusFound)
+			return
+		}
+		s.startSession(writer)
+		http.Redirect(writer, request, "/StudentRegistrationSsb/ssb/registration", http.StatusFound)
+	case path == "/commonauth", path == "/samlsso":
+		if request.PostForm.Get("SAMLResponse") == "" && request.PostForm.Get("SAMLRequest") == "" {
+			writeHTML(writer, `<div class="retry-msg-text text_right_custom">Authentication Error!</div>`)
+			return
+		}
+		writeHTML(writer, samlForm(request.PostForm.Get("RelayState")))
+	case path == "/ssomanager/saml/SSO":
+		writeHTML(writer, "<html><body>Signed in</body></html>")
+	case path == "/StudentRegistrationSsb/ssb/registration/registerPostSignIn" && request.URL.Query().Get("ticket") == casTicket:
+		s.startSession(writer)
+		writeHTML(writer, "<html><body>Registration</body></html>")
+	case path == "/StudentRegistrationSsb/ssb/registration/registerPostSignIn":
+		writeHTML(writer, fmt.Sprintf(`<form><input type="hidden" name="SAMLRequest" value="%s"/></form>`, samlRequest))
+	case path == "/StudentRegistrationSsb/saml/SSO/alias/registrationssb-prod-sp":
+		s.handleServiceProvider(writer, request)
+	case path == "/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo":
+		s.handleEnrollmentInfo(writer, request)
+	case path == "/StudentRegistrationSsb/ssb/term/search" && request.URL.Query().Get("mode") == "search":
+		writeJSON(writer, http.StatusOK, map[string]any{"fwdURL": "/StudentRegistrationSsb/ssb/classSearch/classSearch"})
+	case path == "/StudentRegistrationSsb/ssb/classSearch/resetDataForm":
+		writer.WriteHeader(http.StatusOK)
+	case path == "/StudentRegistrationSsb/ssb/searchResults/searchResults":
+		s.handleSearchResults(writer, request)
+	case !s.signedIn(request):
+		writeJSON(writer, http.StatusUnauthorized, map[string]any{"success": false, "message": "Not signed in"})
+	case path == "/StudentRegistrationSsb/ssb/registration":
+		writeHTML(writer, "<html><body>Registration</body></html>")
+	case path == "/StudentRegistrationSsb/ssb/term/search":
+		s.handleTermSearch(writer)
+	case path == "/StudentRegistrationSsb/ssb/classRegistration/classRegistration":
+		writer.WriteHeader(http.StatusOK)
+	case path == "/StudentRegistrationSsb/ssb/classRegistration/addRegistrationItem":
+		s.handleAddItem(writer, request)
+	case path == "/StudentRegistrationSsb/ssb/classRegistration/submitRegistration/batch":
+		s.handleBatch(writer, request)
+	case path == "/StudentRegistrationSsb/ssb/classRegistration/getRegisteredClasses":
+		s.handleRegisteredClasses(writer)
+	case path == "/StudentRegistrationSsb/ssb/classRegistration/getScheduleDetails":
+		s.handleScheduleDetails(writer, request)
+	default:
+		http.NotFound(writer, request)
+	}
+}
+
+// handleLogin checks the IdP credentials.
+func (s *Server) handleLogin(writer http.ResponseWriter, request *http.Request) {
+	alert := func(message string) {
+		writeHTML(writer, fmt.Sprintf(`<div class="alert alert-danger">%s</div>`, html.EscapeString(message)))
+	}
+	switch {
+	case request.PostForm.Get("j_username") != s.scenario.Username:
+		alert("The username you entered cannot be identified.")
+	case request.PostForm.Get("j_password") != s.scenario.Password:
+		alert("The password you entered was incorrect.")
+	case s.scenario.MFA != nil:
+		s.mfaPending = true
+		writeHTML(writer, s.mfaForm(""))
+	default:
+		writeHTML(writer, samlForm("ss:mem:mock"))
+	}
+}
+
+// handleMFA checks the second factor and finishes the IdP login.
+func (s *Server) handleMFA(writer http.ResponseWriter, request *http.Request) {
+	switch {
+	case !s.mfaPending || s.scenario.MFA == nil:
+		writeHTML(writer, `<div class="alert alert-danger">You may be seeing this page because you used the Back button while browsing a secure web site or application...</div>`)
+	case request.PostForm.Has("_eventId_push") && s.scenario.MFA.Push,
+		request.PostForm.Get("j_mfa_token") == s.scenario.MFA.Code:
+		s.mfaPending = false
+		writeHTML(writer, samlForm("ss:mem:mock"))
+	default:
+		writeHTML(writer, s.mfaForm("Incorrect passcode."))
+	}
+}
+
+// mfaForm is the IdP's second factor page, with an error after a rejected
+// code.
+func (s *Server) mfaForm(message string) string {
+	var body strings.Builder
+	if message != "" {
+		fmt.Fprintf(&body, `<div class="alert alert-danger">%s</div>`, html.EscapeString(message))
+	}
+	body.WriteString(`<form method="post" action="/idp/profile/mfa"><input type="hidden" name="csrf_token" value="mock"/>` +
+		`<input type="text" name="j_mfa_token" autocomplete="one-time-code"/>` +
+		`<button type="submit" name="_eventId_proceed">Verify</button>`)
+	if s.scenario.MFA.Push {
+		body.WriteString(`<button type="submit" name="_eventId_push" value="push">Send Me a Push</button>`)
+	}
+	body.WriteString(`</form>`)
+	return body.String()
+}
+
+// handleServiceProvider completes the SAML chain and starts a Banner session.
+func (s *Server) handleServiceProvider(writer http.ResponseWriter, request *http.Request) {
+	if request.PostForm.Get("SAMLResponse") != samlResponse {
+		writeHTML(writer, "<html><body>Invalid SAML response</body></html>")
+		return
+	}
+	s.startSession(writer)
+	writeHTML(writer, "<html><body>Registration</body></html>")
+}
+
+// handleCASLogin serves the CAS login form and, once the credentials check
+// out, sends the client back to the service with a ticket. The service is
+// reduced to its path so the redirect stays on the mock server.
+func (s *Server) handleCASLogin(writer http.ResponseWriter, request *http.Request) {
+	service, err := url.Parse(request.URL.Query().Get("service"))
+	if err != nil || service.Path == "" {
+		http.Error(writer, "missing service", http.StatusBadRequest)
+		return
+	}
+	form := func(message string) string {
+		return fmt.Sprintf(`<div id="msg" class="errors">%s</div><form id="fm1" method="post" action="%s">`+
+			`<input type="text" name="username"/><input type="password" name="password"/>`+
+			`<input type="hidden" name="execution" value="%s"/><input type="hidden" name="_eventId" value="submit"/>`+
+			`<input type="submit" name="submit" value="LOGIN"/></form>`,
+			html.EscapeString(message), html.EscapeString(request.URL.RequestURI()), casExecution)
+	}
+
+	switch {
+	case request.Method != http.MethodPost:
+		writeHTML(writer, form(""))
+	case request.PostForm.Get("execution") != casExecution:
+		writeHTML(writer, form("Your login session has expired."))
+	case request.PostForm.Get("username") != s.scenario.Username, request.PostForm.Get("password") != s.scenario.Password:
+		writeHTML(writer, form("Invalid credentials."))
+	default:
+		query := service.Query()
+		query.Set("ticket", casTicket)
+		http.Redirect(writer, request, service.Path+"?"+query.Encode(), http.StatusFound)
+	}
+}
+
+// bannerLoginForm is Banner's own login page, with an error after a failed
+// attempt.
+func bannerLoginForm(failed bool) string {
+	var message string
+	if failed {
+		message = `<div class="error">Invalid username or password.</div>`
+	}
+	return message + `<form method="post" action="/StudentRegistrationSsb/j_spring_security_check">` +
+		`<input type="text" name="username"/><input type="password" name="password"/>` +
+		`<button type="submit">Sign In</button></form>`
+}
+
+// startSession issues a Banner session cookie.
+func (s *Server) startSession(writer http.ResponseWriter) {
+	session := fmt.Sprintf("mock-%d", time.Now().UnixNano())
+	s.sessions[session] = true
+	http.SetCookie(writer, &http.Cookie{Name: sessionCookie, Value: session, Path: "/"})
+}
+
+// signedIn reports whether the request carries a Banner session.
+func (s *Server) signedIn(request *http.Request) bool {
+	cookie, err := request.Cookie(sessionCookie)
+	return err == nil && s.sessions[cookie.Value]
+}
+
+// handleTermSearch reports registration eligibility for the term.
+func (s *Server) handleTermSearch(writer http.ResponseWriter) {
+	failures := append([]string{}, s.scenario.Holds...)
+	if opens := s.scenario.RegistrationOpensAt; !opens.IsZero() && time.Now().Before(opens) {
+		location, err := time.LoadLocation("America/Los_Angeles")
+		if err != nil {
+			location = time.Local
+		}
+		const layout = "01/02/2006 03:04 PM"
+		failures = append(failures, fmt.Sprintf("You can register from %s to %s.",
+			opens.In(location).Format(layout), opens.Add(90*24*time.Hour).In(location).Format(layout)))
+	}
+	writeJSON(writer, http.StatusOK, map[string]any{
+		"studentEligValid":    len(failures) == 0,
+		"studentEligFailures": failures,
+		"fwdURL":              "/StudentRegistrationSsb/ssb/classRegistration/classRegistration",
+	})
+}
+
+// handleAddItem adds a section to the pending registration.
+func (s *Server) handleAddItem(writer http.ResponseWriter, request *http.Request) {
+	crn := request.URL.Query().Get("courseReferenceNumber")
+	section := s.scenario.section(crn)
+	if section == nil {
+		writeJSON(writer, http.StatusOK, map[string]any{"success": false, "message": "Invalid CRN"})
+		return
+	}
+	if message, rejected := s.scenario.AddErrors[crn]; rejected {
+		writeJSON(writer, http.StatusOK, map[string]any{"success": false, "message": message})
+		return
+	}
+	s.pending[crn] = true
+	writeJSON(writer, http.StatusOK, map[string]any{
+		"success": true,
+		"message": "",
+		"model": map[string]any{
+			"courseReferenceNumber": section.CRN,
+			"courseTitle":           section.Title,
+			"term":                  request.URL.Query().Get("term"),
+			"selectedAction":        "RW",
+		},
+	})
+}
+
+// handleBatch registers, waitlists or rejects each submitted section.
+func (s *Server) handleBatch(writer http.ResponseWriter, request *http.Request) {
+	var batch struct {
+		Update  []map[string]any `json:"update"`
+		Destroy []map[string]any `json:"destroy"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&batch); err != nil {
+		writeJSON(writer, http.StatusBadRequest, map[string]any{"success": false, "message": err.Error()})
+		return
+	}
+
+	destroyed := []map[string]any{}
+	for _, item := range batch.Destroy {
+		crn, _ := item["courseReferenceNumber"].(string)
+		delete(s.pending, crn)
+		destroyed = append(destroyed, map[string]any{"courseReferenceNumber": crn})
+	}
+
+	today := time.Now().Format("01/02/2006")
+	updates := []map[string]any{}
+	for _, item := range batch.Update {
+		crn, _ := item["courseReferenceNumber"].(string)
+		delete(s.pending, crn)
+		update := map[string]any{"courseReferenceNumber": crn, "crnErrors": []any{}}
+		section := s.scenario.section(crn)
+		if section != nil {
+			update["creditHour"] = section.Credits
+			update["addDate"] = today
+			update["registrationStatusDate"] = today
+		}
+		switch {
+		case section == nil:
+			update["statusDescription"] = "Errors Preventing Registration"
+			update["crnErrors"] = []map[string]string{{"message": "Invalid CRN", "messageType": "error"}}
+		case len(s.scenario.SubmitErrors[crn]) > 0:
+			crnErrors := []map[string]string{}
+			for _, message := range s.scenario.SubmitErrors[crn] {
+				crnErrors = append(crnErrors, map[string]string{"message": message, "messageType": "error"})
+			}
+			update["courseTitle"] = section.Title
+			update["statusDescription"] = "Errors Preventing Registration"
+			update["crnErrors"] = crnErrors
+		case section.SeatsAvailable() > 0:
+			section.Enrolled++
+			s.scenario.Schedule[crn] = "Registered"
+			update["courseTitle"] = section.Title
+			update["statusDescription"] = "Registered"
+		case section.WaitAvailable() > 0:
+			section.WaitActual++
+			s.scenario.Schedule[crn] = "Waitlisted"
+			update["courseTitle"] = section.Title
+			update["statusDescription"] = "Waitlisted"
+		default:
+			update["courseTitle"] = section.Title
+			update["statusDescription"] = "Errors Preventing Registration"
+			update["crnErrors"] = []map[string]string{{"message": "Closed Section", "messageType": "error"}}
+		}
+		updates = append(updates, update)
+	}
+	writeJSON(writer, http.StatusOK, map[string]any{
+		"success": true,
+		"data":    map[string]any{"create": []any{}, "destroy": destroyed, "update": updates},
+	})
+}
+
+// handleRegisteredClasses lists the sections on the student's schedule.
+func (s *Server) handleRegisteredClasses(writer http.ResponseWriter) {
+	classes := []map[string]any{}
+	for _, section := range s.scenario.Sections {
+		status, held := s.scenario.Schedule[section.CRN]
+		if !held {
+			continue
+		}
+		class := map[string]any{
+			"courseReferenceNumber":    section.CRN,
+			"courseTitle":              section.Title,
+			"subject":                  section.Subject,
+			"courseNumber":             section.CourseNumber,
+			"courseRegistrationStatus": "RW",
+			"statusDescription":        status,
+			"creditHour":               section.Credits,
+		}
+		if status == "Waitlisted" {
+			class["courseRegistrationStatus"] = "WL"
+			class["waitlistPosition"] = max(section.WaitActual, 1)
+		}
+		classes = append(classes, class)
+	}
+	writeJSON(writer, http.StatusOK, map[string]any{"success": true, "data": classes})
+}
+
+// handleScheduleDetails renders the meeting times of a section.
+func (s *Server) handleScheduleDetails(writer http.ResponseWriter, request *http.Request) {
+	meetings := []map[string]any{}
+	if section := s.scenario.section(request.URL.Query().Get("courseReferenceNumber")); section != nil && section.Days != "" {
+		meetingTime := map[string]any{
+			"beginTime":              section.BeginTime,
+			"endTime":                section.EndTime,
+			"building":               section.Building,
+			"room":                   section.Room,
+			"meetingTypeDescription": "Class",
+			"startDate":              "04/08/2024",
+			"endDate":                "06/28/2024",
+		}
+		for letter, day := range map[rune]string{'M': "monday", 'T': "tuesday", 'W': "wednesday", 'R': "thursday", 'F': "friday", 'S': "saturday", 'U': "sunday"} {
+			meetingTime[day] = strings.ContainsRune(section.Days, letter)
+		}
+		meetings = append(meetings, map[string]any{"courseReferenceNumber": section.CRN, "meetingTime": meetingTime})
+	}
+	writeJSON(writer, http.StatusOK, map[string]any{"fmt": meetings})
+}
+
+// handleEnrollmentInfo renders the seat counts of a section as Banner does.
+func (s *Server) handleEnrollmentInfo(writer http.ResponseWriter, request *http.Request) {
+	if failures := s.scenario.EnrollmentFailures; len(failures) > 0 {
+		s.scenario.EnrollmentFailures = failures[1:]
+		writer.Header().Set("Content-Type", "text/html;charset=UTF-8")
+		writer.WriteHeader(failures[0])
+		writer.Write([]byte("<html><body>Service temporarily unavailable</body></html>"))
+		return
+	}
+	section := s.scenario.section(request.PostForm.Get("courseReferenceNumber"))
+	if section == nil {
+		writeHTML(writer, "<section></section>")
+		return
+	}
+	var body strings.Builder
+	body.WriteString("<section>")
+	for _, row := range []struct {
+		label string
+		value int
+	}{
+		{"Enrollment Actual:", section.Enrolled},
+		{"Enrollment Maximum:", section.Capacity},
+		{"Enrollment Seats Available:", section.SeatsAvailable()},
+		{"Waitlist Capacity:", section.WaitCapacity},
+		{"Waitlist Actual:", section.WaitActual},
+		{"Waitlist Seats Available:", section.WaitAvailable()},
+	} {
+		fmt.Fprintf(&body, `<span class="status-bold">%s</span> <span dir="ltr">%d</span><br>`, row.label, row.value)
+	}
+	body.WriteString("</section>")
+	writeHTML(writer, body.String())
+}
+
+// handleSearchResults lists the sections of a subject, or of one course, as
+// Banner's class search does.
+func (s *Server) handleSearchResults(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	sections := []map[string]any{}
+	for _, section := range s.scenario.Sections {
+		if !strings.EqualFold(section.Subject, query.Get("txt_subject")) {
+			continue
+		}
+		if course := query.Get("txt_courseNumber"); course != "" && !strings.EqualFold(section.CourseNumber, course) {
+			continue
+		}
+		sections = append(sections, map[string]any{
+			"term":                  query.Get("txt_term"),
+			"courseReferenceNumber": section.CRN,
+			"subject":               section.Subject,
+			"courseNumber":          section.CourseNumber,
+			"courseTitle":           section.Title,
+			"maximumEnrollment":     section.Capacity,
+			"enrollment":            section.Enrolled,
+			"seatsAvailable":        section.SeatsAvailable(),
+			"waitCapacity":          section.WaitCapacity,
+			"waitCount":             section.WaitActual,
+			"waitAvailable":         section.WaitAvailable(),
+			"openSection":           section.SeatsAvailable() > 0,
+		})
+	}
+	writeJSON(writer, http.StatusOK, map[string]any{"success": true, "totalCount": len(sections), "data": sections})
+}
+
+// samlForm is the auto-submitting form the IdP returns after a step.
+func samlForm(relayState string) string {
+	return fmt.Sprintf(`<form method="post"><input type="hidden" name="RelayState" value="%s"/><input type="hidden" name="SAMLResponse" value="%s"/></form>`,
+		html.EscapeString(relayState), samlResponse)
+}
+
+func writeHTML(writer http.ResponseWriter, body string) {
+	writer.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	writer.Write([]byte(body))
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
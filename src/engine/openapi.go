@@ -0,0 +1,18 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves the OpenAPI document describing the v1 API.
+func handleOpenAPI(writer http.ResponseWriter, request *http.Request) {
+	if !allowMethods(writer, request, http.MethodGet) {
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(openAPISpec)
+}
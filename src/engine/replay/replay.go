@@ -0,0 +1,136 @@
+// Package replay serves the responses recorded in a captured HAR file so a
+// task's flow can be re-run against a local stand-in for Banner and SSO.
+package replay
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"proj/tasks"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Summary reports how closely a replayed run followed the capture.
+type Summary struct {
+	Replayed  int      `json:"replayed"`
+	Captured  int      `json:"captured"`
+	Unmatched []string `json:"unmatched"`
+	Unused    []string `json:"unused"`
+}
+
+// Server answers each request with the next unused captured response for the
+// same method and path. Hosts and query strings are ignored, so the flow can
+// be pointed at the server with host overrides.
+type Server struct {
+	entries   []tasks.HAREntry
+	used      []bool
+	unmatched []string
+	exhausted chan struct{}
+	once      sync.Once
+	mutex     sync.Mutex
+}
+
+// NewServer creates a stand-in server for a captured archive.
+func NewServer(archive *tasks.HAR) *Server {
+	return &Server{
+		entries:   archive.Log.Entries,
+		used:      make([]bool, len(archive.Log.Entries)),
+		exhausted: make(chan struct{}),
+	}
+}
+
+// Hosts lists the hosts the captured flow talked to.
+func (s *Server) Hosts() []string {
+	seen := map[string]bool{}
+	for _, entry := range s.entries {
+		if target, err := url.Parse(entry.Request.URL); err == nil && target.Host != "" {
+			seen[target.Host] = true
+		}
+	}
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Exhausted is closed when a request arrives after every captured response
+// has been served, which is where the captured flow ended.
+func (s *Server) Exhausted() <-chan struct{} {
+	return s.exhausted
+}
+
+// Summary returns the replay results so far.
+func (s *Server) Summary() Summary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	summary := Summary{Captured: len(s.entries), Unmatched: append([]string{}, s.unmatched...), Unused: []string{}}
+	for index, entry := range s.entries {
+		if s.used[index] {
+			summary.Replayed++
+		} else {
+			summary.Unused = append(summary.Unused, entry.Request.Method+" "+entry.Request.URL)
+		}
+	}
+	return summary
+}
+
+// next claims the first unused entry matching the request.
+func (s *Server) next(request *http.Request) (*tasks.HAREntry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	remaining := 0
+	for index, entry := range s.entries {
+		if s.used[index] {
+			continue
+		}
+		remaining++
+		target, err := url.Parse(entry.Request.URL)
+		if err != nil || entry.Request.Method != request.Method || target.Path != request.URL.Path {
+			continue
+		}
+		s.used[index] = true
+		return &s.entries[index], true
+	}
+
+	s.unmatched = append(s.unmatched, request.Method+" "+request.URL.Path)
+	if remaining == 0 {
+		s.once.Do(func() { close(s.exhausted) })
+	}
+	return nil, false
+}
+
+// ServeHTTP replays one captured response.
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	entry, ok := s.next(request)
+	if !ok {
+		http.Error(writer, fmt.Sprintf("no captured response for %s %s", request.Method, request.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	// Exchanges that failed in the capture fail the same way here.
+	if entry.Error != "" {
+		if hijacker, ok := writer.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		http.Error(writer, entry.Error, http.StatusBadGateway)
+		return
+	}
+
+	for _, header := range entry.Response.Headers {
+		switch strings.ToLower(header.Name) {
+		case "content-length", "content-encoding", "transfer-encoding", "set-cookie":
+			continue
+		}
+		writer.Header().Add(header.Name, header.Value)
+	}
+	writer.WriteHeader(entry.Response.Status)
+	writer.Write([]byte(entry.Response.Content.Text))
+}
@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CredentialStore hands out the credentials of named accounts. Tasks that
+// reference an account look its credentials up each time they sign in, so a
+// rotated password reaches every task that uses the account.
+type CredentialStore interface {
+	Credentials(id string) (username, password string, err error)
+}
+
+// AccountFinder is a CredentialStore that can find the account holding a
+// username and password, so the engine need not store them a second time.
+type AccountFinder interface {
+	AccountFor(username, password string) (id string, exists bool)
+}
+
+// credentials returns the username and password the task signs in with.
+func (t *Task) credentials() (string, string, error) {
+	if t.Account == "" {
+		return t.Username, t.Password, nil
+	}
+	if t.accounts == nil {
+		t.SetStatus("Credential Vault Unavailable")
+		return "", "", errors.New("Credential Vault Unavailable")
+	}
+	username, password, err := t.accounts.Credentials(t.Account)
+	if err != nil {
+		t.SetStatus("Account Unavailable")
+		return "", "", fmt.Errorf("account %q: %w", t.Account, err)
+	}
+	return username, password, nil
+}
+
+// checkAccount makes sure the account a task references exists. Callers
+// hold the mutex.
+func (tm *TaskManager) checkAccount(task *Task) error {
+	if task.Account == "" {
+		return nil
+	}
+	if tm.Accounts == nil {
+		return &ValidationError{"account", "no credential vault is configured"}
+	}
+	if _, _, err := tm.Accounts.Credentials(task.Account); err != nil {
+		return &ValidationError{"account", fmt.Sprintf("unknown account %q", task.Account)}
+	}
+	return nil
+}
+
+// DeleteAccount deletes an account with remove unless tasks sign in with
+// it, in which case it returns their IDs and leaves the account alone. No
+// task can take up the account between the check and the delete.
+func (tm *TaskManager) DeleteAccount(account string, remove func(id string) error) ([]string, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if users := tm.tasksUsingAccount(account); len(users) > 0 {
+		return users, nil
+	}
+	return nil, remove(account)
+}
+
+// tasksUsingAccount returns the IDs of the tasks that sign in with an
+// account, in order. Callers hold the mutex.
+func (tm *TaskManager) tasksUsingAccount(account string) []string {
+	var ids []string
+	for id, task := range tm.Tasks {
+		if task.Account == account {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
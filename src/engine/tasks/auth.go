@@ -0,0 +1,308 @@
+package tasks
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"goquery"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// AuthSession is what signing in produces: the cookies that carry the Banner
+// session and the unique session ID Banner expects on registration requests.
+// Registration and watch code rely on nothing else.
+type AuthSession struct {
+	Jar             http.CookieJar
+	UniqueSessionId string
+}
+
+// Authenticator signs a task in to Banner Student Registration with the
+// task's credentials. Implementations may use the task's client and steps,
+// and report login failures through its status.
+type Authenticator interface {
+	Authenticate(t *Task) (*AuthSession, error)
+}
+
+var (
+	authenticators = map[string]Authenticator{
+		SSOShibbolethWSO2: shibbolethWSO2Authenticator{},
+		SSOShibboleth:     shibbolethAuthenticator{},
+		SSOCAS:            casAuthenticator{},
+		SSOBanner:         bannerAuthenticator{},
+	}
+	authenticatorsMutex sync.RWMutex
+)
+
+// RegisterAuthenticator makes an SSO provider type available to institution
+// profiles, replacing any authenticator registered for it.
+func RegisterAuthenticator(provider string, authenticator Authenticator) {
+	authenticatorsMutex.Lock()
+	defer authenticatorsMutex.Unlock()
+	authenticators[provider] = authenticator
+}
+
+// lookupAuthenticator returns the authenticator for an SSO provider type.
+func lookupAuthenticator(provider string) (Authenticator, bool) {
+	authenticatorsMutex.RLock()
+	defer authenticatorsMutex.RUnlock()
+	authenticator, exists := authenticators[provider]
+	return authenticator, exists
+}
+
+// SSOProviders lists the SSO provider types institutions can use.
+func SSOProviders() []string {
+	authenticatorsMutex.RLock()
+	defer authenticatorsMutex.RUnlock()
+	providers := make([]string, 0, len(authenticators))
+	for provider := range authenticators {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// newAuthSession hands out the client's cookies under a fresh unique session
+// ID once an authenticator has signed in.
+func (t *Task) newAuthSession() *AuthSession {
+	t.GenSessionId()
+	return &AuthSession{Jar: t.Client.GetCookieJar(), UniqueSessionId: t.Session.UniqueSessionId}
+}
+
+// useAuthSession makes the task's requests carry a signed-in session and keeps
+// them on the proxy the session was issued to.
+func (t *Task) useAuthSession(session *AuthSession) {
+	if session.Jar != nil {
+		t.Client.SetCookieJar(session.Jar)
+	}
+	t.Session.UniqueSessionId = session.UniqueSessionId
+	t.pinProxy()
+}
+
+// shibbolethWSO2Authenticator is the FHDA chain: the Shibboleth IdP answers
+// the portal's SSO manager through WSO2 commonauth, and WSO2 samlsso then
+// answers Banner's service provider.
+type shibbolethWSO2Authenticator struct{}
+
+func (shibbolethWSO2Authenticator) Authenticate(t *Task) (*AuthSession, error) {
+	t.Session.LoginURL = ""
+	steps := []func() error{
+		t.VisitHomepage,
+		t.Login,
+		t.SubmitCommonAuth,
+		t.SubmitSSOManager,
+		t.RegisterPostSignIn,
+		t.SubmitSamIsso,
+		t.SubmitSSBSp,
+	}
+	if err := t.runSteps(steps); err != nil {
+		return nil, err
+	}
+	return t.newAuthSession(), nil
+}
+
+// shibbolethAuthenticator signs in through a Shibboleth IdP that Banner's
+// service provider trusts directly.
+type shibbolethAuthenticator struct{}
+
+func (shibbolethAuthenticator) Authenticate(t *Task) (*AuthSession, error) {
+	t.Session.LoginURL = ""
+	steps := []func() error{
+		t.StartSAMLLogin,
+		t.Login,
+		t.SubmitSSBSp,
+	}
+	if err := t.runSteps(steps); err != nil {
+		return nil, err
+	}
+	return t.newAuthSession(), nil
+}
+
+// casAuthenticator signs in through a CAS server that hands Banner a service
+// ticket.
+type casAuthenticator struct{}
+
+func (casAuthenticator) Authenticate(t *Task) (*AuthSession, error) {
+	if err := t.runSteps([]func() error{t.CASLogin}); err != nil {
+		return nil, err
+	}
+	return t.newAuthSession(), nil
+}
+
+// bannerAuthenticator signs in with Banner's own login page, for schools that
+// do not put Student Registration behind SSO.
+type bannerAuthenticator struct{}
+
+func (bannerAuthenticator) Authenticate(t *Task) (*AuthSession, error) {
+	if err := t.runSteps([]func() error{t.BannerLogin}); err != nil {
+		return nil, err
+	}
+	return t.newAuthSession(), nil
+}
+
+// StartSAMLLogin asks Banner's service provider for a SAML request, hands it
+// to the IdP and remembers where the IdP's login form posts.
+func (t *Task) StartSAMLLogin() error {
+	t.beginStep("Starting SAML Login")
+	headers := t.headers(acceptHTML, "")
+
+	loginURL := t.institution().bannerURL("/saml/login")
+	request, err := t.fetchForm("GET", loginURL, headers, nil, "form:has(input[name='SAMLRequest'])")
+	if err != nil {
+		return err
+	}
+
+	headers = append(headers, [2]string{"content-type", contentForm})
+	login, err := t.fetchForm("POST", request.Action, headers, []byte(request.Values.Encode()), "form:has(input[type='password'])")
+	if err != nil {
+		return err
+	}
+	t.Session.LoginURL = login.Action
+	return nil
+}
+
+// CASLogin posts the credentials to the CAS login form and follows the
+// service ticket back to Banner.
+func (t *Task) CASLogin() error {
+	t.beginStep("Logging In")
+	headers := t.headers(acceptHTML, "")
+
+	institution := t.institution()
+	service := institution.bannerURL("/ssb/registration/registerPostSignIn?mode=registration")
+	loginURL := institution.idpURL(institution.loginPath("/cas/login") + "?" + url.Values{"service": {service}}.Encode())
+	form, err := t.fetchForm("GET", loginURL, headers, nil, "form:has(input[type='password'])")
+	if err != nil {
+		return err
+	}
+	if form.Values.Get("_eventId") == "" {
+		form.Values.Set("_eventId", "submit")
+	}
+	return t.submitCredentials(form, headers)
+}
+
+// BannerLogin posts the credentials to Banner's own login form.
+func (t *Task) BannerLogin() error {
+	t.beginStep("Logging In")
+	headers := t.headers(acceptHTML, "")
+
+	institution := t.institution()
+	form, err := t.fetchForm("GET", institution.bannerURL(institution.loginPath("/login/auth")), headers, nil, "form:has(input[type='password'])")
+	if err != nil {
+		return err
+	}
+	return t.submitCredentials(form, headers)
+}
+
+// submitCredentials fills a login form with the task's credentials and posts
+// it. Landing on another login form means the credentials were refused.
+func (t *Task) submitCredentials(form *htmlForm, headers [][2]string) error {
+	if form.UsernameField == "" || form.PasswordField == "" {
+		return errors.New("Login form has no username or password field")
+	}
+	username, password, err := t.credentials()
+	if err != nil {
+		return err
+	}
+	form.Values.Set(form.UsernameField, username)
+	form.Values.Set(form.PasswordField, password)
+
+	headers = append(headers, [2]string{"content-type", contentForm})
+	response, err := t.DoReq(t.MakeReq("POST", form.Action, headers, []byte(form.Values.Encode())))
+	if err != nil {
+		discardResp(response)
+		return err
+	}
+
+	body, _ := readBody(response)
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	if document, err = t.completeMFA(document, form.Action); err != nil {
+		return err
+	}
+	if document.Find("form input[type='password']").Length() == 0 {
+		return nil
+	}
+
+	message := strings.TrimSpace(document.Find("#msg, .errors, .error, .alert-danger, #login_error").First().Text())
+	if message == "" || strings.Contains(strings.ToLower(message), "invalid") {
+		message = "Invalid Credentials"
+	}
+	t.SetStatus(message)
+	return errors.New(message)
+}
+
+// htmlForm is a form scraped from a page, ready to be filled in and posted.
+type htmlForm struct {
+	Action        string
+	Values        url.Values
+	UsernameField string
+	PasswordField string
+}
+
+// fetchForm sends a request and parses the first form in the response that
+// matches selector.
+func (t *Task) fetchForm(method, target string, headers [][2]string, body []byte, selector string) (*htmlForm, error) {
+	response, err := t.DoReq(t.MakeReq(method, target, headers, body))
+	if err != nil {
+		discardResp(response)
+		return nil, err
+	}
+
+	data, _ := readBody(response)
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return parseForm(document, selector, target)
+}
+
+// parseForm reads the first form matching selector.
+func parseForm(document *goquery.Document, selector, base string) (*htmlForm, error) {
+	selection := document.Find(selector).First()
+	if selection.Length() == 0 {
+		return nil, errors.New("Page did not contain the expected form")
+	}
+	return readForm(selection, base)
+}
+
+// readForm reads a form element. Hidden and pre-filled inputs are kept,
+// buttons are left out, and the action is resolved against the URL the page
+// was requested from.
+func readForm(selection *goquery.Selection, base string) (*htmlForm, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	action, err := baseURL.Parse(selection.AttrOr("action", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	form := &htmlForm{Action: action.String(), Values: url.Values{}}
+	selection.Find("input").Each(func(index int, input *goquery.Selection) {
+		name := input.AttrOr("name", "")
+		if name == "" {
+			return
+		}
+		switch strings.ToLower(input.AttrOr("type", "text")) {
+		case "password":
+			if form.PasswordField == "" {
+				form.PasswordField = name
+			}
+		case "text", "email":
+			if form.UsernameField == "" {
+				form.UsernameField = name
+			}
+			form.Values.Set(name, input.AttrOr("value", ""))
+		case "submit", "button", "image", "reset", "checkbox", "radio":
+		default:
+			form.Values.Set(name, input.AttrOr("value", ""))
+		}
+	})
+	return form, nil
+}
@@ -0,0 +1,238 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Task phases recorded in checkpoints.
+const (
+	PhaseWatching    = "watching"
+	PhaseLogin       = "login"
+	PhaseEligibility = "eligibility"
+	PhaseWaiting     = "waiting"
+	PhaseAdding      = "adding"
+	PhaseSubmitting  = "submitting"
+	PhaseDone        = "done"
+)
+
+var ErrShuttingDown = errors.New("engine is shutting down")
+
+// checkpointRecord is a task that was running when the checkpoint was
+// written, with how far it got. It signs in with a vault account, if at all,
+// so the file never holds a password.
+type checkpointRecord struct {
+	Task      *TaskInput `json:"task"`
+	Phase     string     `json:"phase,omitempty"`
+	WaitUntil *time.Time `json:"wait_until,omitempty"`
+	Resume    bool       `json:"resume"`
+}
+
+// setPhase records the task's progress and checkpoints it when it changes.
+func (t *Task) setPhase(phase string) {
+	t.state.Lock()
+	changed := t.Phase != phase
+	t.Phase = phase
+	t.state.Unlock()
+	if changed && t.checkpoint != nil {
+		t.checkpoint()
+	}
+}
+
+// phase returns the step of its run the task last reached.
+func (t *Task) phase() string {
+	t.state.Lock()
+	defer t.state.Unlock()
+	return t.Phase
+}
+
+// setWaitUntil records when the task's registration window opens while it
+// waits for it.
+func (t *Task) setWaitUntil(at *time.Time) {
+	t.state.Lock()
+	t.WaitUntil = at
+	t.state.Unlock()
+}
+
+// inPhase wraps a step so the task enters phase before running it.
+func (t *Task) inPhase(phase string, step func() error) func() error {
+	return func() error {
+		t.setPhase(phase)
+		return step()
+	}
+}
+
+// EnableCheckpoints makes the TaskManager save resumable task state to path
+// whenever it changes. The file names vault accounts and the tasks' CRNs, so
+// it is private to the current user.
+func (tm *TaskManager) EnableCheckpoints(path string) {
+	tm.mutex.Lock()
+	tm.checkpointPath = path
+	tm.checkpointRequests = make(chan struct{}, 1)
+	for _, task := range tm.Tasks {
+		task.checkpoint = tm.requestCheckpoint
+	}
+	tm.mutex.Unlock()
+
+	go func() {
+		for range tm.checkpointRequests {
+			if err := tm.WriteCheckpoint(); err != nil {
+				slog.Error("writing checkpoint", "path", path, "error", err)
+			}
+		}
+	}()
+}
+
+// requestCheckpoint schedules a checkpoint write without blocking. Requests
+// made while a write is pending are coalesced.
+func (tm *TaskManager) requestCheckpoint() {
+	if tm.checkpointRequests == nil {
+		return
+	}
+	select {
+	case tm.checkpointRequests <- struct{}{}:
+	default:
+	}
+}
+
+// WriteCheckpoint saves the running tasks to the checkpoint file
+// atomically. A task that signs in with a password the vault does not hold
+// is left out rather than writing the password to disk, so it does not
+// resume after a restart.
+func (tm *TaskManager) WriteCheckpoint() error {
+	tm.mutex.Lock()
+	path := tm.checkpointPath
+	records := make([]checkpointRecord, 0, len(tm.Tasks))
+	finder, _ := tm.Accounts.(AccountFinder)
+	for _, task := range tm.Tasks {
+		task.state.Lock()
+		phase, waitUntil := task.Phase, task.WaitUntil
+		task.state.Unlock()
+		if !task.running || phase == PhaseDone {
+			continue
+		}
+		input := task.input()
+		input.Username, input.Password = "", ""
+		if task.Account == "" && task.Password != "" {
+			id, exists := "", false
+			if finder != nil {
+				id, exists = finder.AccountFor(task.Username, task.Password)
+			}
+			if !exists {
+				slog.Warn("not checkpointing task: its credentials are not in the vault", "task_id", task.ID)
+				continue
+			}
+			input.Account = id
+		}
+		records = append(records, checkpointRecord{Task: input, Phase: phase, WaitUntil: waitUntil, Resume: true})
+	}
+	tm.mutex.Unlock()
+
+	if path == "" {
+		return nil
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Task.ID < records[j].Task.ID })
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(0o600); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// LoadCheckpoint starts the tasks saved at path again and returns how many
+// were restored. They keep their last phase until the run moves on; a Signup
+// task that was waiting for its registration window waits for it again
+// before signing in. Records that are no longer valid, such as tasks of a
+// deleted vault account, are logged and skipped. A missing file is not an
+// error.
+func (tm *TaskManager) LoadCheckpoint(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var records []checkpointRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	restored := 0
+	for _, record := range records {
+		if record.Task == nil || !record.Resume {
+			continue
+		}
+		task := NewTask(record.Task)
+		task.Phase, task.WaitUntil, task.resuming = record.Phase, record.WaitUntil, true
+		if err := tm.CreateTask(task); err != nil {
+			slog.Warn("skipping checkpointed task", "task_id", task.ID, "error", err)
+			continue
+		}
+		restored++
+		slog.Info("resuming task", "task_id", task.ID, "phase", task.Phase)
+		tm.RunTask(task.ID)
+	}
+	return restored, nil
+}
+
+// Shutdown stops accepting new runs, asks every running task to stop at its
+// next checkpoint and waits for them until ctx expires. In-flight requests
+// such as a batch submission are not interrupted. Tasks that were running are
+// checkpointed so they resume on the next start.
+func (tm *TaskManager) Shutdown(ctx context.Context) error {
+	tm.mutex.Lock()
+	tm.shuttingDown = true
+	for _, task := range tm.Tasks {
+		if task.startTimer != nil {
+			task.startTimer.Stop()
+		}
+		if task.cancel != nil {
+			task.cancel()
+		}
+	}
+	tm.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		tm.running.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("tasks still running at shutdown deadline: %w", ctx.Err())
+	}
+
+	if writeErr := tm.WriteCheckpoint(); writeErr != nil && err == nil {
+		err = writeErr
+	}
+	return err
+}
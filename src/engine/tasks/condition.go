@@ -0,0 +1,301 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxConditionLength caps the length of a seat condition.
+const MaxConditionLength = 256
+
+// conditionVariables are the names a seat condition can use, read from the
+// section's seat counts.
+var conditionVariables = map[string]func(e *Enrollment) int{
+	"seats":              func(e *Enrollment) int { return e.SeatsAvailable },
+	"seats_available":    func(e *Enrollment) int { return e.SeatsAvailable },
+	"waitlist_capacity":  func(e *Enrollment) int { return e.WaitCapacity },
+	"waitlist_actual":    func(e *Enrollment) int { return e.WaitCount },
+	"waitlist_available": func(e *Enrollment) int { return e.WaitAvailable },
+	// waitlist_position is the spot a signup would take on the waitlist.
+	"waitlist_position": func(e *Enrollment) int { return e.WaitCount + 1 },
+}
+
+// ConditionVariables lists the names a seat condition can use.
+func ConditionVariables() []string {
+	names := make([]string, 0, len(conditionVariables))
+	for name := range conditionVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Condition is a parsed seat condition such as
+// "waitlist_available > 0 and waitlist_actual < 5". Conditions compare the
+// seat counts with whole numbers and combine the comparisons with and, or,
+// not and parentheses; a bare count holds when it is above zero. They cannot
+// call anything or loop, so evaluating one is always cheap and safe.
+type Condition struct {
+	source string
+	root   conditionNode
+}
+
+// conditionNode is a node of a parsed condition. Comparisons and logic
+// evaluate to 1 or 0.
+type conditionNode interface {
+	eval(e *Enrollment) int
+}
+
+type (
+	conditionNumber   int
+	conditionVariable func(e *Enrollment) int
+	conditionNot      struct{ operand conditionNode }
+	conditionBinary   struct {
+		op          string
+		left, right conditionNode
+	}
+)
+
+func (n conditionNumber) eval(*Enrollment) int     { return int(n) }
+func (n conditionVariable) eval(e *Enrollment) int { return n(e) }
+func (n conditionNot) eval(e *Enrollment) int      { return truth(n.operand.eval(e) <= 0) }
+
+func (n conditionBinary) eval(e *Enrollment) int {
+	switch n.op {
+	case "and":
+		return truth(n.left.eval(e) > 0 && n.right.eval(e) > 0)
+	case "or":
+		return truth(n.left.eval(e) > 0 || n.right.eval(e) > 0)
+	}
+	left, right := n.left.eval(e), n.right.eval(e)
+	switch n.op {
+	case "<":
+		return truth(left < right)
+	case "<=":
+		return truth(left <= right)
+	case ">":
+		return truth(left > right)
+	case ">=":
+		return truth(left >= right)
+	case "==":
+		return truth(left == right)
+	}
+	return truth(left != right)
+}
+
+func truth(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ParseCondition parses a seat condition, reporting where it went wrong.
+func ParseCondition(source string) (*Condition, error) {
+	if len(source) > MaxConditionLength {
+		return nil, fmt.Errorf("must be at most %d characters", MaxConditionLength)
+	}
+	tokens, err := tokenizeCondition(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{tokens: tokens}
+	root, numeric, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.text != "" {
+		return nil, token.errorf("unexpected %q", token.text)
+	}
+	if numeric {
+		// A bare count holds when it is above zero.
+		root = conditionBinary{">", root, conditionNumber(0)}
+	}
+	return &Condition{source: source, root: root}, nil
+}
+
+// Match reports whether the seat counts satisfy the condition.
+func (c *Condition) Match(e *Enrollment) bool {
+	return c.root.eval(e) > 0
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+// conditionToken is a word, number or operator of a condition; the empty
+// text marks the end.
+type conditionToken struct {
+	text string
+	pos  int
+}
+
+func (t conditionToken) errorf(format string, args ...any) error {
+	if t.text == "" {
+		return fmt.Errorf("unexpected end of condition")
+	}
+	return fmt.Errorf("at %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+// conditionOperators are the symbols of the language, longest first.
+var conditionOperators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "!", "(", ")"}
+
+// tokenizeCondition splits a condition into tokens, spelling && || and ! as
+// and, or and not.
+func tokenizeCondition(source string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, conditionToken{strings.ToLower(source[start:i]), start})
+			continue
+		}
+		matched := false
+		for _, operator := range conditionOperators {
+			if strings.HasPrefix(source[i:], operator) {
+				text := map[string]string{"&&": "and", "||": "or", "!": "not"}[operator]
+				if text == "" {
+					text = operator
+				}
+				tokens = append(tokens, conditionToken{text, i})
+				i += len(operator)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("at %d: unexpected %q", i+1, source[i:i+1])
+		}
+	}
+	return tokens, nil
+}
+
+// conditionParser is a recursive descent parser over:
+//
+//	or         = and { "or" and }
+//	and        = not { "and" not }
+//	not        = "not" not | comparison
+//	comparison = operand [ ("<" | "<=" | ">" | ">=" | "==" | "!=") operand ]
+//	operand    = number | variable | "(" or ")"
+//
+// Each rule also returns whether its result is a count rather than a truth.
+type conditionParser struct {
+	tokens []conditionToken
+	next   int
+}
+
+func (p *conditionParser) peek() conditionToken {
+	if p.next < len(p.tokens) {
+		return p.tokens[p.next]
+	}
+	return conditionToken{pos: -1}
+}
+
+func (p *conditionParser) take() conditionToken {
+	token := p.peek()
+	if p.next < len(p.tokens) {
+		p.next++
+	}
+	return token
+}
+
+func (p *conditionParser) or() (conditionNode, bool, error) {
+	return p.logical("or", p.and)
+}
+
+func (p *conditionParser) and() (conditionNode, bool, error) {
+	return p.logical("and", p.not)
+}
+
+// logical parses operands joined by op.
+func (p *conditionParser) logical(op string, operand func() (conditionNode, bool, error)) (conditionNode, bool, error) {
+	left, numeric, err := operand()
+	if err != nil {
+		return nil, false, err
+	}
+	for p.peek().text == op {
+		p.take()
+		right, _, err := operand()
+		if err != nil {
+			return nil, false, err
+		}
+		left, numeric = conditionBinary{op, left, right}, false
+	}
+	return left, numeric, nil
+}
+
+func (p *conditionParser) not() (conditionNode, bool, error) {
+	if p.peek().text != "not" {
+		return p.comparison()
+	}
+	p.take()
+	operand, _, err := p.not()
+	if err != nil {
+		return nil, false, err
+	}
+	return conditionNot{operand}, false, nil
+}
+
+func (p *conditionParser) comparison() (conditionNode, bool, error) {
+	left, numeric, err := p.operand()
+	if err != nil {
+		return nil, false, err
+	}
+	op := p.peek()
+	switch op.text {
+	case "<", "<=", ">", ">=", "==", "!=":
+	default:
+		return left, numeric, nil
+	}
+	if !numeric {
+		return nil, false, op.errorf("%q compares counts, not conditions", op.text)
+	}
+	p.take()
+	right, numeric, err := p.operand()
+	if err != nil {
+		return nil, false, err
+	}
+	if !numeric {
+		return nil, false, op.errorf("%q compares counts, not conditions", op.text)
+	}
+	return conditionBinary{op.text, left, right}, false, nil
+}
+
+func (p *conditionParser) operand() (conditionNode, bool, error) {
+	token := p.take()
+	switch {
+	case token.text == "(":
+		node, numeric, err := p.or()
+		if err != nil {
+			return nil, false, err
+		}
+		if closing := p.take(); closing.text != ")" {
+			return nil, false, closing.errorf("expected \")\", got %q", closing.text)
+		}
+		return node, numeric, nil
+	case token.text != "" && unicode.IsDigit(rune(token.text[0])):
+		number, err := strconv.Atoi(token.text)
+		if err != nil || number > 1_000_000 {
+			return nil, false, token.errorf("%q is not a count", token.text)
+		}
+		return conditionNumber(number), true, nil
+	}
+	if variable, exists := conditionVariables[token.text]; exists {
+		return conditionVariable(variable), true, nil
+	}
+	if token.text == "" {
+		return nil, false, token.errorf("")
+	}
+	return nil, false, token.errorf("unknown name %q; use one of %s", token.text, strings.Join(ConditionVariables(), ", "))
+}
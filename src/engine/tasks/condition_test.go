@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	// Two open seats, a full waitlist of 10.
+	full := &Enrollment{SeatsAvailable: 2, WaitCapacity: 10, WaitCount: 10, WaitAvailable: 0}
+	// No seats, 3 of 10 on the waitlist.
+	waitlisted := &Enrollment{SeatsAvailable: 0, WaitCapacity: 10, WaitCount: 3, WaitAvailable: 7}
+
+	tests := []struct {
+		source           string
+		full, waitlisted bool
+	}{
+		{"seats", true, false},
+		{"seats_available >= 2", true, false},
+		{"waitlist_available", false, true},
+		{"waitlist_available > 0 and waitlist_actual < 5", false, true},
+		{"waitlist_available > 0 && waitlist_actual < 5", false, true},
+		{"seats > 0 or waitlist_position <= 4", true, true},
+		{"seats > 0 || waitlist_position <= 4", true, true},
+		{"not seats", false, true},
+		{"!(seats > 0)", false, true},
+		{"not (seats > 0 or waitlist_available > 0)", false, false},
+		{"waitlist_capacity == 10 and waitlist_actual != 10", false, true},
+		{"(seats)", true, false},
+		{"SEATS > 1", true, false},
+		{"3 < waitlist_position", true, true},
+	}
+	for _, tc := range tests {
+		condition, err := ParseCondition(tc.source)
+		if err != nil {
+			t.Errorf("ParseCondition(%q): %v", tc.source, err)
+			continue
+		}
+		if got := condition.Match(full); got != tc.full {
+			t.Errorf("%q on a full waitlist = %v, want %v", tc.source, got, tc.full)
+		}
+		if got := condition.Match(waitlisted); got != tc.waitlisted {
+			t.Errorf("%q on an open waitlist = %v, want %v", tc.source, got, tc.waitlisted)
+		}
+		if condition.String() != tc.source {
+			t.Errorf("String() = %q, want %q", condition.String(), tc.source)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		source, want string
+	}{
+		{"", "unexpected end of condition"},
+		{"seats >", "unexpected end of condition"},
+		{"(seats > 0", "unexpected end of condition"},
+		{"seats > 0)", `at 10: unexpected ")"`},
+		{"seats $ 1", `at 7: unexpected "$"`},
+		{"seats 1", `at 7: unexpected "1"`},
+		{"credits > 0", `at 1: unknown name "credits"; use one of seats`},
+		{"(seats > 0) < 1", `at 13: "<" compares counts, not conditions`},
+		{"seats > (waitlist_actual < 1)", `at 7: ">" compares counts, not conditions`},
+		{"seats > 99999999", `at 9: "99999999" is not a count`},
+		{"seats and", "unexpected end of condition"},
+		{strings.Repeat("seats or ", 40) + "seats", "must be at most 256 characters"},
+	}
+	for _, tc := range tests {
+		_, err := ParseCondition(tc.source)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseCondition(%q) = %v, want an error containing %q", tc.source, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"proj/apitypes"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Reasons a DryRun expects Banner to reject a CRN for, besides the kinds of
+// eligibility failure.
+const (
+	RejectPrerequisite = "prerequisite"
+	RejectCorequisite  = "corequisite"
+	RejectTimeConflict = "time_conflict"
+	RejectHold         = EligibilityHold
+	RejectRestriction  = "level_restriction"
+	RejectClosed       = "closed"
+	RejectDuplicate    = "duplicate"
+	RejectOther        = EligibilityOther
+)
+
+// rejectionReasons classifies addRegistrationItem messages, first match wins.
+var rejectionReasons = []struct {
+	reason  string
+	pattern *regexp.Regexp
+}{
+	{RejectCorequisite, regexp.MustCompile(`(?i)co-?requisite|\bcoreq|link(ed)? (section|course)|linked .*required`)},
+	{RejectPrerequisite, regexp.MustCompile(`(?i)pre-?requisite|\bprereq|test score`)},
+	{RejectTimeConflict, regexp.MustCompile(`(?i)time conflict|conflicts? with`)},
+	{RejectHold, regexp.MustCompile(`(?i)\bholds?\b`)},
+	{RejectRestriction, regexp.MustCompile(`(?i)(level|class|major|program|college|degree|cohort|campus|student attribute) restriction`)},
+	{RejectClosed, regexp.MustCompile(`(?i)closed|(class|section) is full`)},
+	{RejectDuplicate, regexp.MustCompile(`(?i)duplicate|already registered|equivalent course|repeat`)},
+}
+
+// classifyRejection returns why Banner refused to add a CRN.
+func classifyRejection(message string) string {
+	for _, rejection := range rejectionReasons {
+		if rejection.pattern.MatchString(message) {
+			return rejection.reason
+		}
+	}
+	return RejectOther
+}
+
+// CRNReadiness is whether Banner accepted a CRN into the pending
+// registration, and what it said.
+type CRNReadiness = apitypes.CRNReadiness
+
+// DryRunReport is the outcome of a DryRun task.
+type DryRunReport = apitypes.DryRunReport
+
+// DryRun signs in and adds the task's CRNs to the pending registration to
+// see whether Banner would accept them, then removes them instead of
+// submitting. Unlike Signup it does not wait for the registration window.
+func (t *Task) DryRun() error {
+	t.useRegistrationURLs()
+	report := &DryRunReport{Term: t.Term, CRNs: make([]CRNReadiness, 0, len(t.CRNs))}
+
+	steps := []func() error{
+		t.inPhase(PhaseLogin, t.GenSession),
+		t.inPhase(PhaseEligibility, func() error {
+			t.beginStep("Getting Registration Status")
+			eligibility, err := t.FetchEligibility()
+			report.Eligibility = eligibility
+			return err
+		}),
+		t.inPhase(PhaseAdding, t.VisitClassRegistration),
+		func() error {
+			t.beginStep("Adding Course")
+			schedule := t.currentSchedule()
+			for _, crn := range t.CRNs {
+				readiness, err := t.checkCRN(crn, report.Eligibility, schedule.Class(crn))
+				if err != nil {
+					return err
+				}
+				report.CRNs = append(report.CRNs, *readiness)
+			}
+			return nil
+		},
+		func() error {
+			removed, err := t.RemovePendingItems(report.CRNs)
+			report.Removed = removed
+			return err
+		},
+	}
+	if err := t.runSteps(steps); err != nil {
+		return err
+	}
+
+	ready := 0
+	for _, crn := range report.CRNs {
+		if crn.Ready {
+			ready++
+		}
+	}
+	report.Ready = ready == len(report.CRNs)
+	report.CheckedAt = time.Now().UTC()
+	t.state.Lock()
+	t.Readiness = report
+	t.state.Unlock()
+	t.setPhase(PhaseDone)
+
+	status := fmt.Sprintf("%d of %d CRNs ready", ready, len(report.CRNs))
+	if report.Ready {
+		status = "Ready"
+	}
+	t.SetStatus(status)
+	t.sendReadiness(report, status)
+	return nil
+}
+
+// checkCRN adds a CRN to the pending registration and records Banner's
+// answer. An account Banner will not let register at all has every CRN
+// rejected for that reason without trying it, and a CRN already on the
+// account's schedule is a duplicate.
+func (t *Task) checkCRN(crn string, eligibility *Eligibility, class *RegisteredClass) (*CRNReadiness, error) {
+	readiness := &CRNReadiness{CRN: crn}
+	if class != nil && class.Holds() {
+		readiness.Reason, readiness.Message = RejectDuplicate, "Already "+class.Status
+		return readiness, nil
+	}
+	if eligibility != nil && !eligibility.Ready {
+		for _, failure := range eligibility.Failures {
+			if failure.Kind != EligibilityTimeTicket {
+				readiness.Reason, readiness.Message = failure.Kind, failure.Message
+				return readiness, nil
+			}
+		}
+	}
+
+	addCourse, err := t.addRegistrationItem(crn)
+	if err != nil {
+		return nil, err
+	}
+	readiness.Ready, readiness.Message, readiness.Model = addCourse.Success, addCourse.Message, addCourse.Model
+	if !addCourse.Success {
+		readiness.Reason = classifyRejection(addCourse.Message)
+		t.log().Info("course would be rejected", "crn", crn, "reason", readiness.Reason, "message", addCourse.Message)
+		t.SetStatus(fmt.Sprintf("%s: %s", crn, addCourse.Message))
+	} else {
+		t.SetStatus(fmt.Sprintf("%s: Ready", crn))
+	}
+	return readiness, nil
+}
+
+// RemovePendingItems removes the CRNs Banner accepted from the pending
+// registration, by submitting them for removal rather than registration.
+// It reports whether anything was removed.
+func (t *Task) RemovePendingItems(crns []CRNReadiness) (bool, error) {
+	t.beginStep("Removing Pending Items")
+	var pending []map[string]interface{}
+	for _, crn := range crns {
+		if crn.Ready && crn.Model != nil {
+			pending = append(pending, crn.Model)
+		}
+	}
+	if len(pending) == 0 {
+		return false, nil
+	}
+
+	batch := Batch{
+		Create:          []map[string]interface{}{},
+		Update:          []map[string]interface{}{},
+		Destroy:         pending,
+		UniqueSessionId: t.Session.UniqueSessionId,
+	}
+	batchJson, err := json.Marshal(batch)
+	if err != nil {
+		return false, err
+	}
+
+	headers := t.headers(acceptJSON, contentJSON)
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().bannerURL("/ssb/classRegistration/submitRegistration/batch"), headers, batchJson))
+	if err != nil {
+		discardResp(response)
+		return false, err
+	}
+	body, _ := readBody(response)
+	t.log().Debug("remove pending items response", "body", string(body))
+
+	var changes Changes
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return false, err
+	}
+	if !changes.Success {
+		return false, fmt.Errorf("Banner did not remove %d pending item(s)", len(pending))
+	}
+	return true, nil
+}
+
+// sendReadiness sends the report to the task's webhook.
+func (t *Task) sendReadiness(report *DryRunReport, status string) {
+	var lines []string
+	for _, crn := range report.CRNs {
+		line := fmt.Sprintf("%s: ready", crn.CRN)
+		if !crn.Ready {
+			line = fmt.Sprintf("%s: %s (%s)", crn.CRN, crn.Reason, crn.Message)
+		}
+		lines = append(lines, line)
+	}
+	t.sendEmbed(Embed{
+		Title:       fmt.Sprintf("Dry run for %s: %s", t.Term, status),
+		Description: strings.Join(lines, "\n"),
+	})
+}
@@ -0,0 +1,1163 @@
+package tasks_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"proj/mockbanner"
+	"proj/tasks"
+	"proj/vault"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startMock serves scenario and returns a TaskManager pointed at it.
+func startMock(t *testing.T, scenario mockbanner.Scenario) (*mockbanner.Server, *tasks.TaskManager) {
+	t.Helper()
+	mock := mockbanner.New(scenario)
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	taskManager := tasks.NewTaskManager()
+	taskManager.HostOverrides = mockbanner.HostOverrides(server.URL)
+	taskManager.CaptureDir = t.TempDir()
+	t.Cleanup(func() { taskManager.DeleteTask("e2e") })
+	return mock, taskManager
+}
+
+// newTask returns a task signed in with the mock's default credentials.
+func newTask(mode, crns string) *tasks.Task {
+	return &tasks.Task{
+		ID:       "e2e",
+		Mode:     mode,
+		Term:     "202442",
+		Crns:     crns,
+		Username: mockbanner.DefaultUsername,
+		Password: mockbanner.DefaultPassword,
+	}
+}
+
+// waitForEvent runs the task and returns the first event of the task that
+// matches, failing the test after timeout.
+func waitForEvent(t *testing.T, taskManager *tasks.TaskManager, task *tasks.Task, timeout time.Duration, match func(tasks.Event) bool) tasks.Event {
+	t.Helper()
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+
+	if err := taskManager.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if !taskManager.RunTask(task.ID) {
+		t.Fatalf("RunTask(%q) = false", task.ID)
+	}
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case event := <-events:
+			if event.TaskID == task.ID && match(event) {
+				return event
+			}
+		case <-deadline:
+			t.Fatalf("timed out; last status %q", taskManager.GetTaskStatus(task.ID))
+		}
+	}
+}
+
+// runToCompletion runs the task and returns its final status.
+func runToCompletion(t *testing.T, taskManager *tasks.TaskManager, task *tasks.Task) string {
+	t.Helper()
+	finished := waitForEvent(t, taskManager, task, 30*time.Second, func(event tasks.Event) bool {
+		return event.Type == tasks.EventTaskFinished
+	})
+	return finished.Status
+}
+
+func TestSignupScenarios(t *testing.T) {
+	cases := []struct {
+		scenario string
+		want     string
+	}{
+		{"open", "Registered"},
+		{"wrong-password", "Invalid Password"},
+		{"full-class", "Closed Section"},
+		{"waitlist", "Waitlisted"},
+		{"hold", "You have a Registration Hold on your account. Please contact the Admissions and Records office."},
+	}
+	for _, tc := range cases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			_, taskManager := startMock(t, mockbanner.Scenarios[tc.scenario]())
+			if got := runToCompletion(t, taskManager, newTask("Signup", "12345")); got != tc.want {
+				t.Errorf("final status = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSignupReportsEachCRN(t *testing.T) {
+	scenario := mockbanner.Scenarios["open"]()
+	scenario.SubmitErrors = map[string][]string{"23456": {"Corequisite MATH 1AL required", "Time conflict with CRN 12345"}}
+	_, taskManager := startMock(t, scenario)
+
+	task := newTask("Signup", "12345,23456")
+	want := "12345: Registered, 23456: Corequisite MATH 1AL required; Time conflict with CRN 12345"
+	if got := runToCompletion(t, taskManager, task); got != want {
+		t.Fatalf("final status = %q, want %q", got, want)
+	}
+	if len(task.Results) != 2 {
+		t.Fatalf("results = %+v, want one per CRN", task.Results)
+	}
+	today := time.Now().Format("01/02/2006")
+	if result := task.Results[0]; result.CRN != "12345" || result.Status != tasks.ResultRegistered || len(result.Errors) != 0 ||
+		result.CreditHours == nil || *result.CreditHours != 4.5 || result.RegistrationStatusDate != today {
+		t.Errorf("CRN 12345 = %+v, want registered for 4.5 hours today", result)
+	}
+	if result := task.Results[1]; result.CRN != "23456" || result.Status != tasks.ResultFailed || len(result.Errors) != 2 {
+		t.Errorf("CRN 23456 = %+v, want failed with both errors", result)
+	}
+}
+
+func TestSignupClearsEarlierResults(t *testing.T) {
+	scenario := mockbanner.Scenarios["open"]()
+	scenario.SubmitErrors = map[string][]string{"23456": {"Corequisite MATH 1AL required"}}
+	mock, taskManager := startMock(t, scenario)
+
+	task := newTask("Signup", "23456")
+	runToCompletion(t, taskManager, task)
+	if len(task.Results) != 1 {
+		t.Fatalf("results = %+v, want one for CRN 23456", task.Results)
+	}
+
+	// A rerun refused before submitting reports the refusal, not the earlier
+	// failure.
+	mock.Update(func(scenario *mockbanner.Scenario) {
+		scenario.AddErrors = map[string]string{"23456": "Closed Section"}
+	})
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+	if err := taskManager.StartTask("e2e"); err != nil {
+		t.Fatalf("StartTask: %v", err)
+	}
+	deadline := time.After(30 * time.Second)
+	for finished := false; !finished; {
+		select {
+		case event := <-events:
+			finished = event.TaskID == "e2e" && event.Type == tasks.EventTaskFinished
+			if finished && event.Status != "Closed Section" {
+				t.Errorf("final status = %q, want Closed Section", event.Status)
+			}
+		case <-deadline:
+			t.Fatalf("rerun did not finish; status %q", taskManager.GetTaskStatus("e2e"))
+		}
+	}
+	if len(task.Results) != 1 || task.Results[0].Status != tasks.ResultFailed || strings.Join(task.Results[0].Errors, "; ") != "Closed Section" {
+		t.Errorf("results = %+v, want CRN 23456 refused as Closed Section", task.Results)
+	}
+}
+
+func TestScheduleSkipsRegisteredCRNs(t *testing.T) {
+	accounts, err := vault.Open(filepath.Join(t.TempDir(), "vault.json"), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := accounts.Add("student", mockbanner.DefaultUsername, mockbanner.DefaultPassword); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	scenario := mockbanner.Scenarios["open"]()
+	scenario.Schedule = map[string]string{"12345": "Registered"}
+	before := scenario.Sections[0].Enrolled
+	mock, taskManager := startMock(t, scenario)
+	taskManager.Accounts = accounts
+
+	schedule, err := taskManager.CheckSchedule(context.Background(), "student", "", "202442")
+	if err != nil {
+		t.Fatalf("CheckSchedule: %v", err)
+	}
+	if len(schedule.Classes) != 1 {
+		t.Fatalf("classes = %+v, want only CRN 12345", schedule.Classes)
+	}
+	class := schedule.Classes[0]
+	if class.CRN != "12345" || class.Status != tasks.ResultRegistered || len(class.Meetings) != 1 {
+		t.Fatalf("class = %+v, want CRN 12345 registered with one meeting", class)
+	}
+	if meeting := class.Meetings[0]; strings.Join(meeting.Days, ",") != "monday,wednesday" || meeting.Start != "09:30" || meeting.End != "10:45" {
+		t.Errorf("meeting = %+v, want Monday and Wednesday 09:30 to 10:45", meeting)
+	}
+
+	const scheduleDetails = "/StudentRegistrationSsb/ssb/classRegistration/getScheduleDetails"
+	detailsBefore := mock.Requests(scheduleDetails)
+	task := newTask("Signup", "12345,23456")
+	if got, want := runToCompletion(t, taskManager, task), "12345: Already registered, 23456: Registered"; got != want {
+		t.Fatalf("final status = %q, want %q", got, want)
+	}
+	// Skipping CRNs needs no meeting times, so Signup never asks for them.
+	if details := mock.Requests(scheduleDetails) - detailsBefore; details != 0 {
+		t.Errorf("Signup read meeting times %d times, want 0", details)
+	}
+	if len(task.Results) != 2 || !task.Results[0].Skipped || task.Results[1].Skipped {
+		t.Errorf("results = %+v, want CRN 12345 skipped and 23456 submitted", task.Results)
+	}
+	var enrolled int
+	mock.Update(func(scenario *mockbanner.Scenario) { enrolled = scenario.Sections[0].Enrolled })
+	if enrolled != before {
+		t.Errorf("CRN 12345 enrolled %d more, want it left alone", enrolled-before)
+	}
+
+	schedule, err = taskManager.CheckSchedule(context.Background(), "student", "", "202442")
+	if err != nil {
+		t.Fatalf("CheckSchedule after signing up: %v", err)
+	}
+	if len(schedule.Classes) != 2 || schedule.Class("23456") == nil {
+		t.Errorf("classes after signing up = %+v, want both CRNs", schedule.Classes)
+	}
+}
+
+func TestSignupWrongUsername(t *testing.T) {
+	_, taskManager := startMock(t, mockbanner.Scenarios["open"]())
+	task := newTask("Signup", "12345")
+	task.Username = "someone-else"
+	if got := runToCompletion(t, taskManager, task); got != "Invalid Username" {
+		t.Errorf("final status = %q, want %q", got, "Invalid Username")
+	}
+}
+
+func TestVaultAccount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	accounts, err := vault.Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := accounts.Add("student", mockbanner.DefaultUsername, "stale-password"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("stale-password")) || bytes.Contains(data, []byte(mockbanner.DefaultUsername)) {
+		t.Error("vault file contains plaintext credentials")
+	}
+	if _, err := vault.Open(path, []byte("wrong horse")); !errors.Is(err, vault.ErrWrongKey) {
+		t.Errorf("Open with the wrong passphrase: err = %v, want %v", err, vault.ErrWrongKey)
+	}
+
+	_, taskManager := startMock(t, mockbanner.Scenarios["open"]())
+	taskManager.Accounts = accounts
+	task := &tasks.Task{ID: "e2e", Mode: "Signup", Term: "202442", Crns: "12345", Account: "student"}
+	if got := runToCompletion(t, taskManager, task); got != "Invalid Password" {
+		t.Fatalf("final status before rotating = %q, want %q", got, "Invalid Password")
+	}
+
+	// Rotating reaches tasks through the vault; the task JSON never changes.
+	taskManager.DeleteTask("e2e")
+	if _, err := accounts.Rotate("student", mockbanner.DefaultPassword); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	reopened, err := vault.Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	taskManager.Accounts = reopened
+	task = &tasks.Task{ID: "e2e", Mode: "Signup", Term: "202442", Crns: "12345", Account: "student"}
+	if got := runToCompletion(t, taskManager, task); got != "Registered" {
+		t.Errorf("final status after rotating = %q, want %q", got, "Registered")
+	}
+
+	missing := &tasks.Task{ID: "e2e-missing", Mode: "Signup", Term: "202442", Crns: "12345", Account: "nobody"}
+	var validationErr *tasks.ValidationError
+	if err := taskManager.CreateTask(missing); !errors.As(err, &validationErr) || validationErr.Field != "account" {
+		t.Errorf("CreateTask with an unknown account: err = %v, want an account validation error", err)
+	}
+
+	// An account a task signs in with stays until the task is gone.
+	if users, err := taskManager.DeleteAccount("student", reopened.Delete); err != nil || len(users) != 1 || users[0] != "e2e" {
+		t.Errorf("DeleteAccount while in use = %v, %v, want task e2e reported", users, err)
+	}
+	taskManager.DeleteTask("e2e")
+	if users, err := taskManager.DeleteAccount("student", reopened.Delete); err != nil || len(users) != 0 {
+		t.Errorf("DeleteAccount = %v, %v, want it deleted", users, err)
+	}
+	if _, err := reopened.Get("student"); !errors.Is(err, vault.ErrAccountNotFound) {
+		t.Errorf("Get after DeleteAccount: err = %v, want %v", err, vault.ErrAccountNotFound)
+	}
+}
+
+func TestAccountEligibility(t *testing.T) {
+	accounts, err := vault.Open(filepath.Join(t.TempDir(), "vault.json"), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := accounts.Add("student", mockbanner.DefaultUsername, mockbanner.DefaultPassword); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	opens := time.Now().Add(72 * time.Hour).Truncate(time.Minute)
+
+	scenario := mockbanner.Scenarios["not-yet-open"]()
+	scenario.RegistrationOpensAt = opens
+	mock, taskManager := startMock(t, scenario)
+	taskManager.Accounts = accounts
+
+	eligibility, err := taskManager.CheckEligibility(context.Background(), "student", "", "202442")
+	if err != nil {
+		t.Fatalf("CheckEligibility: %v", err)
+	}
+	if eligibility.Valid || !eligibility.Ready || len(eligibility.Failures) != 1 || eligibility.Failures[0].Kind != tasks.EligibilityTimeTicket {
+		t.Errorf("eligibility = %+v, want a ready account waiting on its time ticket", eligibility)
+	}
+	if eligibility.RegistrationOpens == nil || !eligibility.RegistrationOpens.Equal(opens) {
+		t.Errorf("registration opens = %v, want %v", eligibility.RegistrationOpens, opens)
+	}
+	if eligibility.RegistrationCloses == nil || !eligibility.RegistrationCloses.After(opens) {
+		t.Errorf("registration closes = %v, want after %v", eligibility.RegistrationCloses, opens)
+	}
+
+	mock.Update(func(scenario *mockbanner.Scenario) {
+		scenario.Holds = mockbanner.Scenarios["hold"]().Holds
+	})
+	eligibility, err = taskManager.CheckEligibility(context.Background(), "student", "", "202442")
+	if err != nil {
+		t.Fatalf("CheckEligibility with a hold: %v", err)
+	}
+	if eligibility.Ready || len(eligibility.Failures) != 2 || eligibility.Failures[0].Kind != tasks.EligibilityHold {
+		t.Errorf("eligibility with a hold = %+v, want a hold that is not ready", eligibility)
+	}
+
+	var validationErr *tasks.ValidationError
+	if _, err := taskManager.CheckEligibility(context.Background(), "student", "", "2024"); !errors.As(err, &validationErr) || validationErr.Field != "term" {
+		t.Errorf("CheckEligibility with a bad term: err = %v, want a term validation error", err)
+	}
+}
+
+func TestTimeTicketSchedule(t *testing.T) {
+	opens := time.Now().Add(72 * time.Hour).Truncate(time.Minute)
+	scenario := mockbanner.Scenarios["not-yet-open"]()
+	scenario.RegistrationOpensAt = opens
+	mock, taskManager := startMock(t, scenario)
+	t.Cleanup(func() { taskManager.DeleteTask("e2e-2") })
+
+	for _, id := range []string{"e2e", "e2e-2"} {
+		task := newTask("Signup", "12345")
+		task.ID = id
+		task.TimeTicket = true
+		if err := taskManager.CreateTask(task); err != nil {
+			t.Fatalf("CreateTask: %v", err)
+		}
+	}
+	taskManager.RefreshTimeTickets(context.Background())
+
+	// Both tasks wait on the same account, which is checked once.
+	if checks := mock.Requests("/StudentRegistrationSsb/ssb/term/search"); checks != 1 {
+		t.Errorf("checked eligibility %d times, want 1", checks)
+	}
+	starts := taskManager.Schedule()
+	if len(starts) != 2 {
+		t.Fatalf("schedule = %+v, want both tasks", starts)
+	}
+	want := opens.Add(-taskManager.TimeTicketLead)
+	for _, start := range starts {
+		if start.Source != tasks.StartFromTimeTicket || start.StartAt == nil || !start.StartAt.Equal(want) || start.Error != "" {
+			t.Errorf("start = %+v, want a time ticket start at %v", start, want)
+		}
+		if start.RegistrationOpens == nil || !start.RegistrationOpens.Equal(opens) {
+			t.Errorf("registration opens = %v, want %v", start.RegistrationOpens, opens)
+		}
+	}
+	calendar := string(tasks.ICalendar(starts))
+	if strings.Count(calendar, "BEGIN:VEVENT") != 2 || !strings.Contains(calendar, "DTSTART:"+want.UTC().Format("20060102T150405Z")) {
+		t.Errorf("calendar = %q, want two events starting at %v", calendar, want)
+	}
+
+	mock.Update(func(scenario *mockbanner.Scenario) {
+		scenario.Holds = mockbanner.Scenarios["hold"]().Holds
+	})
+	taskManager.RefreshTimeTickets(context.Background())
+	if starts := taskManager.Schedule(); len(starts) != 2 || !strings.Contains(starts[0].Error, "Hold") {
+		t.Errorf("schedule with a hold = %+v, want the hold reported", starts)
+	}
+
+	watch := newTask("Watch", "12345")
+	watch.TimeTicket = true
+	var validationErr *tasks.ValidationError
+	if err := watch.Validate(); !errors.As(err, &validationErr) || validationErr.Field != "time_ticket" {
+		t.Errorf("Validate of a time ticket Watch task = %v, want a time_ticket error", err)
+	}
+}
+
+func TestTimeTicketStartsOncePerWindow(t *testing.T) {
+	// A window opening within the lead time starts the task right away.
+	scenario := mockbanner.Scenarios["not-yet-open"]()
+	scenario.RegistrationOpensAt = time.Now().Add(90 * time.Second).Truncate(time.Minute)
+	_, taskManager := startMock(t, scenario)
+
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+	task := newTask("Signup", "12345")
+	task.TimeTicket = true
+	if err := taskManager.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	taskManager.RefreshTimeTickets(context.Background())
+	for event := range events {
+		if event.TaskID == "e2e" && strings.HasPrefix(event.Status, "Waiting til") {
+			break
+		}
+	}
+	taskManager.StopTask("e2e")
+	for event := range events {
+		if event.TaskID == "e2e" && event.Type == tasks.EventTaskFinished {
+			break
+		}
+	}
+
+	// The stopped task stays stopped rather than starting again.
+	taskManager.RefreshTimeTickets(context.Background())
+	unsubscribe()
+	for event := range events {
+		if event.TaskID == "e2e" && event.Type == tasks.EventTaskStatus {
+			t.Errorf("refresh after the task ran set status %q, want it left alone", event.Status)
+		}
+	}
+}
+
+func TestTimeTicketProbeFailsOnMFA(t *testing.T) {
+	_, taskManager := startMock(t, mockbanner.Scenarios["mfa"]())
+	task := newTask("Signup", "12345")
+	task.TimeTicket = true
+	if err := taskManager.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+
+	// Nobody can answer the probe's challenge, so it gives up at once.
+	started := time.Now()
+	taskManager.RefreshTimeTickets(context.Background())
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("refresh took %v, want it to stop at the MFA challenge", elapsed)
+	}
+	if starts := taskManager.Schedule(); len(starts) != 1 || starts[0].Error != "MFA required" {
+		t.Errorf("schedule = %+v, want the MFA challenge reported", starts)
+	}
+}
+
+// startProxy serves an HTTP CONNECT proxy that wants user:pass and counts
+// the tunnels it opens.
+func startProxy(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	tunnels := &atomic.Int32{}
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodConnect {
+			http.Error(writer, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		if request.Header.Get("Proxy-Authorization") != auth {
+			writer.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", request.Host)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := writer.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		tunnels.Add(1)
+		go io.Copy(upstream, conn)
+		go func() {
+			io.Copy(conn, upstream)
+			conn.Close()
+			upstream.Close()
+		}()
+	}))
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "http://", "http://user:pass@", 1), tunnels
+}
+
+func TestProxyPoolRotation(t *testing.T) {
+	proxyURL, tunnels := startProxy(t)
+
+	// A port nothing listens on stands in for a dead proxy.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadURL := "http://user:pass@" + listener.Addr().String()
+	listener.Close()
+
+	pool, err := tasks.NewProxyPool([]string{deadURL, proxyURL}, tasks.ProxySticky)
+	if err != nil {
+		t.Fatalf("NewProxyPool: %v", err)
+	}
+	_, taskManager := startMock(t, mockbanner.Scenarios["open"]())
+	taskManager.Proxies = pool
+
+	task := newTask("Signup", "12345")
+	task.Proxy = tasks.ProxyFromPool
+	if got := runToCompletion(t, taskManager, task); got != "Registered" {
+		t.Fatalf("final status = %q, want %q", got, "Registered")
+	}
+	if tunnels.Load() == 0 {
+		t.Error("no request went through the working proxy")
+	}
+
+	status := pool.Status()
+	if status[0].Failures != 1 || status[0].DownUntil == nil {
+		t.Errorf("dead proxy status = %+v, want one failure and a cooldown", status[0])
+	}
+	if strings.Contains(status[0].URL, "pass") {
+		t.Errorf("status URL %q leaks the proxy password", status[0].URL)
+	}
+	// The account stays on the proxy that worked.
+	if proxy, _ := pool.Acquire("user:" + mockbanner.DefaultUsername); proxy != proxyURL {
+		t.Errorf("sticky proxy = %q, want %q", proxy, proxyURL)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	mock := mockbanner.New(mockbanner.Scenarios["open"]())
+	var mismatched atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !strings.Contains(request.UserAgent(), "Firefox/120.0") || request.Header.Get("sec-ch-ua") != "" {
+			mismatched.Add(1)
+		}
+		mock.ServeHTTP(writer, request)
+	}))
+	t.Cleanup(server.Close)
+
+	taskManager := tasks.NewTaskManager()
+	taskManager.HostOverrides = mockbanner.HostOverrides(server.URL)
+	t.Cleanup(func() { taskManager.DeleteTask("e2e") })
+
+	task := newTask("Signup", "12345")
+	task.Fingerprint = "firefox-121"
+	var validationErr *tasks.ValidationError
+	if err := taskManager.CreateTask(task); !errors.As(err, &validationErr) || validationErr.Field != "fingerprint" {
+		t.Fatalf("CreateTask with an unknown fingerprint = %v, want a fingerprint validation error", err)
+	}
+
+	task.Fingerprint = "firefox-120"
+	if got := runToCompletion(t, taskManager, task); got != "Registered" {
+		t.Fatalf("final status = %q, want %q", got, "Registered")
+	}
+	if n := mismatched.Load(); n > 0 {
+		t.Errorf("%d requests did not send the Firefox headers", n)
+	}
+}
+
+func TestAuthenticators(t *testing.T) {
+	cases := []struct {
+		provider      string
+		wrongPassword string
+	}{
+		{tasks.SSOShibbolethWSO2, "Invalid Password"},
+		{tasks.SSOShibboleth, "Invalid Password"},
+		{tasks.SSOCAS, "Invalid Credentials"},
+		{tasks.SSOBanner, "Invalid Credentials"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.provider, func(t *testing.T) {
+			institution, _ := tasks.LookupInstitution("deanza")
+			profile := *institution
+			profile.ID = "mock-" + tc.provider
+			profile.SSOProvider = tc.provider
+			if err := tasks.RegisterInstitution(&profile); err != nil {
+				t.Fatalf("RegisterInstitution: %v", err)
+			}
+
+			for scenario, want := range map[string]string{"open": "Registered", "wrong-password": tc.wrongPassword} {
+				_, taskManager := startMock(t, mockbanner.Scenarios[scenario]())
+				task := newTask("Signup", "12345")
+				task.Institution = profile.ID
+				if got := runToCompletion(t, taskManager, task); got != want {
+					t.Errorf("%s: final status = %q, want %q", scenario, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMFAChallenge(t *testing.T) {
+	cases := []struct {
+		name    string
+		answers []tasks.MFAResponse
+	}{
+		{"code", []tasks.MFAResponse{{Code: "000000"}, {Code: mockbanner.DefaultMFACode}}},
+		{"push", []tasks.MFAResponse{{Push: true}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, taskManager := startMock(t, mockbanner.Scenarios["mfa"]())
+			events, unsubscribe := taskManager.Events.Subscribe()
+			defer unsubscribe()
+
+			if err := taskManager.SubmitMFA("e2e", tasks.MFAResponse{Code: "123456"}); !errors.Is(err, tasks.ErrTaskNotFound) {
+				t.Errorf("SubmitMFA before create = %v, want ErrTaskNotFound", err)
+			}
+			task := newTask("Signup", "12345")
+			if err := taskManager.CreateTask(task); err != nil {
+				t.Fatalf("CreateTask: %v", err)
+			}
+			if err := taskManager.SubmitMFA("e2e", tasks.MFAResponse{Code: "123456"}); !errors.Is(err, tasks.ErrMFANotPending) {
+				t.Errorf("SubmitMFA before challenge = %v, want ErrMFANotPending", err)
+			}
+			taskManager.RunTask("e2e")
+
+			answers := tc.answers
+			deadline := time.After(30 * time.Second)
+			for {
+				select {
+				case event := <-events:
+					switch event.Type {
+					case tasks.EventMFARequired:
+						if len(answers) == 0 {
+							t.Fatalf("challenged again after the last answer: %+v", event.MFA)
+						}
+						if len(answers) < len(tc.answers) && event.MFA.Message != "Incorrect passcode." {
+							t.Errorf("retry message = %q, want the IdP's rejection", event.MFA.Message)
+						}
+						if err := taskManager.SubmitMFA("e2e", answers[0]); err != nil {
+							t.Fatalf("SubmitMFA: %v", err)
+						}
+						answers = answers[1:]
+					case tasks.EventTaskFinished:
+						if event.Status != "Registered" {
+							t.Errorf("final status = %q, want Registered", event.Status)
+						}
+						if len(answers) != 0 {
+							t.Errorf("%d answers were never asked for", len(answers))
+						}
+						return
+					}
+				case <-deadline:
+					t.Fatal("timed out")
+				}
+			}
+		})
+	}
+}
+
+func TestSignupWaitsForRegistrationWindow(t *testing.T) {
+	_, taskManager := startMock(t, mockbanner.Scenarios["not-yet-open"]())
+	waitForEvent(t, taskManager, newTask("Signup", "12345"), 30*time.Second, func(event tasks.Event) bool {
+		return strings.HasPrefix(event.Status, "Waiting til")
+	})
+
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+	taskManager.StopTask("e2e")
+	for event := range events {
+		if event.TaskID == "e2e" && event.Type == tasks.EventTaskFinished {
+			if event.Status != "Stopped" {
+				t.Errorf("final status = %q, want Stopped", event.Status)
+			}
+			break
+		}
+	}
+
+	// A stopped task keeps its place so it resumes waiting when restarted.
+	task, _ := taskManager.GetTask("e2e")
+	if task.Phase != tasks.PhaseWaiting {
+		t.Errorf("phase = %q, want %q", task.Phase, tasks.PhaseWaiting)
+	}
+	if task.WaitUntil == nil || time.Until(*task.WaitUntil) < 23*time.Hour {
+		t.Errorf("wait_until = %v, want about a day from now", task.WaitUntil)
+	}
+}
+
+func TestSignupStopsOnHoldBeforeRegistrationWindow(t *testing.T) {
+	scenario := mockbanner.Scenarios["not-yet-open"]()
+	scenario.Holds = mockbanner.Scenarios["hold"]().Holds
+	_, taskManager := startMock(t, scenario)
+
+	got := runToCompletion(t, taskManager, newTask("Signup", "12345"))
+	if got != scenario.Holds[0] {
+		t.Errorf("final status = %q, want the hold message", got)
+	}
+}
+
+func TestDryRunReportsReadiness(t *testing.T) {
+	scenario := mockbanner.Scenarios["open"]()
+	scenario.AddErrors = map[string]string{"23456": "Time conflict with CRN 12345"}
+	before := scenario.Sections[0].Enrolled
+	mock, taskManager := startMock(t, scenario)
+
+	task := newTask("DryRun", "12345,23456")
+	if got := runToCompletion(t, taskManager, task); got != "1 of 2 CRNs ready" {
+		t.Fatalf("final status = %q, want 1 of 2 CRNs ready", got)
+	}
+	report := task.Readiness
+	if report == nil || len(report.CRNs) != 2 || !report.Removed || report.Ready {
+		t.Fatalf("report = %+v, want two CRNs with the accepted one removed", report)
+	}
+	if crn := report.CRNs[0]; !crn.Ready || crn.Model["courseReferenceNumber"] != "12345" {
+		t.Errorf("CRN 12345 = %+v, want ready with its model", crn)
+	}
+	if crn := report.CRNs[1]; crn.Ready || crn.Reason != tasks.RejectTimeConflict || crn.Message != "Time conflict with CRN 12345" {
+		t.Errorf("CRN 23456 = %+v, want a time conflict", crn)
+	}
+
+	var enrolled int
+	mock.Update(func(scenario *mockbanner.Scenario) { enrolled = scenario.Sections[0].Enrolled })
+	if pending := mock.Pending(); pending != 0 || enrolled != before {
+		t.Errorf("left %d pending items and %d enrolled, want none pending and nobody registered", pending, enrolled-before)
+	}
+}
+
+func TestWatchSignsUpWhenSeatOpens(t *testing.T) {
+	mock, taskManager := startMock(t, mockbanner.Scenarios["full-class"]())
+	const enrollmentInfo = "/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo"
+
+	// Open a seat once the watch has seen the class full.
+	go func() {
+		for mock.Requests(enrollmentInfo) < 2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mock.Update(func(scenario *mockbanner.Scenario) {
+			scenario.Sections[0].Enrolled--
+			scenario.Sections[0].WaitActual--
+		})
+	}()
+
+	task := newTask("Watch", "12345")
+	task.Polling = &tasks.PollPolicy{Interval: "250ms"}
+	if got := runToCompletion(t, taskManager, task); got != "Registered" {
+		t.Errorf("final status = %q, want Registered", got)
+	}
+	if polls := mock.Requests(enrollmentInfo); polls < 2 {
+		t.Errorf("polled %d times, want at least 2", polls)
+	}
+}
+
+func TestWatchBacksOffAndReportsUnreadablePolls(t *testing.T) {
+	scenario := mockbanner.Scenarios["open"]()
+	scenario.EnrollmentFailures = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}
+	mock, taskManager := startMock(t, scenario)
+	const enrollmentInfo = "/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo"
+
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+
+	task := newTask("Watch", "12345")
+	task.Polling = &tasks.PollPolicy{Interval: "250ms", MaxBackoff: "2s", FastWindow: "0s"}
+	if got := runToCompletion(t, taskManager, task); got != "Registered" {
+		t.Fatalf("final status = %q, want Registered", got)
+	}
+	if polls := mock.Requests(enrollmentInfo); polls != 4 {
+		t.Errorf("polled %d times, want 4", polls)
+	}
+
+	var rateLimited, unreadable bool
+	for len(events) > 0 {
+		event := <-events
+		rateLimited = rateLimited || strings.HasPrefix(event.Status, "Rate limited")
+		unreadable = unreadable || strings.HasPrefix(event.Status, "Enrollment unreadable")
+	}
+	if !rateLimited || !unreadable {
+		t.Errorf("saw rate limited status %v and unreadable status %v, want both", rateLimited, unreadable)
+	}
+
+	task.Polling = &tasks.PollPolicy{Interval: "10ms"}
+	var validationErr *tasks.ValidationError
+	if err := task.Validate(); !errors.As(err, &validationErr) || validationErr.Field != "polling.interval" {
+		t.Errorf("Validate with a 10ms interval = %v, want a polling.interval error", err)
+	}
+}
+
+func TestWatchCondition(t *testing.T) {
+	const enrollmentInfo = "/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo"
+	mock, taskManager := startMock(t, mockbanner.Scenarios["waitlist"]())
+
+	// The waitlist is open from the start, but the task only wants a seat.
+	go func() {
+		for mock.Requests(enrollmentInfo) < 3 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		mock.Update(func(scenario *mockbanner.Scenario) {
+			scenario.Sections[0].Enrolled--
+		})
+	}()
+
+	task := newTask("Watch", "12345")
+	task.Condition = "seats >= 1 or (waitlist_position <= 3 and waitlist_available > 20)"
+	task.Polling = &tasks.PollPolicy{Interval: "250ms", FastWindow: "0s"}
+	if got := runToCompletion(t, taskManager, task); got != "Registered" {
+		t.Fatalf("final status = %q, want Registered", got)
+	}
+	if polls := mock.Requests(enrollmentInfo); polls < 4 {
+		t.Errorf("polled %d times, want the task to wait for a seat", polls)
+	}
+
+	for _, condition := range []string{
+		"seats >=",
+		"seats > 1 > 0",
+		"(seats > 0",
+		"credits > 0",
+		"seats + 1",
+		"(seats > 0) == 1",
+		strings.Repeat("seats > 0 and ", 20) + "seats > 0",
+	} {
+		task.Condition = condition
+		var validationErr *tasks.ValidationError
+		if err := task.Validate(); !errors.As(err, &validationErr) || validationErr.Field != "condition" {
+			t.Errorf("Validate with condition %q = %v, want a condition error", condition, err)
+		}
+	}
+	for _, condition := range []string{"waitlist_available", "not (seats == 0) && waitlist_actual < 5", "SEATS != 0 || !waitlist_available"} {
+		if _, err := tasks.ParseCondition(condition); err != nil {
+			t.Errorf("ParseCondition(%q) = %v", condition, err)
+		}
+	}
+}
+
+func TestWatchesSharePolls(t *testing.T) {
+	mock, taskManager := startMock(t, mockbanner.Scenarios["full-class"]())
+	const enrollmentInfo = "/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo"
+	t.Cleanup(func() { taskManager.DeleteTask("e2e-2") })
+
+	for _, id := range []string{"e2e", "e2e-2"} {
+		task := newTask("Watch", "12345")
+		task.ID = id
+		task.Polling = &tasks.PollPolicy{Interval: "250ms"}
+		if err := taskManager.CreateTask(task); err != nil {
+			t.Fatalf("CreateTask: %v", err)
+		}
+		taskManager.RunTask(id)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		statuses := taskManager.Watches.Status()
+		if len(statuses) == 1 && len(statuses[0].Tasks) == 2 && statuses[0].Polls >= 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("watch status = %+v, want one section watched by two tasks", statuses)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	taskManager.StopTask("e2e")
+	taskManager.StopTask("e2e-2")
+	for len(taskManager.Watches.Status()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stopped tasks are still watched")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Two tasks at 250ms for at least four polls would make eight requests
+	// if each polled on its own.
+	if polls := mock.Requests(enrollmentInfo); polls > 6 {
+		t.Errorf("made %d enrollment requests, want the tasks to share polls", polls)
+	}
+}
+
+func TestWatchPollsThroughClassSearch(t *testing.T) {
+	const (
+		enrollmentInfo = "/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo"
+		searchResults  = "/StudentRegistrationSsb/ssb/searchResults/searchResults"
+	)
+
+	t.Run("batched", func(t *testing.T) {
+		mock, taskManager := startMock(t, mockbanner.Scenarios["full-class"]())
+		go func() {
+			for mock.Requests(searchResults) < 2 {
+				time.Sleep(50 * time.Millisecond)
+			}
+			mock.Update(func(scenario *mockbanner.Scenario) {
+				scenario.Sections[0].Enrolled--
+				scenario.Sections[0].WaitActual--
+			})
+		}()
+
+		task := newTask("Watch", "12345")
+		task.Subject = "CIS"
+		task.Polling = &tasks.PollPolicy{Interval: "250ms"}
+		if got := runToCompletion(t, taskManager, task); got != "Registered" {
+			t.Fatalf("final status = %q, want Registered", got)
+		}
+		if polls := mock.Requests(enrollmentInfo); polls != 0 {
+			t.Errorf("made %d enrollment page requests, want none", polls)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		mock, taskManager := startMock(t, mockbanner.Scenarios["open"]())
+		// 23456 is a MATH section, so the CIS search does not list it.
+		task := newTask("Watch", "23456")
+		task.Subject = "CIS"
+		task.Polling = &tasks.PollPolicy{Interval: "250ms"}
+		if got := runToCompletion(t, taskManager, task); got != "Registered" {
+			t.Fatalf("final status = %q, want Registered", got)
+		}
+		if polls := mock.Requests(enrollmentInfo); polls != 1 {
+			t.Errorf("made %d enrollment page requests, want 1", polls)
+		}
+	})
+}
+
+func TestNotifyReportsSeatChanges(t *testing.T) {
+	mock, taskManager := startMock(t, mockbanner.Scenarios["full-class"]())
+	var notifications atomic.Int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if bytes.Contains(body, []byte("Before")) && bytes.Contains(body, []byte("After")) {
+			notifications.Add(1)
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(webhook.Close)
+
+	// Open a seat, close it again for a single poll, then reopen it. Only
+	// the first opening is confirmed and reported.
+	go func() {
+		for _, step := range []struct {
+			polls, enrolled int
+		}{{2, -1}, {5, +1}, {6, -1}} {
+			for mock.Requests("/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo") < step.polls {
+				time.Sleep(20 * time.Millisecond)
+			}
+			mock.Update(func(scenario *mockbanner.Scenario) {
+				scenario.Sections[0].Enrolled += step.enrolled
+			})
+		}
+	}()
+
+	task := newTask("Notify", "12345")
+	task.Username, task.Password = "", ""
+	task.WebhookURL = webhook.URL
+	task.Polling = &tasks.PollPolicy{Interval: "250ms", FastWindow: "0s"}
+	event := waitForEvent(t, taskManager, task, 10*time.Second, func(event tasks.Event) bool {
+		return event.Type == tasks.EventSeatChange
+	})
+	change := event.SeatChange
+	if change.From != tasks.SeatsFull || change.To != tasks.SeatsOpen || change.Before.SeatsAvailable != 0 || change.After.SeatsAvailable != 1 {
+		t.Errorf("seat change = %+v, want full to seats open with 0 then 1 seats", change)
+	}
+
+	for mock.Requests("/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo") < 9 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	taskManager.StopTask(task.ID)
+	if n := notifications.Load(); n != 1 {
+		t.Errorf("sent %d notifications, want 1", n)
+	}
+}
+
+func TestImportReplaceKeepsTasksOnError(t *testing.T) {
+	taskManager := tasks.NewTaskManager()
+	if err := taskManager.CreateTask(newTask("Signup", "12345")); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+
+	// The second task asks for a proxy pool the engine does not have.
+	file := &tasks.TaskFile{
+		Version:  1,
+		Accounts: []tasks.AccountSpec{{ID: "main", Username: mockbanner.DefaultUsername, Password: mockbanner.DefaultPassword}},
+		Tasks: []tasks.TaskSpec{
+			{ID: "e2e", Mode: "Signup", Account: "main", Term: "202442", CRNs: []string{"23456"}},
+			{ID: "pooled", Mode: "Signup", Account: "main", Term: "202442", CRNs: []string{"34567"}, Proxy: tasks.ProxyFromPool},
+		},
+	}
+	if _, err := taskManager.ImportTasks(file, true); err == nil {
+		t.Fatal("ImportTasks succeeded without a proxy pool")
+	}
+	task, exists := taskManager.GetTask("e2e")
+	if !exists || task.Crns != "12345" {
+		t.Fatalf("after a failed replace, task = %+v, want the original", task)
+	}
+	if _, exists := taskManager.GetTask("pooled"); exists {
+		t.Error("failed import created a task")
+	}
+
+	if _, err := taskManager.ImportTasks(&tasks.TaskFile{Version: 1, Accounts: file.Accounts, Tasks: file.Tasks[:1]}, true); err != nil {
+		t.Fatalf("ImportTasks: %v", err)
+	}
+	if task, _ := taskManager.GetTask("e2e"); task.Crns != "23456" {
+		t.Errorf("replaced task has CRNs %q, want 23456", task.Crns)
+	}
+}
+
+func TestScheduledStartRunsOnce(t *testing.T) {
+	_, taskManager := startMock(t, mockbanner.Scenarios["full-class"]())
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+
+	task := newTask("Notify", "12345")
+	task.Username, task.Password = "", ""
+	task.Polling = &tasks.PollPolicy{Interval: "250ms"}
+	if err := taskManager.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if err := taskManager.ScheduleTask(task.ID, time.Now().Add(50*time.Millisecond)); err != nil {
+		t.Fatalf("ScheduleTask: %v", err)
+	}
+	deadline := time.After(5 * time.Second)
+	for running := false; !running; {
+		select {
+		case event := <-events:
+			running = event.TaskID == task.ID && event.Status == "Running"
+		case <-deadline:
+			t.Fatalf("scheduled task did not start; status %q", taskManager.GetTaskStatus(task.ID))
+		}
+	}
+
+	if err := taskManager.StartTask(task.ID); !errors.Is(err, tasks.ErrTaskRunning) {
+		t.Errorf("StartTask on a running task = %v, want ErrTaskRunning", err)
+	}
+	if err := taskManager.StartTask("missing"); !errors.Is(err, tasks.ErrTaskNotFound) {
+		t.Errorf("StartTask on a missing task = %v, want ErrTaskNotFound", err)
+	}
+	taskManager.StopTask(task.ID)
+	for finished := false; !finished; {
+		select {
+		case event := <-events:
+			finished = event.TaskID == task.ID && event.Type == tasks.EventTaskFinished
+		case <-deadline:
+			t.Fatal("stopped task did not finish")
+		}
+	}
+	if current, _ := taskManager.GetTask(task.ID); current.StartAt != nil || current.Running {
+		t.Errorf("finished task has start_at %v and running %v, want neither", current.StartAt, current.Running)
+	}
+}
+
+func TestLoadCheckpointSkipsInvalidTasks(t *testing.T) {
+	accounts, err := vault.Open(filepath.Join(t.TempDir(), "vault.json"), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := accounts.Add("student", mockbanner.DefaultUsername, mockbanner.DefaultPassword); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	waitUntil := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := `[
+		{"task": {"id": "e2e", "mode": "Signup", "term": "202442", "crns": "12345", "account": "student"}, "phase": "waiting", "wait_until": "` + waitUntil + `", "resume": true},
+		{"task": {"id": "pooled", "mode": "Signup", "term": "202442", "crns": "12345", "account": "student", "proxy": "pool"}, "resume": true},
+		{"task": {"id": "idle", "mode": "Signup", "term": "202442", "crns": "12345", "account": "student"}, "resume": false}
+	]`
+	if err := os.WriteFile(path, []byte(checkpoint), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, taskManager := startMock(t, mockbanner.Scenarios["not-yet-open"]())
+	taskManager.Accounts = accounts
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+	restored, err := taskManager.LoadCheckpoint(path)
+	if err != nil || restored != 1 {
+		t.Fatalf("LoadCheckpoint = %d, %v; want 1 task restored", restored, err)
+	}
+	for _, id := range []string{"pooled", "idle"} {
+		if _, exists := taskManager.GetTask(id); exists {
+			t.Errorf("task %s was restored", id)
+		}
+	}
+
+	// The resumed task waits for its registration window before signing in.
+	deadline := time.After(10 * time.Second)
+	for waiting := false; !waiting; {
+		select {
+		case event := <-events:
+			waiting = event.TaskID == "e2e" && strings.HasPrefix(event.Status, "Waiting til")
+		case <-deadline:
+			t.Fatal("resumed task did not wait for its registration window")
+		}
+	}
+}
+
+func TestDefaultInstitutionFollowsTerm(t *testing.T) {
+	for term, want := range map[string]string{"202442": "deanza", "202441": "foothill"} {
+		institution, exists := tasks.InstitutionForTerm("", term)
+		if !exists || institution.ID != want {
+			t.Errorf("InstitutionForTerm(\"\", %s) = %v, want %s", term, institution, want)
+		}
+		task := newTask("Signup", "12345")
+		task.Term = term
+		if err := task.Validate(); err != nil {
+			t.Errorf("task for term %s without an institution: %v", term, err)
+		}
+	}
+
+	task := newTask("Signup", "12345")
+	task.Term, task.Institution = "202441", "deanza"
+	var validationErr *tasks.ValidationError
+	if err := task.Validate(); !errors.As(err, &validationErr) || validationErr.Field != "term" {
+		t.Errorf("Foothill term for deanza = %v, want a term error", err)
+	}
+}
+
+func TestCheckpointStoresVaultCredentialsAsAccount(t *testing.T) {
+	accounts, err := vault.Open(filepath.Join(t.TempDir(), "vault.json"), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := accounts.Add("vaulted", mockbanner.DefaultUsername, "vault-secret"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	_, taskManager := startMock(t, mockbanner.Scenarios["not-yet-open"]())
+	taskManager.Accounts = accounts
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	taskManager.EnableCheckpoints(path)
+	t.Cleanup(func() { taskManager.DeleteTask("other") })
+
+	// Both tasks wait for their registration window before signing in.
+	waitUntil := time.Now().Add(time.Hour)
+	events, unsubscribe := taskManager.Events.Subscribe()
+	defer unsubscribe()
+	for id, password := range map[string]string{"e2e": "vault-secret", "other": "not-in-the-vault", "idle": "vault-secret"} {
+		task := newTask("Signup", "12345")
+		task.ID, task.Password, task.WaitUntil = id, password, &waitUntil
+		if err := taskManager.CreateTask(task); err != nil {
+			t.Fatalf("CreateTask: %v", err)
+		}
+	}
+	t.Cleanup(func() { taskManager.DeleteTask("idle") })
+	for _, id := range []string{"e2e", "other"} {
+		if err := taskManager.StartTask(id); err != nil {
+			t.Fatalf("StartTask %s: %v", id, err)
+		}
+	}
+	deadline := time.After(10 * time.Second)
+	for waiting := 0; waiting < 2; {
+		select {
+		case event := <-events:
+			if strings.HasPrefix(event.Status, "Waiting til") {
+				waiting++
+			}
+		case <-deadline:
+			t.Fatal("tasks did not start waiting")
+		}
+	}
+	if err := taskManager.WriteCheckpoint(); err != nil {
+		t.Fatalf("WriteCheckpoint: %v", err)
+	}
+
+	// Only the running task whose credentials the vault holds is saved, and
+	// as the vault account.
+	data, _ := os.ReadFile(path)
+	for _, leaked := range []string{"vault-secret", "not-in-the-vault", mockbanner.DefaultUsername, `"idle"`} {
+		if bytes.Contains(data, []byte(leaked)) {
+			t.Errorf("checkpoint contains %s: %s", leaked, data)
+		}
+	}
+	_, restored := startMock(t, mockbanner.Scenarios["not-yet-open"]())
+	restored.Accounts = accounts
+	if count, err := restored.LoadCheckpoint(path); err != nil || count != 1 {
+		t.Fatalf("LoadCheckpoint = %d, %v; want 1 task", count, err)
+	}
+	if task, _ := restored.GetTask("e2e"); task.Account != "vaulted" || task.Username != "" {
+		t.Errorf("restored task signs in with account %q and username %q, want the vault account", task.Account, task.Username)
+	}
+}
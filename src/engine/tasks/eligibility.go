@@ -0,0 +1,173 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"proj/apitypes"
+	"regexp"
+	"time"
+)
+
+// Kinds of eligibility failure Banner reports for a term.
+const (
+	EligibilityHold             = apitypes.EligibilityHold
+	EligibilityTimeTicket       = apitypes.EligibilityTimeTicket
+	EligibilityNotEnrolled      = apitypes.EligibilityNotEnrolled
+	EligibilityAcademicStanding = apitypes.EligibilityAcademicStanding
+	EligibilityTermClosed       = apitypes.EligibilityTermClosed
+	EligibilityOther            = apitypes.EligibilityOther
+)
+
+// EligibilityTimeout bounds an eligibility check, sign in included.
+var EligibilityTimeout = 2 * time.Minute
+
+// eligibilityKinds classifies failure messages, first match wins. Banner's
+// wording is set by each college, so the patterns are loose.
+var eligibilityKinds = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{EligibilityTimeTicket, regexp.MustCompile(`(?i)you can register from|time ticket|registration time|not (yet )?(permitted|allowed) to register at this time`)},
+	{EligibilityHold, regexp.MustCompile(`(?i)\bholds?\b`)},
+	{EligibilityAcademicStanding, regexp.MustCompile(`(?i)academic standing|probation|dismiss|disqualif`)},
+	{EligibilityNotEnrolled, regexp.MustCompile(`(?i)not (currently )?(enrolled|admitted|active)|no (student|admission|application) record|must (apply|be admitted)|not eligible to enroll`)},
+	{EligibilityTermClosed, regexp.MustCompile(`(?i)registration (is )?(closed|not open|has ended)|term is (closed|not open)|not open for registration`)},
+}
+
+// registrationWindowPattern matches the dates of a time ticket, such as
+// "You can register from 04/08/2024 08:00 AM to 07/07/2024 11:59 PM."
+var registrationWindowPattern = regexp.MustCompile(`\d{2}/\d{2}/\d{4} \d{2}:\d{2} [APM]{2}`)
+
+// EligibilityFailure is one reason Banner gives for not letting the account
+// register.
+type EligibilityFailure = apitypes.EligibilityFailure
+
+// Eligibility is whether an account may register for a term.
+type Eligibility = apitypes.Eligibility
+
+// classifyEligibilityFailure returns the kind of an eligibility failure.
+func classifyEligibilityFailure(message string) string {
+	for _, kind := range eligibilityKinds {
+		if kind.pattern.MatchString(message) {
+			return kind.kind
+		}
+	}
+	return EligibilityOther
+}
+
+// newEligibility classifies a registration status, reading the time ticket
+// in the institution's timezone.
+func newEligibility(term string, institution *Institution, status *RegistrationStatus) *Eligibility {
+	eligibility := &Eligibility{
+		Term:        term,
+		Institution: institution.ID,
+		Valid:       status.StudentEligValid,
+		Failures:    make([]EligibilityFailure, 0, len(status.StudentEligFailures)),
+		CheckedAt:   time.Now().UTC(),
+	}
+	waiting := len(status.StudentEligFailures) > 0
+	for _, message := range status.StudentEligFailures {
+		failure := EligibilityFailure{Kind: classifyEligibilityFailure(message), Message: message}
+		eligibility.Failures = append(eligibility.Failures, failure)
+		if failure.Kind != EligibilityTimeTicket {
+			waiting = false
+			continue
+		}
+		if eligibility.RegistrationOpens != nil {
+			continue
+		}
+		for i, match := range registrationWindowPattern.FindAllString(message, 2) {
+			at, err := time.ParseInLocation("01/02/2006 03:04 PM", match, institution.Location())
+			if err != nil {
+				continue
+			}
+			if i == 0 {
+				eligibility.RegistrationOpens = &at
+			} else {
+				eligibility.RegistrationCloses = &at
+			}
+		}
+	}
+	eligibility.Ready = eligibility.Valid || waiting
+	return eligibility
+}
+
+// FetchEligibility asks Banner whether the signed in task may register for
+// its term.
+func (t *Task) FetchEligibility() (*Eligibility, error) {
+	headers := t.headers(acceptAny, contentForm)
+	values := url.Values{
+		"term":            {t.Term},
+		"studyPath":       {},
+		"startDatepicker": {},
+		"endDatepicker":   {},
+		"uniqueSessionId": {t.Session.UniqueSessionId},
+	}
+
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().bannerURL("/ssb/term/search?mode=registration"), headers, []byte(values.Encode())))
+	if err != nil {
+		discardResp(response)
+		return nil, err
+	}
+
+	body, _ := readBody(response)
+	t.log().Debug("registration status response", "body", string(body))
+
+	var registrationStatus RegistrationStatus
+	if err := json.Unmarshal(body, &registrationStatus); err != nil {
+		return nil, err
+	}
+	return newEligibility(t.Term, t.institution(), &registrationStatus), nil
+}
+
+// CheckEligibility signs in with a vault account and reports whether it may
+// register for the term, without registering for anything.
+func (tm *TaskManager) CheckEligibility(ctx context.Context, account, institution, term string) (*Eligibility, error) {
+	task, err := tm.accountProbe("eligibility", account, institution, term)
+	if err != nil {
+		return nil, err
+	}
+	return task.checkEligibility(ctx)
+}
+
+// accountProbe returns a probe task that signs in with a vault account for
+// a term, named after what it checks.
+func (tm *TaskManager) accountProbe(check, account, institution, term string) (*Task, error) {
+	profile, exists := InstitutionForTerm(institution, term)
+	if !exists {
+		return nil, &ValidationError{"institution", fmt.Sprintf("unknown institution %q", institution)}
+	}
+	if !profile.ValidTerm(term) {
+		return nil, profile.termError()
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	task := tm.probe(&Task{ID: check + "-" + account, Term: term, Institution: institution, Account: account})
+	if err := tm.checkAccount(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// probe readies a task that signs in outside the task list, such as for an
+// eligibility check. Nobody can answer a probe's MFA challenge, so it fails
+// at one rather than waiting. Callers hold the mutex.
+func (tm *TaskManager) probe(task *Task) *Task {
+	task.accounts = tm.Accounts
+	task.proxies = tm.Proxies
+	task.hostOverrides = tm.HostOverrides
+	return task
+}
+
+// checkEligibility signs a probe task in and fetches its eligibility.
+func (t *Task) checkEligibility(ctx context.Context) (*Eligibility, error) {
+	t.ctx, t.cancel = context.WithTimeout(ctx, EligibilityTimeout)
+	defer t.cancel()
+	if err := t.CheckLogin(); err != nil {
+		return nil, err
+	}
+	return t.FetchEligibility()
+}
@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"proj/apitypes"
+	"sync"
+	"time"
+)
+
+// Event types published on the EventBus.
+const (
+	EventTaskCreated  = "task.created"
+	EventTaskUpdated  = "task.updated"
+	EventTaskDeleted  = "task.deleted"
+	EventTaskStatus   = "task.status"
+	EventTaskFinished = "task.finished"
+	EventMFARequired  = "task.mfa_required"
+	EventSeatChange   = "task.seat_change"
+)
+
+// Event is a single change to a task.
+type Event = apitypes.Event
+
+// EventBus fans task events out to every subscriber.
+type EventBus struct {
+	subscribers map[chan Event]struct{}
+	mutex       sync.Mutex
+}
+
+// NewEventBus creates an empty EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a new listener. The returned function unsubscribes it
+// and closes the channel.
+func (b *EventBus) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, 64)
+	b.mutex.Lock()
+	b.subscribers[events] = struct{}{}
+	b.mutex.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			delete(b.subscribers, events)
+			b.mutex.Unlock()
+			close(events)
+		})
+	}
+}
+
+// Publish sends an event to every subscriber. Slow subscribers miss events
+// rather than blocking the task that produced them.
+func (b *EventBus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// SetStatus updates the task status and publishes the change.
+func (t *Task) SetStatus(status string) {
+	t.state.Lock()
+	t.Status = status
+	t.state.Unlock()
+	t.log().Info("status changed", "status", status)
+	t.events.Publish(Event{Type: EventTaskStatus, TaskID: t.ID, Status: status})
+}
+
+// status returns the task's current status.
+func (t *Task) status() string {
+	t.state.Lock()
+	defer t.state.Unlock()
+	return t.Status
+}
@@ -0,0 +1,169 @@
+package tasks
+
+import (
+	"fmt"
+	"math/rand"
+	"proj/apitypes"
+	"sort"
+
+	http "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/tls-client/profiles"
+)
+
+// FingerprintRandom is the Task.Fingerprint value that picks a built-in
+// fingerprint at random each time the task starts.
+const FingerprintRandom = "random"
+
+// DefaultFingerprint is used by tasks that do not pick one.
+const DefaultFingerprint = "chrome-120"
+
+// Accept header values request builders ask for. acceptHTML is replaced by
+// the fingerprint's own navigation Accept header.
+const (
+	acceptAny  = "*/*"
+	acceptHTML = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"
+	acceptJSON = "application/json"
+	acceptXHR  = "application/json, text/javascript, */*; q=0.01"
+)
+
+// Request body content types.
+const (
+	contentForm = "application/x-www-form-urlencoded"
+	contentJSON = "application/json"
+)
+
+// Fingerprint is a browser a task poses as: the TLS and HTTP/2 fingerprint
+// of its client and the headers that browser sends, in the order it sends
+// them. Keeping them together stops the TLS handshake and the user-agent
+// from disagreeing.
+type Fingerprint struct {
+	apitypes.Fingerprint
+
+	clientProfile profiles.ClientProfile
+}
+
+// chromeHeaderOrder is the order Chrome sends request headers in.
+var chromeHeaderOrder = []string{
+	"host", "content-length", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+	"user-agent", "content-type", "accept", "origin", "referer",
+	"accept-encoding", "accept-language", "cookie",
+}
+
+// chrome builds a Windows Chrome fingerprint for a major version.
+func chrome(version string, brand string, profile profiles.ClientProfile) *Fingerprint {
+	return &Fingerprint{
+		Fingerprint: apitypes.Fingerprint{
+			ID:              "chrome-" + version,
+			UserAgent:       fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%s.0.0.0 Safari/537.36", version),
+			SecCHUA:         brand,
+			SecCHUAMobile:   "?0",
+			SecCHUAPlatform: `"Windows"`,
+			AcceptHTML:      acceptHTML,
+			AcceptLanguage:  "en-US,en;q=0.9",
+			HeaderOrder:     chromeHeaderOrder,
+		},
+		clientProfile: profile,
+	}
+}
+
+// fingerprints are the built-in fingerprints by ID.
+var fingerprints = map[string]*Fingerprint{
+	"chrome-120": chrome("120", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`, profiles.Chrome_120),
+	"chrome-124": chrome("124", `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`, profiles.Chrome_124),
+	"firefox-120": {
+		Fingerprint: apitypes.Fingerprint{
+			ID:             "firefox-120",
+			UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0",
+			AcceptHTML:     "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+			AcceptLanguage: "en-US,en;q=0.5",
+			HeaderOrder: []string{
+				"host", "user-agent", "accept", "accept-language", "accept-encoding",
+				"content-type", "content-length", "origin", "referer", "cookie",
+			},
+		},
+		clientProfile: profiles.Firefox_120,
+	},
+	"safari-16": {
+		Fingerprint: apitypes.Fingerprint{
+			ID:             "safari-16",
+			UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Safari/605.1.15",
+			AcceptHTML:     "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			AcceptLanguage: "en-US,en;q=0.9",
+			HeaderOrder: []string{
+				"host", "content-type", "accept", "origin", "accept-language",
+				"user-agent", "referer", "content-length", "accept-encoding", "cookie",
+			},
+		},
+		clientProfile: profiles.Safari_16_0,
+	},
+}
+
+// LookupFingerprint returns a built-in fingerprint by ID. The empty ID is
+// the default fingerprint.
+func LookupFingerprint(id string) (*Fingerprint, bool) {
+	if id == "" {
+		id = DefaultFingerprint
+	}
+	fingerprint, exists := fingerprints[id]
+	return fingerprint, exists
+}
+
+// Fingerprints lists the built-in fingerprints, ordered by ID.
+func Fingerprints() []*Fingerprint {
+	list := make([]*Fingerprint, 0, len(fingerprints))
+	for _, fingerprint := range fingerprints {
+		list = append(list, fingerprint)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// resolveFingerprint picks the fingerprint for the task's next client.
+func (t *Task) resolveFingerprint() *Fingerprint {
+	if t.Fingerprint == FingerprintRandom {
+		list := Fingerprints()
+		return list[rand.Intn(len(list))]
+	}
+	if fingerprint, exists := LookupFingerprint(t.Fingerprint); exists {
+		return fingerprint
+	}
+	fingerprint, _ := LookupFingerprint("")
+	return fingerprint
+}
+
+// browser returns the fingerprint the task's client was built with.
+func (t *Task) browser() *Fingerprint {
+	if t.fingerprint == nil {
+		t.fingerprint = t.resolveFingerprint()
+	}
+	return t.fingerprint
+}
+
+// headers returns the default headers of a request that accepts accept and,
+// unless contentType is empty, carries a body of that type.
+func (t *Task) headers(accept, contentType string) [][2]string {
+	browser := t.browser()
+	if accept == acceptHTML {
+		accept = browser.AcceptHTML
+	}
+	headers := [][2]string{
+		{"accept", accept},
+		{"accept-language", browser.AcceptLanguage},
+	}
+	if contentType != "" {
+		headers = append(headers, [2]string{"content-type", contentType})
+	}
+	if browser.SecCHUA != "" {
+		headers = append(headers,
+			[2]string{"sec-ch-ua", browser.SecCHUA},
+			[2]string{"sec-ch-ua-mobile", browser.SecCHUAMobile},
+			[2]string{"sec-ch-ua-platform", browser.SecCHUAPlatform},
+		)
+	}
+	return append(headers, [2]string{"user-agent", browser.UserAgent})
+}
+
+// orderHeaders makes a request send its headers in the fingerprint's order.
+func (t *Task) orderHeaders(req *http.Request) {
+	req.Header[http.HeaderOrderKey] = t.browser().HeaderOrder
+}
@@ -0,0 +1,269 @@
+package tasks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// HAR is an HTTP Archive 1.2 document, as written by capture mode.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds the captured exchanges of one task run.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+	// Task records what was run so the flow can be replayed.
+	Task *HARTask `json:"_task,omitempty"`
+}
+
+// HARCreator names the program that wrote the archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HARTask is the non-secret part of the task that produced an archive.
+type HARTask struct {
+	ID          string `json:"id"`
+	Mode        string `json:"mode"`
+	Term        string `json:"term"`
+	Institution string `json:"institution,omitempty"`
+	Crns        string `json:"crns"`
+}
+
+// HAREntry is one request and its response.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	// Step is the task step that sent the request.
+	Step string `json:"_step,omitempty"`
+	// Error is set when no response was received.
+	Error string `json:"_error,omitempty"`
+}
+
+// HARRequest is a captured request with secrets redacted.
+type HARRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []HARNameVal `json:"cookies"`
+	Headers     []HARNameVal `json:"headers"`
+	QueryString []HARNameVal `json:"queryString"`
+	PostData    *HARPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+// HARResponse is a captured response with secrets redacted.
+type HARResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []HARNameVal `json:"cookies"`
+	Headers     []HARNameVal `json:"headers"`
+	Content     HARContent   `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+// HARNameVal is a header, cookie or query parameter.
+type HARNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is a captured request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent is a captured response body.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARTimings splits an entry's time into phases. Only the wait is measured.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// ReadHAR loads an archive written by capture mode.
+func ReadHAR(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var archive HAR
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &archive, nil
+}
+
+// harRecorder collects the exchanges of one task run.
+type harRecorder struct {
+	archive HAR
+	mutex   sync.Mutex
+}
+
+// newHARRecorder starts an empty archive for a task run.
+func newHARRecorder(t *Task) *harRecorder {
+	return &harRecorder{archive: HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "veil", Version: "1"},
+		Entries: []HAREntry{},
+		Task:    &HARTask{ID: t.ID, Mode: t.Mode, Term: t.Term, Institution: t.Institution, Crns: t.Crns},
+	}}}
+}
+
+// sensitiveHeaders are headers whose values are never captured.
+var sensitiveHeaders = []string{"cookie", "set-cookie", "authorization"}
+
+// harHeaders copies headers in a stable order, redacting secrets.
+func harHeaders(header http.Header) []HARNameVal {
+	values := []HARNameVal{}
+	for name, list := range header {
+		if name == http.HeaderOrderKey || name == http.PHeaderOrderKey {
+			continue
+		}
+		for _, value := range list {
+			if contains(sensitiveHeaders, strings.ToLower(name)) {
+				value = "[REDACTED]"
+			}
+			values = append(values, HARNameVal{Name: name, Value: value})
+		}
+	}
+	sortNameVals(values)
+	return values
+}
+
+// harCookies lists cookie names with their values redacted.
+func harCookies(cookies []*http.Cookie) []HARNameVal {
+	values := []HARNameVal{}
+	for _, cookie := range cookies {
+		values = append(values, HARNameVal{Name: cookie.Name, Value: "[REDACTED]"})
+	}
+	return values
+}
+
+// sortNameVals orders name/value pairs by name.
+func sortNameVals(values []HARNameVal) {
+	sort.SliceStable(values, func(i, j int) bool {
+		return strings.ToLower(values[i].Name) < strings.ToLower(values[j].Name)
+	})
+}
+
+// record adds one exchange to the archive under the URL the task asked for,
+// before any host override. The response body is read and put back so
+// callers can still consume it.
+func (r *harRecorder) record(t *Task, target *url.URL, req *http.Request, resp *http.Response, started time.Time, duration time.Duration, err error) {
+	milliseconds := float64(duration) / float64(time.Millisecond)
+	entry := HAREntry{
+		StartedDateTime: started,
+		Time:            milliseconds,
+		Timings:         HARTimings{Send: 0, Wait: milliseconds, Receive: 0},
+		Step:            t.step,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         Redact(target.String()),
+			HTTPVersion: "HTTP/2.0",
+			Cookies:     harCookies(req.Cookies()),
+			Headers:     harHeaders(req.Header),
+			QueryString: []HARNameVal{},
+			HeadersSize: -1,
+			BodySize:    0,
+		},
+	}
+	for name, list := range target.Query() {
+		for _, value := range list {
+			if contains(sensitiveKeys, strings.ToLower(name)) {
+				value = "[REDACTED]"
+			}
+			entry.Request.QueryString = append(entry.Request.QueryString, HARNameVal{Name: name, Value: value})
+		}
+	}
+	sortNameVals(entry.Request.QueryString)
+
+	if req.GetBody != nil {
+		if body, bodyErr := req.GetBody(); bodyErr == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			if len(data) > 0 {
+				entry.Request.BodySize = len(data)
+				entry.Request.PostData = &HARPostData{MimeType: req.Header.Get("content-type"), Text: Redact(string(data))}
+			}
+		}
+	}
+
+	if err != nil {
+		entry.Error = Redact(err.Error())
+	}
+	if resp != nil {
+		entry.Response = HARResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     harCookies(resp.Cookies()),
+			Headers:     harHeaders(resp.Header),
+			RedirectURL: Redact(resp.Header.Get("location")),
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+		if resp.Body != nil {
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(data))
+			entry.Response.BodySize = len(data)
+			entry.Response.Content = HARContent{
+				Size:     len(data),
+				MimeType: resp.Header.Get("content-type"),
+				Text:     Redact(string(data)),
+			}
+		}
+	}
+
+	r.mutex.Lock()
+	r.archive.Log.Entries = append(r.archive.Log.Entries, entry)
+	r.mutex.Unlock()
+}
+
+// write saves the archive to dir as <task>-<time>.har and returns its path.
+func (r *harRecorder) write(dir string) (string, error) {
+	r.mutex.Lock()
+	data, err := json.MarshalIndent(r.archive, "", "  ")
+	taskID := r.archive.Log.Task.ID
+	r.mutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.har", taskID, time.Now().Format("20060102-150405")))
+	return path, os.WriteFile(path, data, 0o600)
+}
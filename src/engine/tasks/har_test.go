@@ -0,0 +1,99 @@
+package tasks
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+func TestHARHeadersRedactSecrets(t *testing.T) {
+	header := http.Header{
+		"Cookie":            {"JSESSIONID=abc"},
+		"Set-Cookie":        {"JSESSIONID=def; Path=/", "SESSION=ghi"},
+		"Authorization":     {"Basic c3R1ZGVudDpwYXNzd29yZA=="},
+		"Accept":            {"application/json"},
+		http.HeaderOrderKey: {"accept", "cookie"},
+	}
+	want := []HARNameVal{
+		{Name: "Accept", Value: "application/json"},
+		{Name: "Authorization", Value: "[REDACTED]"},
+		{Name: "Cookie", Value: "[REDACTED]"},
+		{Name: "Set-Cookie", Value: "[REDACTED]"},
+		{Name: "Set-Cookie", Value: "[REDACTED]"},
+	}
+	got := harHeaders(header)
+	if len(got) != len(want) {
+		t.Fatalf("harHeaders = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("header %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHARCookiesRedactValues(t *testing.T) {
+	got := harCookies([]*http.Cookie{{Name: "JSESSIONID", Value: "abc"}, {Name: "SESSION", Value: "def"}})
+	want := []HARNameVal{{Name: "JSESSIONID", Value: "[REDACTED]"}, {Name: "SESSION", Value: "[REDACTED]"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("harCookies = %+v, want %+v", got, want)
+	}
+}
+
+func TestHARRecordRedactsExchange(t *testing.T) {
+	task := &Task{ID: "capture", Mode: "Signup", Term: "202442", Crns: "12345", step: "login"}
+	recorder := newHARRecorder(task)
+
+	target, _ := url.Parse("https://sso.example.edu/idp/profile?execution=e1s1&RelayState=secret-state")
+	body := "j_username=student&j_password=hunter2"
+	req, err := http.NewRequest("POST", target.String(), strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "JSESSIONID", Value: "abc"})
+	resp := &http.Response{
+		StatusCode: 200,
+		Proto:      "HTTP/2.0",
+		Header: http.Header{
+			"Content-Type": {"text/html"},
+			"Set-Cookie":   {"shib_idp_session=def; Path=/"},
+		},
+		Body: io.NopCloser(strings.NewReader(`<input type="hidden" name="SAMLResponse" value="PHNhbWw+"/>`)),
+	}
+
+	recorder.record(task, target, req, resp, time.Now(), 25*time.Millisecond, nil)
+	entry := recorder.archive.Log.Entries[0]
+
+	if entry.Step != "login" || entry.Request.URL != "https://sso.example.edu/idp/profile?execution=e1s1&RelayState=[REDACTED]" {
+		t.Errorf("request = %q at step %q, want the relay state redacted at login", entry.Request.URL, entry.Step)
+	}
+	for _, param := range entry.Request.QueryString {
+		if param.Name == "RelayState" && param.Value != "[REDACTED]" {
+			t.Errorf("query parameter RelayState = %q, want it redacted", param.Value)
+		}
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != "j_username=student&j_password=[REDACTED]" {
+		t.Errorf("post data = %+v, want the password redacted", entry.Request.PostData)
+	}
+	if len(entry.Request.Cookies) != 1 || entry.Request.Cookies[0].Value != "[REDACTED]" {
+		t.Errorf("request cookies = %+v, want the value redacted", entry.Request.Cookies)
+	}
+	if len(entry.Response.Cookies) != 1 || entry.Response.Cookies[0] != (HARNameVal{Name: "shib_idp_session", Value: "[REDACTED]"}) {
+		t.Errorf("response cookies = %+v, want the value redacted", entry.Response.Cookies)
+	}
+	if want := `<input type="hidden" name="SAMLResponse" value="[REDACTED]"/>`; entry.Response.Content.Text != want {
+		t.Errorf("response body = %q, want %q", entry.Response.Content.Text, want)
+	}
+
+	// The body is put back for the caller.
+	data, _ := io.ReadAll(resp.Body)
+	if !bytes.Contains(data, []byte("PHNhbWw+")) {
+		t.Errorf("response body left for the caller = %q, want the original", data)
+	}
+}
@@ -0,0 +1,245 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"proj/apitypes"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSO provider types an institution can sign in with.
+const (
+	// SSOShibbolethWSO2 is a Shibboleth IdP chained through a WSO2 Identity
+	// Server's commonauth and samlsso endpoints.
+	SSOShibbolethWSO2 = "shibboleth-wso2"
+	// SSOShibboleth is a Shibboleth IdP trusted directly by Banner's SAML
+	// service provider.
+	SSOShibboleth = "shibboleth"
+	// SSOCAS is a CAS server that hands Banner a service ticket.
+	SSOCAS = "cas"
+	// SSOBanner is Banner's own login page, without SSO.
+	SSOBanner = "banner"
+)
+
+// DefaultInstitution is the profile used by tasks that do not select one.
+const DefaultInstitution = "deanza"
+
+// Institution describes where one school's SSO and Banner 9 systems live.
+type Institution struct {
+	apitypes.Institution
+
+	termPattern *regexp.Regexp
+	location    *time.Location
+}
+
+// fhda fills in the systems De Anza and Foothill share through their district.
+func fhda(id, name, termPattern, termExample string) *Institution {
+	return &Institution{Institution: apitypes.Institution{
+		ID:              id,
+		Name:            name,
+		SSOProvider:     SSOShibbolethWSO2,
+		IdPHost:         "ssoshib.fhda.edu",
+		AuthHost:        "eis-prod.ec.fhda.edu",
+		BannerHost:      "reg-prod.ec.fhda.edu",
+		BannerPath:      "/StudentRegistrationSsb",
+		ServiceProvider: "registrationssb-prod-sp",
+		HomepageURL:     "https://ssb-prod.ec.fhda.edu/ssomanager/saml/login?relayState=%2Fc%2Fauth%2FSSB%3Fpkg%3Dhttps%3A%2F%2Fssb-prod.ec.fhda.edu%2FPROD%2Ffhda_uportal.P_DeepLink_Post%3Fp_page%3Dbwskfreg.P_AltPin%26p_payload%3De30%3D",
+		SSOManagerURL:   "https://ssb-prod.ec.fhda.edu/ssomanager/saml/SSO",
+		Timezone:        "America/Los_Angeles",
+		TermPattern:     termPattern,
+		TermExample:     termExample,
+	}}
+}
+
+var (
+	institutions = map[string]*Institution{}
+	// institutionsMutex guards institutions against profiles loaded at runtime.
+	institutionsMutex sync.RWMutex
+)
+
+func init() {
+	// FHDA term codes are the year, the quarter and a campus digit.
+	for _, institution := range []*Institution{
+		fhda("deanza", "De Anza College", `^\d{4}[1-4]2$`, "202442"),
+		fhda("foothill", "Foothill College", `^\d{4}[1-4]1$`, "202441"),
+	} {
+		if err := RegisterInstitution(institution); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterInstitution checks a profile and makes it selectable by tasks,
+// replacing any profile with the same ID.
+func RegisterInstitution(institution *Institution) error {
+	if err := institution.compile(); err != nil {
+		return err
+	}
+	institutionsMutex.Lock()
+	defer institutionsMutex.Unlock()
+	institutions[institution.ID] = institution
+	return nil
+}
+
+// LoadInstitutions registers every profile in a JSON file holding an array
+// of institutions.
+func LoadInstitutions(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var profiles []*Institution
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for index, institution := range profiles {
+		if err := RegisterInstitution(institution); err != nil {
+			return fmt.Errorf("%s: institution %d: %w", path, index, err)
+		}
+	}
+	return nil
+}
+
+// LookupInstitution returns a registered profile by ID. An empty ID selects
+// DefaultInstitution.
+func LookupInstitution(id string) (*Institution, bool) {
+	if id == "" {
+		id = DefaultInstitution
+	}
+	institutionsMutex.RLock()
+	defer institutionsMutex.RUnlock()
+	institution, exists := institutions[id]
+	return institution, exists
+}
+
+// InstitutionForTerm returns the profile a task for term uses. An empty ID
+// selects DefaultInstitution or, when term is not one of its codes, the
+// campus sharing its Banner whose codes include term, so a Foothill term
+// works without naming the institution.
+func InstitutionForTerm(id, term string) (*Institution, bool) {
+	if id != "" {
+		return LookupInstitution(id)
+	}
+	fallback, exists := LookupInstitution(DefaultInstitution)
+	if !exists || fallback.ValidTerm(term) {
+		return fallback, exists
+	}
+	for _, institution := range Institutions() {
+		if institution.BannerHost == fallback.BannerHost && institution.ValidTerm(term) {
+			return institution, true
+		}
+	}
+	return fallback, true
+}
+
+// Institutions lists the registered profiles ordered by ID.
+func Institutions() []*Institution {
+	institutionsMutex.RLock()
+	defer institutionsMutex.RUnlock()
+	list := make([]*Institution, 0, len(institutions))
+	for _, institution := range institutions {
+		list = append(list, institution)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// compile validates the profile and prepares its term pattern and timezone.
+func (i *Institution) compile() error {
+	if !taskIDPattern.MatchString(i.ID) {
+		return &ValidationError{"id", "must be 1-64 letters, digits, '-' or '_'"}
+	}
+	if _, exists := lookupAuthenticator(i.SSOProvider); !exists {
+		return &ValidationError{"sso_provider", fmt.Sprintf("must be one of %s", strings.Join(SSOProviders(), ", "))}
+	}
+
+	// Each built-in provider needs a different part of the profile.
+	required := [][2]string{{"banner_host", i.BannerHost}}
+	switch i.SSOProvider {
+	case SSOShibbolethWSO2:
+		required = append(required, [][2]string{
+			{"idp_host", i.IdPHost},
+			{"auth_host", i.AuthHost},
+			{"service_provider", i.ServiceProvider},
+			{"homepage_url", i.HomepageURL},
+			{"sso_manager_url", i.SSOManagerURL},
+		}...)
+	case SSOShibboleth:
+		required = append(required, [2]string{"service_provider", i.ServiceProvider})
+	case SSOCAS:
+		required = append(required, [2]string{"idp_host", i.IdPHost})
+	}
+	for _, field := range required {
+		if field[1] == "" {
+			return &ValidationError{field[0], fmt.Sprintf("is required for sso_provider %s", i.SSOProvider)}
+		}
+	}
+
+	pattern, err := regexp.Compile(i.TermPattern)
+	if err != nil || i.TermPattern == "" {
+		return &ValidationError{"term_pattern", "must be a regular expression"}
+	}
+	if !pattern.MatchString(i.TermExample) {
+		return &ValidationError{"term_example", "must match term_pattern"}
+	}
+	location, err := time.LoadLocation(i.Timezone)
+	if err != nil || i.Timezone == "" {
+		return &ValidationError{"timezone", "must be an IANA timezone such as America/Los_Angeles"}
+	}
+	i.termPattern = pattern
+	i.location = location
+	return nil
+}
+
+// ValidTerm reports whether term is a term code of this institution.
+func (i *Institution) ValidTerm(term string) bool {
+	return i.termPattern.MatchString(term)
+}
+
+// termError explains which term codes the institution accepts.
+func (i *Institution) termError() *ValidationError {
+	return &ValidationError{"term", fmt.Sprintf("must be a %s term code such as %s", i.Name, i.TermExample)}
+}
+
+// Location is the timezone Banner reports registration times in.
+func (i *Institution) Location() *time.Location {
+	return i.location
+}
+
+// bannerURL returns the URL of a Banner Student Registration path.
+func (i *Institution) bannerURL(path string) string {
+	return "https://" + i.BannerHost + i.BannerPath + path
+}
+
+// loginPath returns LoginPath, or fallback when the profile does not set one.
+func (i *Institution) loginPath(fallback string) string {
+	if i.LoginPath != "" {
+		return i.LoginPath
+	}
+	return fallback
+}
+
+// idpURL returns the URL of a path on the identity provider.
+func (i *Institution) idpURL(path string) string {
+	return "https://" + i.IdPHost + path
+}
+
+// authURL returns the URL of a path on the SAML broker.
+func (i *Institution) authURL(path string) string {
+	return "https://" + i.AuthHost + path
+}
+
+// institution returns the task's profile, falling back to the default for
+// tasks restored with a profile that is no longer loaded.
+func (t *Task) institution() *Institution {
+	if institution, exists := InstitutionForTerm(t.Institution, t.Term); exists {
+		return institution
+	}
+	institution, _ := LookupInstitution(DefaultInstitution)
+	return institution
+}
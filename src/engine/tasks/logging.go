@@ -0,0 +1,248 @@
+package tasks
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"proj/apitypes"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LogOptions configures the engine logger.
+type LogOptions struct {
+	Output     io.Writer
+	Level      slog.Level
+	JSON       bool
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// LogEntry is one log line kept in memory for a task.
+type LogEntry = apitypes.LogEntry
+
+// LogStore keeps the most recent log entries of every task.
+type LogStore struct {
+	entries map[string][]LogEntry
+	limit   int
+	mutex   sync.Mutex
+}
+
+// NewLogStore creates a LogStore holding up to limit entries per task.
+func NewLogStore(limit int) *LogStore {
+	return &LogStore{entries: make(map[string][]LogEntry), limit: limit}
+}
+
+// add appends an entry for a task, dropping the oldest when full.
+func (s *LogStore) add(taskID string, entry LogEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries := append(s.entries[taskID], entry)
+	if len(entries) > s.limit {
+		entries = entries[len(entries)-s.limit:]
+	}
+	s.entries[taskID] = entries
+}
+
+// Entries returns a copy of a task's entries at or above level.
+func (s *LogStore) Entries(taskID string, level slog.Level) []LogEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries := make([]LogEntry, 0, len(s.entries[taskID]))
+	for _, entry := range s.entries[taskID] {
+		var entryLevel slog.Level
+		entryLevel.UnmarshalText([]byte(entry.Level))
+		if entryLevel >= level {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Remove forgets a task's entries.
+func (s *LogStore) Remove(taskID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, taskID)
+}
+
+// NewLogger builds the engine logger. Output goes to stdout, unless another
+// writer is set, and to a size-rotated log file when a file is set. Every record is redacted and records
+// carrying a task_id are also kept in store.
+func NewLogger(options LogOptions, store *LogStore) *slog.Logger {
+	writer := options.Output
+	if writer == nil {
+		writer = os.Stdout
+	}
+	if options.File != "" {
+		writer = io.MultiWriter(os.Stdout, &lumberjack.Logger{
+			Filename:   options.File,
+			MaxSize:    options.MaxSizeMB,
+			MaxBackups: options.MaxBackups,
+			MaxAge:     options.MaxAgeDays,
+		})
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: options.Level}
+	var handler slog.Handler = slog.NewTextHandler(writer, handlerOptions)
+	if options.JSON {
+		handler = slog.NewJSONHandler(writer, handlerOptions)
+	}
+
+	return slog.New(&redactingHandler{next: handler, store: store})
+}
+
+// redactingHandler scrubs secrets from records before passing them on, and
+// copies records of tasks into a LogStore.
+type redactingHandler struct {
+	next  slog.Handler
+	store *LogStore
+	bound []slog.Attr
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	// Task records are kept in the store at every level, even when the
+	// output is less verbose.
+	return true
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+
+	if h.store != nil {
+		h.keep(redacted)
+	}
+	if !h.next.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, redacted)
+}
+
+// keep stores a record under its task ID, if it has one.
+func (h *redactingHandler) keep(record slog.Record) {
+	entry := LogEntry{
+		Time:    record.Time,
+		Level:   record.Level.String(),
+		Message: record.Message,
+		Attrs:   make(map[string]any),
+	}
+	var taskID string
+	collect := func(attr slog.Attr) bool {
+		switch attr.Key {
+		case "task_id":
+			taskID = attr.Value.String()
+		case "step":
+			entry.Step = attr.Value.String()
+		default:
+			value := attr.Value.Resolve()
+			if value.Kind() == slog.KindDuration {
+				entry.Attrs[attr.Key] = value.Duration().String()
+			} else {
+				entry.Attrs[attr.Key] = value.Any()
+			}
+		}
+		return true
+	}
+	for _, attr := range h.bound {
+		collect(attr)
+	}
+	record.Attrs(collect)
+
+	if taskID != "" {
+		if len(entry.Attrs) == 0 {
+			entry.Attrs = nil
+		}
+		h.store.add(taskID, entry)
+	}
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redactAttr(attr)
+	}
+	return &redactingHandler{
+		next:  h.next.WithAttrs(redacted),
+		store: h.store,
+		bound: append(append([]slog.Attr{}, h.bound...), redacted...),
+	}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name), store: h.store, bound: h.bound}
+}
+
+// sensitiveKeys are attribute and field names whose values are never logged.
+var sensitiveKeys = []string{
+	"password", "j_password", "samlresponse", "samlrequest", "relaystate",
+	"cookie", "set-cookie", "authorization",
+	"studentid", "bannerid", "pidm", "name", "firstname", "lastname", "email", "emailaddress",
+}
+
+var redactionPatterns = func() []*regexp.Regexp {
+	keys := strings.Join(sensitiveKeys, "|")
+	return []*regexp.Regexp{
+		// form bodies and query strings: key=value
+		regexp.MustCompile(`(?i)\b(` + keys + `)=([^&\s"']+)`),
+		// JSON string fields: "key": "value"
+		regexp.MustCompile(`(?i)"(` + keys + `)"\s*:\s*"(?:[^"\\]|\\.)*"`),
+		// HTML hidden inputs: name="key" value="value"
+		regexp.MustCompile(`(?i)name=["'](` + keys + `)["']\s+value=["'][^"']*["']`),
+		// Cookie headers
+		regexp.MustCompile(`(?i)\b(cookie|set-cookie):\s*[^\n]*`),
+	}
+}()
+
+// Redact replaces secrets and personal data in text with [REDACTED].
+func Redact(text string) string {
+	text = redactionPatterns[0].ReplaceAllString(text, "$1=[REDACTED]")
+	text = redactionPatterns[1].ReplaceAllString(text, `"$1":"[REDACTED]"`)
+	text = redactionPatterns[2].ReplaceAllString(text, `name="$1" value="[REDACTED]"`)
+	text = redactionPatterns[3].ReplaceAllString(text, "$1: [REDACTED]")
+	return text
+}
+
+// redactAttr redacts an attribute by key and scrubs its string value.
+func redactAttr(attr slog.Attr) slog.Attr {
+	if contains(sensitiveKeys, strings.ToLower(attr.Key)) {
+		return slog.String(attr.Key, "[REDACTED]")
+	}
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, Redact(err.Error()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// log returns the task's logger tagged with its ID and current step.
+func (t *Task) log() *slog.Logger {
+	return slog.Default().With("task_id", t.ID, "step", t.step)
+}
+
+// beginStep names the step the task is working on and reports it as status.
+func (t *Task) beginStep(step string) {
+	t.step = step
+	t.SetStatus(step)
+}
@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{
+			"form body",
+			"j_username=student&j_password=hunter2&_eventId_proceed=",
+			"j_username=student&j_password=[REDACTED]&_eventId_proceed=",
+		},
+		{
+			"query string",
+			"/ssb/register?term=202442&studentId=20123456",
+			"/ssb/register?term=202442&studentId=[REDACTED]",
+		},
+		{
+			"JSON fields",
+			`{"firstName": "Ada", "term": "202442", "emailAddress": "ada@example.edu", "password": "a\"b"}`,
+			`{"firstName":"[REDACTED]", "term": "202442", "emailAddress":"[REDACTED]", "password":"[REDACTED]"}`,
+		},
+		{
+			"hidden inputs",
+			`<input type="hidden" name="SAMLResponse" value="PHNhbWxwOlJlc3BvbnNl"/><input name='RelayState' value='cookie:1'/>`,
+			`<input type="hidden" name="SAMLResponse" value="[REDACTED]"/><input name="RelayState" value="[REDACTED]"/>`,
+		},
+		{
+			"cookie headers",
+			"Cookie: JSESSIONID=abc; SESSION=def\nSet-Cookie: JSESSIONID=ghi; Path=/\nHost: banner.example.edu",
+			"Cookie: [REDACTED]\nSet-Cookie: [REDACTED]\nHost: banner.example.edu",
+		},
+		{
+			"nothing sensitive",
+			"username=student&term=202442",
+			"username=student&term=202442",
+		},
+	}
+	for _, tc := range tests {
+		if got := Redact(tc.text); got != tc.want {
+			t.Errorf("%s: Redact(%q) = %q, want %q", tc.name, tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	tests := []struct {
+		attr slog.Attr
+		want string
+	}{
+		{slog.String("password", "hunter2"), "[REDACTED]"},
+		{slog.String("Authorization", "Bearer abc"), "[REDACTED]"},
+		{slog.Int("pidm", 1234), "[REDACTED]"},
+		{slog.String("body", "term=202442&bannerId=A0001"), "term=202442&bannerId=[REDACTED]"},
+		{slog.Any("error", errors.New("login failed for email=ada@example.edu")), "login failed for email=[REDACTED]"},
+		{slog.Group("request", slog.String("cookie", "JSESSIONID=abc"), slog.String("crn", "12345")), "[cookie=[REDACTED] crn=12345]"},
+		{slog.Int("status", 200), "200"},
+	}
+	for _, tc := range tests {
+		if got := redactAttr(tc.attr).Value.String(); got != tc.want {
+			t.Errorf("redactAttr(%v) = %q, want %q", tc.attr, got, tc.want)
+		}
+	}
+}
+
+func TestLoggerRedactsOutputAndStore(t *testing.T) {
+	var output bytes.Buffer
+	store := NewLogStore(10)
+	logger := NewLogger(LogOptions{Output: &output, Level: slog.LevelInfo}, store)
+
+	logger.With("task_id", "t1", "password", "hunter2").
+		Debug("posting j_password=hunter2", "step", "login", "email", "ada@example.edu")
+	logger.With("task_id", "t1").Info("signed in", "response", `{"studentId": "20123456"}`)
+
+	if text := output.String(); strings.Contains(text, "hunter2") || strings.Contains(text, "20123456") ||
+		!strings.Contains(text, "signed in") {
+		t.Errorf("output = %q, want only the redacted info record", text)
+	}
+	if strings.Contains(output.String(), "posting") {
+		t.Errorf("output = %q, want debug records left out", output.String())
+	}
+
+	entries := store.Entries("t1", slog.LevelDebug)
+	if len(entries) != 2 {
+		t.Fatalf("stored %d entries, want both records", len(entries))
+	}
+	if entry := entries[0]; entry.Message != "posting j_password=[REDACTED]" || entry.Step != "login" ||
+		entry.Attrs["password"] != "[REDACTED]" || entry.Attrs["email"] != "[REDACTED]" {
+		t.Errorf("debug entry = %+v, want redacted message and attributes", entry)
+	}
+	if got := entries[1].Attrs["response"]; got != `{"studentId":"[REDACTED]"}` {
+		t.Errorf("response attribute = %q, want the student ID redacted", got)
+	}
+}
@@ -0,0 +1,141 @@
+package tasks
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_requests_total",
+		Help: "Requests sent to Banner, SSO and notifier endpoints by endpoint, method and status code.",
+	}, []string{"endpoint", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "veil_request_duration_seconds",
+		Help:    "Latency of requests sent to Banner, SSO and notifier endpoints.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"endpoint", "method"})
+
+	loginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_logins_total",
+		Help: "Completed login attempts by result.",
+	}, []string{"result"})
+
+	watchPollsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_watch_polls_total",
+		Help: "Enrollment polls made by watch tasks per CRN.",
+	}, []string{"term", "crn"})
+
+	watchSearchPollsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_watch_search_polls_total",
+		Help: "Class searches made by the watch scheduler to poll many CRNs at once, per subject.",
+	}, []string{"term", "subject"})
+
+	watchParseFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_watch_parse_failures_total",
+		Help: "Enrollment polls whose seat counts could not be read per CRN.",
+	}, []string{"term", "crn"})
+
+	seatOpenEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_seat_open_events_total",
+		Help: "Times a watched CRN was seen with an open seat.",
+	}, []string{"term", "crn"})
+
+	registrationOutcomesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_registration_outcomes_total",
+		Help: "Per-CRN registration results returned by batch submissions by status.",
+	}, []string{"status"})
+
+	notificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "veil_notifications_total",
+		Help: "Notifier deliveries by notifier type and result.",
+	}, []string{"notifier", "result"})
+
+	activeTasks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "veil_active_tasks",
+		Help: "Tasks currently running by mode.",
+	}, []string{"mode"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		loginsTotal,
+		watchPollsTotal,
+		watchSearchPollsTotal,
+		watchParseFailuresTotal,
+		seatOpenEventsTotal,
+		registrationOutcomesTotal,
+		notificationsTotal,
+		activeTasks,
+	)
+}
+
+// MetricsHandler serves the engine metrics in the Prometheus text format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// observeRequest records the outcome and latency of one request. A code of
+// zero means the request failed before a response arrived.
+func observeRequest(method string, target *url.URL, code int, duration time.Duration) {
+	endpoint := endpointLabel(target.Host, target.Path)
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+	requestsTotal.WithLabelValues(endpoint, method, status).Inc()
+	requestDuration.WithLabelValues(endpoint, method).Observe(duration.Seconds())
+}
+
+// endpointLabel names an endpoint by host and path. Path segments that look
+// like IDs or tokens, such as those in webhook URLs, are collapsed so the
+// label stays low-cardinality and free of secrets.
+func endpointLabel(host, path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if looksLikeID(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return host + strings.Join(segments, "/")
+}
+
+// looksLikeID reports whether a path segment is an opaque identifier.
+func looksLikeID(segment string) bool {
+	if len(segment) > 24 {
+		return true
+	}
+	digits := 0
+	for _, r := range segment {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	return len(segment) >= 6 && digits*2 >= len(segment)
+}
+
+// observeLogin records a finished login attempt. Logins cut short by a stop
+// are not counted.
+func observeLogin(err error) {
+	switch {
+	case err == nil:
+		loginsTotal.WithLabelValues("success").Inc()
+	case err != errStopped:
+		loginsTotal.WithLabelValues("failure").Inc()
+	}
+}
@@ -0,0 +1,266 @@
+package tasks
+
+import (
+	"errors"
+	"proj/apitypes"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"goquery"
+)
+
+// StatusAwaitingMFA is the status of a task paused on an MFA challenge.
+const StatusAwaitingMFA = "Awaiting MFA"
+
+// MFA methods a challenge can offer.
+const (
+	MFAMethodTOTP = "totp"
+	MFAMethodPush = "push"
+)
+
+// MFATimeout is how long a task waits for an MFA answer before giving up.
+var MFATimeout = 5 * time.Minute
+
+// maxMFAAttempts caps how many answers one sign-in may try.
+const maxMFAAttempts = 3
+
+// ErrMFANotPending is returned when an MFA answer arrives for a task that
+// is not waiting for one.
+var ErrMFANotPending = errors.New("task is not awaiting MFA")
+
+// MFAChallenge is a second factor prompt the task is paused on.
+type MFAChallenge = apitypes.MFAChallenge
+
+// MFAResponse answers a challenge with a one-time code, or confirms that a
+// push was approved on the user's device.
+type MFAResponse = apitypes.MFAResponse
+
+// mfaForm is a challenge and the IdP form that answers it.
+type mfaForm struct {
+	MFAChallenge
+
+	form        *htmlForm
+	codeField   string
+	submitField [2]string
+	pushField   [2]string
+}
+
+var mfaCodePattern = regexp.MustCompile(`^\d{6,8}$`)
+
+// validateMFAResponse checks that the response answers with exactly one
+// method.
+func validateMFAResponse(r *MFAResponse) error {
+	switch {
+	case r.Push && r.Code != "":
+		return &ValidationError{"code", "send either a code or push, not both"}
+	case !r.Push && !mfaCodePattern.MatchString(r.Code):
+		return &ValidationError{"code", "must be a 6-8 digit one-time code"}
+	}
+	return nil
+}
+
+// mfaPrompt hands answers from the API to a task paused on a challenge.
+type mfaPrompt struct {
+	challenge *MFAChallenge
+	answers   chan MFAResponse
+	mutex     sync.Mutex
+}
+
+// open publishes a challenge and returns the channel its answer arrives on.
+func (p *mfaPrompt) open(challenge *MFAChallenge) <-chan MFAResponse {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.challenge = challenge
+	p.answers = make(chan MFAResponse, 1)
+	return p.answers
+}
+
+// close withdraws the current challenge.
+func (p *mfaPrompt) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.challenge = nil
+	p.answers = nil
+}
+
+// pending returns the open challenge, if any.
+func (p *mfaPrompt) pending() *MFAChallenge {
+	if p == nil {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.challenge
+}
+
+// answer delivers a response to the open challenge.
+func (p *mfaPrompt) answer(response MFAResponse) error {
+	if p == nil {
+		return ErrMFANotPending
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.challenge == nil {
+		return ErrMFANotPending
+	}
+	if response.Push && !contains(p.challenge.Methods, MFAMethodPush) {
+		return &ValidationError{"push", "this challenge does not offer push"}
+	}
+	if !response.Push && !contains(p.challenge.Methods, MFAMethodTOTP) {
+		return &ValidationError{"code", "this challenge does not accept a code"}
+	}
+	select {
+	case p.answers <- response:
+		return nil
+	default:
+		return ErrMFANotPending
+	}
+}
+
+// SubmitMFA answers the MFA challenge a running task is paused on.
+func (tm *TaskManager) SubmitMFA(id string, response MFAResponse) error {
+	if err := validateMFAResponse(&response); err != nil {
+		return err
+	}
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	task, exists := tm.Tasks[id]
+	if !exists {
+		return ErrTaskNotFound
+	}
+	return task.mfa.answer(response)
+}
+
+// mfaCodeFields are input names IdPs use for one-time codes.
+var mfaCodeFields = []string{"j_mfa_token", "j_tokennumber", "passcode", "otp", "totp", "token", "code"}
+
+// findMFAChallenge looks for a second factor form on a page. Login forms,
+// which ask for a password, are not challenges.
+func findMFAChallenge(document *goquery.Document, base string) *mfaForm {
+	var challenge *mfaForm
+	document.Find("form").EachWithBreak(func(index int, selection *goquery.Selection) bool {
+		if selection.Find("input[type='password']").Length() > 0 {
+			return true
+		}
+
+		candidate := &mfaForm{}
+		selection.Find("input").Each(func(index int, input *goquery.Selection) {
+			name := input.AttrOr("name", "")
+			if candidate.codeField == "" && name != "" &&
+				(input.AttrOr("autocomplete", "") == "one-time-code" || contains(mfaCodeFields, strings.ToLower(name))) {
+				candidate.codeField = name
+			}
+		})
+		selection.Find("button, input[type='submit']").Each(func(index int, button *goquery.Selection) {
+			name := button.AttrOr("name", "")
+			if name == "" {
+				return
+			}
+			value := button.AttrOr("value", "")
+			label := strings.ToLower(name + " " + value + " " + button.Text())
+			switch {
+			case strings.Contains(label, "push"):
+				candidate.pushField = [2]string{name, value}
+			case candidate.submitField[0] == "":
+				candidate.submitField = [2]string{name, value}
+			}
+		})
+
+		if candidate.codeField != "" {
+			candidate.Methods = append(candidate.Methods, MFAMethodTOTP)
+		}
+		if candidate.pushField[0] != "" {
+			candidate.Methods = append(candidate.Methods, MFAMethodPush)
+		}
+		if len(candidate.Methods) == 0 {
+			return true
+		}
+		form, err := readForm(selection, base)
+		if err != nil {
+			return true
+		}
+		candidate.form = form
+		candidate.Message = strings.TrimSpace(document.Find(".alert-danger, .errors, .error, #msg").First().Text())
+		challenge = candidate
+		return false
+	})
+	return challenge
+}
+
+// completeMFA answers every MFA challenge on the way to the page after
+// login, pausing the task for each answer, and returns that page. Pages
+// without a challenge are returned as they are.
+func (t *Task) completeMFA(document *goquery.Document, base string) (*goquery.Document, error) {
+	for attempt := 0; ; attempt++ {
+		challenge := findMFAChallenge(document, base)
+		if challenge == nil {
+			return document, nil
+		}
+		if attempt == maxMFAAttempts {
+			t.SetStatus("Too many MFA attempts")
+			return nil, errors.New("Too many MFA attempts")
+		}
+
+		answer, err := t.awaitMFA(challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		t.beginStep("Verifying MFA")
+		values := challenge.form.Values
+		if answer.Push {
+			values.Set(challenge.pushField[0], challenge.pushField[1])
+		} else {
+			values.Set(challenge.codeField, answer.Code)
+			if challenge.submitField[0] != "" {
+				values.Set(challenge.submitField[0], challenge.submitField[1])
+			}
+		}
+
+		headers := t.headers(acceptHTML, contentForm)
+		response, err := t.DoReq(t.MakeReq("POST", challenge.form.Action, headers, []byte(values.Encode())))
+		if err != nil {
+			discardResp(response)
+			return nil, err
+		}
+		body, _ := readBody(response)
+		document, err = goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+		if err != nil {
+			return nil, err
+		}
+		base = challenge.form.Action
+	}
+}
+
+// awaitMFA pauses the task until the challenge is answered through
+// SubmitMFA, the task is stopped, or MFATimeout passes.
+func (t *Task) awaitMFA(challenge *mfaForm) (MFAResponse, error) {
+	if t.mfa == nil {
+		t.SetStatus("MFA required")
+		return MFAResponse{}, errors.New("MFA required")
+	}
+	answers := t.mfa.open(&challenge.MFAChallenge)
+	defer t.mfa.close()
+
+	t.SetStatus(StatusAwaitingMFA)
+	t.log().Info("awaiting MFA", "methods", strings.Join(challenge.Methods, ","), "message", challenge.Message)
+	t.events.Publish(Event{Type: EventMFARequired, TaskID: t.ID, Status: StatusAwaitingMFA, MFA: &challenge.MFAChallenge})
+
+	var done <-chan struct{}
+	if t.ctx != nil {
+		done = t.ctx.Done()
+	}
+	timer := time.NewTimer(MFATimeout)
+	defer timer.Stop()
+	select {
+	case answer := <-answers:
+		return answer, nil
+	case <-timer.C:
+		t.SetStatus("MFA timed out")
+		return MFAResponse{}, errors.New("MFA timed out")
+	case <-done:
+		return MFAResponse{}, errStopped
+	}
+}
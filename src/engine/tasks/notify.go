@@ -0,0 +1,178 @@
+package tasks
+
+import (
+	"fmt"
+	"proj/apitypes"
+	"time"
+)
+
+// Seat states Notify tasks report changes between.
+const (
+	SeatsFull         = apitypes.SeatsFull
+	SeatsWaitlistOpen = apitypes.SeatsWaitlistOpen
+	SeatsOpen         = apitypes.SeatsOpen
+)
+
+// NotifyConfirmations is how many polls in a row must agree on a new seat
+// state before a Notify task reports the change, so a seat that opens and
+// closes within one poll does not alert.
+var NotifyConfirmations = 2
+
+// NotifyCooldown is how long a Notify task stays quiet about a change it
+// already reported, so a section flapping between two states alerts once.
+var NotifyCooldown = 15 * time.Minute
+
+// SeatChange is a confirmed move of a section between seat states.
+type SeatChange = apitypes.SeatChange
+
+// seatTracker debounces the seat states of one section.
+type seatTracker struct {
+	state      string
+	enrollment *Enrollment
+	pending    string
+	streak     int
+	reported   map[string]time.Time
+}
+
+// observe records a poll and returns the change it confirms, if any, and
+// whether the change should be reported or was reported too recently.
+func (s *seatTracker) observe(crn string, enrollment *Enrollment, now time.Time) (*SeatChange, bool) {
+	state := enrollment.State()
+	switch {
+	case s.state == "":
+		s.state, s.enrollment = state, enrollment
+		return nil, false
+	case state == s.state:
+		s.enrollment, s.pending, s.streak = enrollment, "", 0
+		return nil, false
+	case state == s.pending:
+		s.streak++
+	default:
+		s.pending, s.streak = state, 1
+	}
+	if s.streak < NotifyConfirmations {
+		return nil, false
+	}
+
+	change := &SeatChange{CRN: crn, From: s.state, To: state, Before: s.enrollment, After: enrollment}
+	s.state, s.enrollment, s.pending, s.streak = state, enrollment, "", 0
+	if s.reported == nil {
+		s.reported = make(map[string]time.Time)
+	}
+	transition := change.From + ">" + change.To
+	if last, seen := s.reported[transition]; seen && now.Sub(last) < NotifyCooldown {
+		return change, false
+	}
+	s.reported[transition] = now
+	return change, true
+}
+
+// seatStateNames are how seat states read in statuses and notifications.
+var seatStateNames = map[string]string{
+	SeatsFull:         "Full",
+	SeatsWaitlistOpen: "Waitlist open",
+	SeatsOpen:         "Seats open",
+}
+
+// countsField formats seat counts for a notification.
+func countsField(name string, enrollment *Enrollment) Field {
+	return Field{
+		Name: name,
+		Value: fmt.Sprintf("Seats: %d\nWaitlist: %d/%d (%d open)",
+			enrollment.SeatsAvailable, enrollment.WaitCount, enrollment.WaitCapacity, enrollment.WaitAvailable),
+		Inline: true,
+	}
+}
+
+// Notify watches the task's sections and reports when they move between
+// full, waitlist open and seats open, without signing up.
+func (t *Task) Notify() error {
+	t.setPhase(PhaseWatching)
+	t.step = "Notifying"
+	watches := t.watches
+	if watches == nil {
+		watches = NewWatchScheduler()
+	}
+	var stopped <-chan struct{}
+	if t.ctx != nil {
+		stopped = t.ctx.Done()
+	}
+
+	type crnObservation struct {
+		crn         string
+		observation SeatObservation
+	}
+	observations := make(chan crnObservation)
+	for _, crn := range t.CRNs {
+		subscription, unsubscribe := watches.Subscribe(t, t.Term, crn)
+		defer unsubscribe()
+		go func(crn string) {
+			for {
+				select {
+				case observation := <-subscription:
+					select {
+					case observations <- crnObservation{crn, observation}:
+					case <-stopped:
+						return
+					}
+				case <-stopped:
+					return
+				}
+			}
+		}(crn)
+	}
+
+	trackers := make(map[string]*seatTracker, len(t.CRNs))
+	for _, crn := range t.CRNs {
+		trackers[crn] = &seatTracker{}
+	}
+	for {
+		var next crnObservation
+		select {
+		case next = <-observations:
+		case <-stopped:
+			return errStopped
+		}
+		crn, observation := next.crn, next.observation
+		if observation.Err != nil {
+			t.log().Warn("notify poll failed", "crn", crn, "error", observation.Err, "retry_in", observation.Wait)
+			continue
+		}
+
+		tracker := trackers[crn]
+		first := tracker.state == ""
+		change, report := tracker.observe(crn, observation.Enrollment, observation.At)
+		if first {
+			t.SetStatus(fmt.Sprintf("%s: %s", crn, seatStateNames[tracker.state]))
+		}
+		if change == nil {
+			continue
+		}
+		if !report {
+			t.log().Info("seat change already reported", "crn", crn, "from", change.From, "to", change.To)
+			continue
+		}
+		t.reportSeatChange(change)
+	}
+}
+
+// reportSeatChange publishes a seat change and sends it to the webhook.
+func (t *Task) reportSeatChange(change *SeatChange) {
+	status := fmt.Sprintf("%s: %s", change.CRN, seatStateNames[change.To])
+	t.log().Info("seat change", "crn", change.CRN, "from", change.From, "to", change.To,
+		"seats_before", change.Before.SeatsAvailable, "seats_after", change.After.SeatsAvailable)
+	if change.To == SeatsOpen {
+		seatOpenEventsTotal.WithLabelValues(t.Term, change.CRN).Inc()
+	}
+	t.SetStatus(status)
+	t.events.Publish(Event{Type: EventSeatChange, TaskID: t.ID, Status: status, SeatChange: change})
+	t.sendEmbed(Embed{
+		Title:       fmt.Sprintf("CRN %s: %s", change.CRN, seatStateNames[change.To]),
+		Description: fmt.Sprintf("%s → %s", seatStateNames[change.From], seatStateNames[change.To]),
+		Fields: []Field{
+			countsField("Before", change.Before),
+			countsField("After", change.After),
+			{Name: "Term", Value: t.Term, Inline: true},
+		},
+	})
+}
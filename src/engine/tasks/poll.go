@@ -0,0 +1,196 @@
+package tasks
+
+import (
+	"fmt"
+	"math/rand"
+	"proj/apitypes"
+	"regexp"
+	"strconv"
+	"time"
+
+	http "github.com/bogdanfinn/fhttp"
+)
+
+// Polling defaults, used for the fields a PollPolicy leaves empty.
+const (
+	DefaultPollInterval     = 3 * time.Second
+	DefaultPollFastInterval = 1 * time.Second
+	DefaultPollFastWindow   = 15 * time.Minute
+	DefaultPollMaxBackoff   = 2 * time.Minute
+	DefaultPollJitter       = 0.2
+)
+
+// MinPollInterval is the shortest interval a task may poll Banner at.
+const MinPollInterval = 250 * time.Millisecond
+
+// DefaultFastTimes are when seats churn most: midnight, when Banner's nightly
+// jobs drop students who have not paid.
+var DefaultFastTimes = []string{"00:00"}
+
+// fastTimePattern matches a daily "HH:MM" or an hourly ":MM".
+var fastTimePattern = regexp.MustCompile(`^(?:([01]\d|2[0-3]))?:([0-5]\d)$`)
+
+// PollPolicy controls how often a Watch task polls for seats.
+type PollPolicy = apitypes.PollPolicy
+
+// validatePolling checks a policy's durations and times.
+func validatePolling(p *PollPolicy) error {
+	for _, field := range []struct {
+		name, value string
+		min         time.Duration
+	}{
+		{"interval", p.Interval, MinPollInterval},
+		{"fast_interval", p.FastInterval, MinPollInterval},
+		{"fast_window", p.FastWindow, 0},
+		{"max_backoff", p.MaxBackoff, MinPollInterval},
+	} {
+		if field.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(field.value)
+		if err != nil {
+			return &ValidationError{"polling." + field.name, fmt.Sprintf("%q is not a duration such as 2s", field.value)}
+		}
+		if duration < field.min {
+			return &ValidationError{"polling." + field.name, fmt.Sprintf("must be at least %s", field.min)}
+		}
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return &ValidationError{"polling.jitter", "must be between 0 and 1"}
+	}
+	for _, fastTime := range p.FastTimes {
+		if !fastTimePattern.MatchString(fastTime) {
+			return &ValidationError{"polling.fast_times", fmt.Sprintf("%q is not HH:MM or :MM", fastTime)}
+		}
+	}
+	return nil
+}
+
+// poller paces a task's polls: jittered intervals, faster near churn times
+// and exponential backoff while polls fail.
+type poller struct {
+	interval     time.Duration
+	fastInterval time.Duration
+	fastWindow   time.Duration
+	fastTimes    []string
+	maxBackoff   time.Duration
+	jitter       float64
+	location     *time.Location
+	failures     int
+	retryAfter   time.Duration
+}
+
+// newPoller resolves the task's policy against the defaults.
+func (t *Task) newPoller() *poller {
+	policy := PollPolicy{}
+	if t.Polling != nil {
+		policy = *t.Polling
+	}
+	p := &poller{
+		interval:     durationOr(policy.Interval, DefaultPollInterval),
+		fastInterval: durationOr(policy.FastInterval, DefaultPollFastInterval),
+		fastWindow:   durationOr(policy.FastWindow, DefaultPollFastWindow),
+		fastTimes:    policy.FastTimes,
+		maxBackoff:   durationOr(policy.MaxBackoff, DefaultPollMaxBackoff),
+		jitter:       policy.Jitter,
+		location:     t.institution().Location(),
+	}
+	if p.fastTimes == nil {
+		p.fastTimes = DefaultFastTimes
+	}
+	if p.jitter == 0 {
+		p.jitter = DefaultPollJitter
+	}
+	return p
+}
+
+// durationOr parses a validated duration, falling back when it is empty.
+func durationOr(value string, fallback time.Duration) time.Duration {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration
+	}
+	return fallback
+}
+
+// succeeded resets the backoff after a good poll.
+func (p *poller) succeeded() {
+	p.failures, p.retryAfter = 0, 0
+}
+
+// failed backs off after a failed poll. retryAfter is how long Banner asked
+// to be left alone, if it said.
+func (p *poller) failed(retryAfter time.Duration) {
+	p.failures++
+	p.retryAfter = retryAfter
+}
+
+// next returns how long to wait before the next poll.
+func (p *poller) next(now time.Time) time.Duration {
+	interval := p.interval
+	if p.fast(now) && p.fastInterval < interval {
+		interval = p.fastInterval
+	}
+	if p.failures > 0 {
+		interval <<= min(p.failures, 16)
+		if interval > p.maxBackoff || interval <= 0 {
+			interval = p.maxBackoff
+		}
+		interval = max(interval, p.retryAfter)
+	}
+	if p.jitter > 0 {
+		spread := float64(interval) * p.jitter
+		interval += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+	return max(interval, MinPollInterval)
+}
+
+// fast reports whether now falls within the fast window after a churn time.
+func (p *poller) fast(now time.Time) bool {
+	local := now.In(p.location)
+	for _, fastTime := range p.fastTimes {
+		match := fastTimePattern.FindStringSubmatch(fastTime)
+		if match == nil {
+			continue
+		}
+		minute, _ := strconv.Atoi(match[2])
+		start := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), minute, 0, 0, p.location)
+		if match[1] != "" {
+			hour, _ := strconv.Atoi(match[1])
+			start = time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, p.location)
+		}
+		if start.After(local) {
+			if match[1] != "" {
+				start = start.AddDate(0, 0, -1)
+			} else {
+				start = start.Add(-time.Hour)
+			}
+		}
+		if local.Sub(start) < p.fastWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// ThrottledError is a poll Banner refused with 429 or 503.
+type ThrottledError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("Banner throttled the poll with %d", e.StatusCode)
+}
+
+// throttled returns a ThrottledError for 429 and 503 responses, honouring a
+// Retry-After given in seconds.
+func throttled(response *http.Response) error {
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable {
+		return nil
+	}
+	err := &ThrottledError{StatusCode: response.StatusCode}
+	if seconds, parseErr := strconv.Atoi(response.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return err
+}
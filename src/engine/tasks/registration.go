@@ -0,0 +1,157 @@
+package tasks
+
+import (
+	"fmt"
+	"proj/apitypes"
+	"strconv"
+	"strings"
+)
+
+// Outcomes of submitting a CRN for registration.
+const (
+	ResultRegistered = apitypes.ResultRegistered
+	ResultWaitlisted = apitypes.ResultWaitlisted
+	ResultFailed     = apitypes.ResultFailed
+	ResultDropped    = apitypes.ResultDropped
+	ResultPending    = apitypes.ResultPending
+	ResultUnknown    = apitypes.ResultUnknown
+)
+
+// RegistrationResult is what Banner did with one CRN of a batch submission.
+type RegistrationResult = apitypes.RegistrationResult
+
+// classifyRegistrationStatus maps Banner's status description, or its
+// course registration status code when the description is unfamiliar, to an
+// outcome.
+func classifyRegistrationStatus(description, code string, errors int) string {
+	lower := strings.ToLower(description)
+	switch {
+	case strings.Contains(lower, "error"):
+		return ResultFailed
+	case strings.Contains(lower, "wait"):
+		return ResultWaitlisted
+	case strings.Contains(lower, "drop"), strings.Contains(lower, "delete"):
+		return ResultDropped
+	case strings.Contains(lower, "pending"):
+		return ResultPending
+	case strings.Contains(lower, "registered"), strings.Contains(lower, "enrolled"):
+		return ResultRegistered
+	}
+	switch strings.ToUpper(code) {
+	case "RE", "RW":
+		return ResultRegistered
+	case "WL":
+		return ResultWaitlisted
+	case "DD", "DW":
+		return ResultDropped
+	}
+	if errors > 0 {
+		return ResultFailed
+	}
+	return ResultUnknown
+}
+
+// bannerNumber reads a number Banner sends as a number or a string.
+func bannerNumber(value any) *float64 {
+	switch value := value.(type) {
+	case float64:
+		return &value
+	case string:
+		if number, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return &number
+		}
+	}
+	return nil
+}
+
+// registrationResults maps every updated item of a batch response to a
+// result.
+func registrationResults(changes *Changes) []RegistrationResult {
+	results := make([]RegistrationResult, 0, len(changes.Data.Update))
+	for _, data := range changes.Data.Update {
+		result := RegistrationResult{
+			CRN:                    data.CourseReferenceNumber,
+			Title:                  data.CourseTitle,
+			StatusDescription:      data.StatusDescription,
+			AddDate:                data.AddDate,
+			RegistrationStatusDate: data.RegistrationStatusDate,
+			StartDate:              data.StartDate,
+			CompletionDate:         data.CompletionDate,
+		}
+		seen := make(map[string]bool)
+		addError := func(message string) {
+			if message = strings.TrimSpace(message); message != "" && !seen[message] {
+				seen[message] = true
+				result.Errors = append(result.Errors, message)
+			}
+		}
+		for _, crnError := range data.CrnErrors {
+			addError(crnError.Message)
+		}
+		for _, message := range data.Messages {
+			if strings.EqualFold(message.Type, "error") {
+				addError(message.Message)
+			}
+		}
+		if message, ok := data.Message.(string); ok && data.ErrorFlag != "" {
+			addError(message)
+		}
+
+		result.Status = classifyRegistrationStatus(data.StatusDescription, data.CourseRegistrationStatus, len(result.Errors))
+		if result.CreditHours = bannerNumber(data.CreditHour); result.CreditHours == nil {
+			result.CreditHours = bannerNumber(data.CreditHours.CreditHourLow)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// setResults records Banner's outcome for each CRN of the task's run.
+func (t *Task) setResults(results []RegistrationResult) {
+	t.state.Lock()
+	t.Results = results
+	t.state.Unlock()
+}
+
+// reportResults records the results for the task's CRNs, counts them and
+// notifies about each. The task's status is the outcome of its only CRN,
+// or of each CRN in turn.
+func (t *Task) reportResults(results []RegistrationResult) {
+	wanted := make(map[string]bool, len(t.CRNs))
+	for _, crn := range t.CRNs {
+		wanted[crn] = true
+	}
+	reported := make([]RegistrationResult, 0, len(t.CRNs))
+	for _, result := range results {
+		if !wanted[result.CRN] {
+			continue
+		}
+		reported = append(reported, result)
+		if !result.Skipped {
+			registrationOutcomesTotal.WithLabelValues(result.Status).Inc()
+		}
+		if result.Status == ResultUnknown {
+			t.log().Warn("unknown registration status", "crn", result.CRN, "status", result.StatusDescription)
+		}
+		title := result.Title
+		if title == "" {
+			title = result.CRN
+		}
+		t.SendNotification(title, result.Message())
+	}
+
+	t.setResults(reported)
+
+	switch len(reported) {
+	case 0:
+		t.SetStatus("No registration results")
+	case 1:
+		t.SetStatus(reported[0].Message())
+	default:
+		statuses := make([]string, 0, len(reported))
+		for _, result := range reported {
+			statuses = append(statuses, fmt.Sprintf("%s: %s", result.CRN, result.Message()))
+		}
+		t.SetStatus(strings.Join(statuses, ", "))
+	}
+}
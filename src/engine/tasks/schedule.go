@@ -0,0 +1,209 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"proj/apitypes"
+	"time"
+)
+
+// weekdays are the day flags of a Banner meeting time, in order.
+var weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// MeetingTime is when and where a class meets.
+type MeetingTime = apitypes.MeetingTime
+
+// RegisteredClass is a class on an account's schedule.
+type RegisteredClass = apitypes.RegisteredClass
+
+// ClassSchedule is what an account is registered for in a term.
+type ClassSchedule = apitypes.ClassSchedule
+
+type registeredClasses struct {
+	Success bool `json:"success"`
+	Data    []struct {
+		CourseReferenceNumber    string `json:"courseReferenceNumber"`
+		CourseTitle              string `json:"courseTitle"`
+		Subject                  string `json:"subject"`
+		CourseNumber             string `json:"courseNumber"`
+		CourseRegistrationStatus string `json:"courseRegistrationStatus"`
+		StatusDescription        string `json:"statusDescription"`
+		WaitlistPosition         any    `json:"waitlistPosition"`
+		CreditHour               any    `json:"creditHour"`
+	} `json:"data"`
+	Message string `json:"message"`
+}
+
+type scheduleDetails struct {
+	Fmt []struct {
+		MeetingTime struct {
+			BeginTime              string `json:"beginTime"`
+			EndTime                string `json:"endTime"`
+			Building               string `json:"building"`
+			Room                   string `json:"room"`
+			MeetingTypeDescription string `json:"meetingTypeDescription"`
+			StartDate              string `json:"startDate"`
+			EndDate                string `json:"endDate"`
+			Monday                 bool   `json:"monday"`
+			Tuesday                bool   `json:"tuesday"`
+			Wednesday              bool   `json:"wednesday"`
+			Thursday               bool   `json:"thursday"`
+			Friday                 bool   `json:"friday"`
+			Saturday               bool   `json:"saturday"`
+			Sunday                 bool   `json:"sunday"`
+		} `json:"meetingTime"`
+	} `json:"fmt"`
+}
+
+// clockTime formats Banner's HHMM as HH:MM.
+func clockTime(hhmm string) string {
+	if len(hhmm) != 4 {
+		return hhmm
+	}
+	return hhmm[:2] + ":" + hhmm[2:]
+}
+
+// FetchSchedule reads the classes the signed in task is registered for in
+// its term, with their meeting times. The term must already be selected,
+// as FetchEligibility does.
+func (t *Task) FetchSchedule() (*ClassSchedule, error) {
+	schedule, err := t.fetchRegisteredClasses()
+	if err != nil {
+		return nil, err
+	}
+	for i := range schedule.Classes {
+		class := &schedule.Classes[i]
+		if class.Meetings, err = t.fetchMeetingTimes(class.CRN); err != nil {
+			return nil, err
+		}
+	}
+	return schedule, nil
+}
+
+// fetchRegisteredClasses reads the schedule like FetchSchedule, in one
+// request and without meeting times.
+func (t *Task) fetchRegisteredClasses() (*ClassSchedule, error) {
+	headers := t.headers(acceptJSON, "")
+	query := url.Values{"term": {t.Term}, "uniqueSessionId": {t.Session.UniqueSessionId}}
+	response, err := t.DoReq(t.MakeReq("GET", t.institution().bannerURL("/ssb/classRegistration/getRegisteredClasses?"+query.Encode()), headers, nil))
+	if err != nil {
+		discardResp(response)
+		return nil, err
+	}
+	body, _ := readBody(response)
+	t.log().Debug("registered classes response", "body", string(body))
+
+	var registered registeredClasses
+	if err := json.Unmarshal(body, &registered); err != nil {
+		return nil, err
+	}
+	if !registered.Success {
+		return nil, fmt.Errorf("Banner did not return the schedule: %s", registered.Message)
+	}
+
+	schedule := &ClassSchedule{
+		Term:        t.Term,
+		Institution: t.institution().ID,
+		Classes:     make([]RegisteredClass, 0, len(registered.Data)),
+		CheckedAt:   time.Now().UTC(),
+	}
+	for _, data := range registered.Data {
+		class := RegisteredClass{
+			CRN:               data.CourseReferenceNumber,
+			Title:             data.CourseTitle,
+			Subject:           data.Subject,
+			CourseNumber:      data.CourseNumber,
+			Status:            classifyRegistrationStatus(data.StatusDescription, data.CourseRegistrationStatus, 0),
+			StatusDescription: data.StatusDescription,
+			CreditHours:       bannerNumber(data.CreditHour),
+		}
+		if position := bannerNumber(data.WaitlistPosition); position != nil {
+			class.WaitlistPosition = int(*position)
+		}
+		schedule.Classes = append(schedule.Classes, class)
+	}
+	return schedule, nil
+}
+
+// fetchMeetingTimes reads the meeting times of a CRN from its schedule
+// details.
+func (t *Task) fetchMeetingTimes(crn string) ([]MeetingTime, error) {
+	headers := t.headers(acceptJSON, "")
+	query := url.Values{"term": {t.Term}, "courseReferenceNumber": {crn}}
+	response, err := t.DoReq(t.MakeReq("GET", t.institution().bannerURL("/ssb/classRegistration/getScheduleDetails?"+query.Encode()), headers, nil))
+	if err != nil {
+		discardResp(response)
+		return nil, err
+	}
+	body, _ := readBody(response)
+	t.log().Debug("schedule details response", "crn", crn, "body", string(body))
+
+	var details scheduleDetails
+	if err := json.Unmarshal(body, &details); err != nil {
+		return nil, err
+	}
+	meetings := make([]MeetingTime, 0, len(details.Fmt))
+	for _, meeting := range details.Fmt {
+		slot := meeting.MeetingTime
+		flags := []bool{slot.Monday, slot.Tuesday, slot.Wednesday, slot.Thursday, slot.Friday, slot.Saturday, slot.Sunday}
+		days := make([]string, 0, len(flags))
+		for i, meets := range flags {
+			if meets {
+				days = append(days, weekdays[i])
+			}
+		}
+		meetings = append(meetings, MeetingTime{
+			Days:      days,
+			Start:     clockTime(slot.BeginTime),
+			End:       clockTime(slot.EndTime),
+			Building:  slot.Building,
+			Room:      slot.Room,
+			Type:      slot.MeetingTypeDescription,
+			StartDate: slot.StartDate,
+			EndDate:   slot.EndDate,
+		})
+	}
+	return meetings, nil
+}
+
+// CheckSchedule signs in with a vault account and reads what it is
+// registered for in the term.
+func (tm *TaskManager) CheckSchedule(ctx context.Context, account, institution, term string) (*ClassSchedule, error) {
+	task, err := tm.accountProbe("schedule", account, institution, term)
+	if err != nil {
+		return nil, err
+	}
+	return task.checkSchedule(ctx)
+}
+
+// checkSchedule signs a probe task in and fetches its schedule.
+func (t *Task) checkSchedule(ctx context.Context) (*ClassSchedule, error) {
+	t.ctx, t.cancel = context.WithTimeout(ctx, EligibilityTimeout)
+	defer t.cancel()
+	if err := t.CheckLogin(); err != nil {
+		return nil, err
+	}
+	// Selecting the term is all that is needed; a hold does not hide the
+	// schedule.
+	if _, err := t.FetchEligibility(); err != nil {
+		return nil, err
+	}
+	if err := t.VisitClassRegistration(); err != nil {
+		return nil, err
+	}
+	return t.FetchSchedule()
+}
+
+// currentSchedule reads the task's schedule, without meeting times, to skip
+// the CRNs it already holds. Failing to read it only costs the skipping, so
+// it returns nil rather than an error.
+func (t *Task) currentSchedule() *ClassSchedule {
+	schedule, err := t.fetchRegisteredClasses()
+	if err != nil {
+		t.log().Warn("reading current schedule", "error", err)
+		return nil
+	}
+	return schedule
+}
@@ -0,0 +1,194 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"proj/apitypes"
+)
+
+// SearchQuery narrows a class search to a subject and optional course number.
+type SearchQuery = apitypes.SearchQuery
+
+// SelectSearchTerm tells Banner which term the following searches apply to.
+func (t *Task) SelectSearchTerm() error {
+	headers := t.headers(acceptAny, contentForm)
+
+	values := url.Values{
+		"term":            {t.Term},
+		"studyPath":       {},
+		"studyPathText":   {},
+		"startDatepicker": {},
+		"endDatepicker":   {},
+		"uniqueSessionId": {t.Session.UniqueSessionId},
+	}
+
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().bannerURL("/ssb/term/search?mode=search"), headers, []byte(values.Encode())))
+	if err != nil {
+		discardResp(response)
+		return err
+	}
+	discardResp(response)
+	return nil
+}
+
+// ResetSearch clears the server-side search form so the next query is not
+// filtered by the previous one.
+func (t *Task) ResetSearch() error {
+	headers := t.headers(acceptAny, "")
+
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().bannerURL("/ssb/classSearch/resetDataForm"), headers, nil))
+	if err != nil {
+		discardResp(response)
+		return err
+	}
+	discardResp(response)
+	return nil
+}
+
+// FetchSearchResults runs one class search and returns the raw Banner result.
+func (t *Task) FetchSearchResults(subject, courseNumber string) (*Courses, error) {
+	headers := t.headers(acceptXHR, "")
+
+	values := url.Values{
+		"txt_subject":      {subject},
+		"txt_courseNumber": {courseNumber},
+		"txt_term":         {t.Term},
+		"startDatepicker":  {},
+		"endDatepicker":    {},
+		"uniqueSessionId":  {t.Session.UniqueSessionId},
+		"pageOffset":       {"0"},
+		"pageMaxSize":      {"500"},
+		"sortColumn":       {"subjectDescription"},
+		"sortDirection":    {"asc"},
+	}
+
+	searchURL := t.institution().bannerURL("/ssb/searchResults/searchResults?" + values.Encode())
+	response, err := t.DoReq(t.MakeReq("GET", searchURL, headers, nil))
+	if err != nil {
+		discardResp(response)
+		return nil, err
+	}
+	defer discardResp(response)
+	if err := throttled(response); err != nil {
+		return nil, err
+	}
+
+	body, _ := readBody(response)
+	var courses Courses
+	if err := json.Unmarshal(body, &courses); err != nil {
+		return nil, fmt.Errorf("decoding search results: %w", err)
+	}
+	if !courses.Success {
+		return nil, errors.New("class search was not successful")
+	}
+	return &courses, nil
+}
+
+// SearchCourses searches the task's term and flattens the results.
+func (t *Task) SearchCourses(subject, courseNumber string) ([]CourseInfo, error) {
+	if err := t.SelectSearchTerm(); err != nil {
+		return nil, err
+	}
+	defer t.ResetSearch()
+
+	courses, err := t.FetchSearchResults(subject, courseNumber)
+	if err != nil {
+		return nil, err
+	}
+	return courses.Info(), nil
+}
+
+// FetchSearchEnrollments reads the seat counts of every section of a subject,
+// or of one course when courseNumber is set, with one class search. The term
+// is selected once per client, and the search form is only reset when the
+// query changes.
+func (t *Task) FetchSearchEnrollments(subject, courseNumber string) (map[string]*Enrollment, error) {
+	if t.Session.UniqueSessionId == "" {
+		t.GenSessionId()
+	}
+	if t.searchTerm != t.Term {
+		if err := t.SelectSearchTerm(); err != nil {
+			return nil, err
+		}
+		t.searchTerm, t.lastSearch = t.Term, ""
+	}
+	query := subject + " " + courseNumber
+	if t.lastSearch != "" && t.lastSearch != query {
+		if err := t.ResetSearch(); err != nil {
+			return nil, err
+		}
+	}
+
+	watchSearchPollsTotal.WithLabelValues(t.Term, subject).Inc()
+	courses, err := t.FetchSearchResults(subject, courseNumber)
+	if err != nil {
+		return nil, err
+	}
+	t.lastSearch = query
+	enrollments := make(map[string]*Enrollment, len(courses.Data))
+	for _, section := range courses.Data {
+		enrollments[section.CourseReferenceNumber] = &Enrollment{
+			SeatsAvailable: section.SeatsAvailable,
+			WaitCapacity:   section.WaitCapacity,
+			WaitCount:      section.WaitCount,
+			WaitAvailable:  section.WaitAvailable,
+		}
+	}
+	return enrollments, nil
+}
+
+// SearchCourses runs an anonymous class search; no login is required.
+func SearchCourses(query SearchQuery) ([]CourseInfo, error) {
+	institution, exists := InstitutionForTerm(query.Institution, query.Term)
+	if !exists {
+		return nil, &ValidationError{"institution", fmt.Sprintf("unknown institution %q", query.Institution)}
+	}
+	if !institution.ValidTerm(query.Term) {
+		return nil, institution.termError()
+	}
+	if query.Subject == "" {
+		return nil, &ValidationError{"subject", "is required"}
+	}
+
+	task := &Task{Term: query.Term, Institution: query.Institution}
+	if err := task.InitClient(); err != nil {
+		return nil, err
+	}
+	task.GenSessionId()
+	return task.SearchCourses(query.Subject, query.CourseNumber)
+}
+
+// Info flattens the search result sections into CourseInfo values.
+func (c *Courses) Info() []CourseInfo {
+	infos := make([]CourseInfo, 0, len(c.Data))
+	for _, section := range c.Data {
+		info := CourseInfo{
+			TermDesc:              section.TermDesc,
+			CourseReferenceNumber: section.CourseReferenceNumber,
+			Subject:               section.Subject,
+			CourseNumber:          section.CourseNumber,
+			SequenceNumber:        section.SequenceNumber,
+			CourseTitle:           section.CourseTitle,
+			MaximumEnrollment:     section.MaximumEnrollment,
+			Enrollment:            section.Enrollment,
+			SeatsAvailable:        section.SeatsAvailable,
+			WaitAvailable:         section.WaitAvailable,
+		}
+		if len(section.Faculty) > 0 {
+			info.DisplayName = section.Faculty[0].DisplayName
+		}
+		if len(section.MeetingsFaculty) > 0 {
+			meeting := section.MeetingsFaculty[0].MeetingTime
+			info.BeginTime = meeting.BeginTime
+			info.EndTime = meeting.EndTime
+			info.StartDate = meeting.StartDate
+			info.EndDate = meeting.EndDate
+			info.MeetingType = meeting.MeetingTypeDescription
+			info.Room = meeting.Room
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
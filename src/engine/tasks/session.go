@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -15,6 +16,9 @@ type Session struct {
 	RelayState      string
 	SignupSession   SignupSession
 	UniqueSessionId string
+	// LoginURL is where the IdP's login form posts, when the IdP handed one
+	// out instead of the FHDA execution URLs.
+	LoginURL string
 }
 
 // GenSessionId generates a unique session ID for the task.
@@ -25,12 +29,8 @@ func (t *Task) GenSessionId() error {
 
 // VisitHomepage sends a GET request to the homepage URL.
 func (t *Task) VisitHomepage() error {
-	t.Status = "Visiting Homepage"
-	headers := [][2]string{
-		{"accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	t.beginStep("Visiting Homepage")
+	headers := t.headers(acceptHTML, "")
 
 	response, err := t.DoReq(t.MakeReq("GET", t.HomepageURL, headers, nil))
 	if err != nil {
@@ -42,22 +42,24 @@ func (t *Task) VisitHomepage() error {
 
 // Login sends a login request with the provided username and password.
 func (t *Task) Login() error {
-	t.Status = "Logging In"
-	headers := [][2]string{
-		{"accept", "*/*"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/x-www-form-urlencoded"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	t.beginStep("Logging In")
+	headers := t.headers(acceptAny, contentForm)
 
+	username, password, err := t.credentials()
+	if err != nil {
+		return err
+	}
 	t.Session.LoginAttempts++
 
 	values := url.Values{}
-	values.Set("j_username", t.Username)
-	values.Set("j_password", t.Password)
+	values.Set("j_username", username)
+	values.Set("j_password", password)
 	values.Set("_eventId_proceed", "")
 
-	loginURL := fmt.Sprintf("https://ssoshib.fhda.edu/idp/profile/SAML2/Redirect/SSO?execution=e1s%d", t.Session.LoginAttempts)
+	loginURL := t.Session.LoginURL
+	if loginURL == "" {
+		loginURL = t.institution().idpURL(fmt.Sprintf("/idp/profile/SAML2/Redirect/SSO?execution=e1s%d", t.Session.LoginAttempts))
+	}
 	response, err := t.DoReq(t.MakeReq("POST", loginURL, headers, []byte(values.Encode())))
 	if err != nil {
 		discardResp(response)
@@ -71,6 +73,9 @@ func (t *Task) Login() error {
 		discardResp(response)
 		return err
 	}
+	if document, err = t.completeMFA(document, loginURL); err != nil {
+		return err
+	}
 
 	var message string
 	document.Find("div[class='alert alert-danger']").Each(func(index int, element *goquery.Selection) {
@@ -79,41 +84,44 @@ func (t *Task) Login() error {
 
 	switch message {
 	case "The username you entered cannot be identified.":
-		t.Status = "Invalid Username"
+		t.SetStatus("Invalid Username")
+		return errors.New("Invalid Username")
 	case "The password you entered was incorrect.":
-		t.Status = "Invalid Password"
+		t.SetStatus("Invalid Password")
+		return errors.New("Invalid Password")
 	case "You may be seeing this page because you used the Back button while browsing a secure web site or application...":
-		t.Status = "Bad Session"
+		t.SetStatus("Bad Session")
+		return errors.New("Bad Session")
 	case "":
 		break
 	default:
-		t.Status = message
-		time.Sleep(2 * time.Second)
+		t.SetStatus(message)
+		if !t.sleep(2 * time.Second) {
+			return errStopped
+		}
 		return t.Login()
 	}
 
 	t.Session.RelayState = getSelectorAttr(document, "input[name='RelayState']", "value")
 	t.Session.SAMLResponse = getSelectorAttr(document, "input[name='SAMLResponse']", "value")
+	if t.Session.SAMLResponse == "" {
+		return errors.New("Login did not return a SAML response")
+	}
 	return nil
 }
 
 // SubmitCommonAuth sends a POST request to submit common authentication data.
 func (t *Task) SubmitCommonAuth() error {
-	t.Status = "Submitting Common Auth"
+	t.beginStep("Submitting Common Auth")
 
-	headers := [][2]string{
-		{"accept", "*/*"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/x-www-form-urlencoded"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	headers := t.headers(acceptAny, contentForm)
 
 	values := url.Values{
 		"RelayState":   {t.Session.RelayState},
 		"SAMLResponse": {t.Session.SAMLResponse},
 	}
 
-	response, err := t.DoReq(t.MakeReq("POST", "https://eis-prod.ec.fhda.edu/commonauth", headers, []byte(values.Encode())))
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().authURL("/commonauth"), headers, []byte(values.Encode())))
 	if err != nil {
 		discardResp(response)
 		return err
@@ -133,7 +141,8 @@ func (t *Task) SubmitCommonAuth() error {
 	})
 
 	if strings.Contains(message, "Authentication Error!") {
-		fmt.Println("Authentication Error!")
+		t.log().Warn("common auth rejected the login", "message", message)
+		return errors.New("Authentication Error")
 	}
 
 	t.Session.RelayState = getSelectorAttr(document, "input[name='RelayState']", "value")
@@ -143,14 +152,9 @@ func (t *Task) SubmitCommonAuth() error {
 
 // SubmitSSOManager sends a POST request to the SSO Manager URL.
 func (t *Task) SubmitSSOManager() error {
-	t.Status = "Submitting SSO Manager"
+	t.beginStep("Submitting SSO Manager")
 
-	headers := [][2]string{
-		{"accept", "*/*"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/x-www-form-urlencoded"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	headers := t.headers(acceptAny, contentForm)
 
 	values := url.Values{
 		"RelayState":   {t.Session.RelayState},
@@ -167,15 +171,11 @@ func (t *Task) SubmitSSOManager() error {
 
 // RegisterPostSignIn sends a GET request to register post sign-in.
 func (t *Task) RegisterPostSignIn() error {
-	t.Status = "Posting Register Sign-in"
+	t.beginStep("Posting Register Sign-in")
 
-	headers := [][2]string{
-		{"accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	headers := t.headers(acceptHTML, "")
 
-	url := "https://reg-prod.ec.fhda.edu/StudentRegistrationSsb/ssb/registration/registerPostSignIn?mode=registration"
+	url := t.institution().bannerURL("/ssb/registration/registerPostSignIn?mode=registration")
 	response, err := t.DoReq(t.MakeReq("GET", url, headers, nil))
 	if err != nil {
 		discardResp(response)
@@ -196,20 +196,15 @@ func (t *Task) RegisterPostSignIn() error {
 
 // SubmitSamIsso sends a POST request to submit SAML SSO.
 func (t *Task) SubmitSamIsso() error {
-	t.Status = "Submitting Sam Isso"
+	t.beginStep("Submitting Sam Isso")
 
-	headers := [][2]string{
-		{"accept", "*/*"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/x-www-form-urlencoded"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	headers := t.headers(acceptAny, contentForm)
 
 	values := url.Values{
 		"SAMLRequest": {t.Session.SignupSession.SAMLRequest},
 	}
 
-	response, err := t.DoReq(t.MakeReq("POST", "https://eis-prod.ec.fhda.edu/samlsso", headers, []byte(values.Encode())))
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().authURL("/samlsso"), headers, []byte(values.Encode())))
 	if err != nil {
 		discardResp(response)
 		return err
@@ -229,20 +224,15 @@ func (t *Task) SubmitSamIsso() error {
 
 // SubmitSSBSp sends a POST request to submit SAML response to the SSB service provider.
 func (t *Task) SubmitSSBSp() error {
-	t.Status = "Submitting SSB SSP"
+	t.beginStep("Submitting SSB SSP")
 
-	headers := [][2]string{
-		{"accept", "*/*"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/x-www-form-urlencoded"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	headers := t.headers(acceptAny, contentForm)
 
 	values := url.Values{
 		"SAMLResponse": {t.Session.SAMLResponse},
 	}
 
-	url := "https://reg-prod.ec.fhda.edu/StudentRegistrationSsb/saml/SSO/alias/registrationssb-prod-sp"
+	url := t.institution().bannerURL("/saml/SSO/alias/" + t.institution().ServiceProvider)
 	response, err := t.DoReq(t.MakeReq("POST", url, headers, []byte(values.Encode())))
 	if err != nil {
 		discardResp(response)
@@ -251,14 +241,29 @@ func (t *Task) SubmitSSBSp() error {
 	return nil
 }
 
-// GenSession generates a new session and performs all the required steps.
-func (t *Task) GenSession() {
-	t.GenSessionId()
-	t.VisitHomepage()
-	t.Login()
-	t.SubmitCommonAuth()
-	t.SubmitSSOManager()
-	t.RegisterPostSignIn()
-	t.SubmitSamIsso()
-	t.SubmitSSBSp()
+// GenSession signs in with the authenticator of the task's institution and
+// switches the task over to the resulting session.
+func (t *Task) GenSession() error {
+	authenticator, exists := lookupAuthenticator(t.institution().SSOProvider)
+	if !exists {
+		return fmt.Errorf("no authenticator for SSO provider %q", t.institution().SSOProvider)
+	}
+	session, err := authenticator.Authenticate(t)
+	if err == nil {
+		t.useAuthSession(session)
+	}
+	observeLogin(err)
+	return err
+}
+
+// CheckLogin signs in with the task's credentials without registering for
+// anything.
+func (t *Task) CheckLogin() error {
+	t.useRegistrationURLs()
+	if t.Client == nil {
+		if err := t.InitClient(); err != nil {
+			return err
+		}
+	}
+	return t.GenSession()
 }
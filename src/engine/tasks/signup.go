@@ -4,114 +4,97 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
 	"time"
 )
 
 type SignupSession struct {
 	SAMLRequest string
-	Model       map[string]interface{}
+	// Models are the pending registration items to submit.
+	Models []map[string]interface{}
+	// Unsubmitted are the results of the CRNs left out of the batch, because
+	// the account already holds them or Banner refused to add them.
+	Unsubmitted []RegistrationResult
 }
 
-func (t *Task) GetRegistrationStatus() error {
-	t.Status = "Getting Registration Status"
-	headers := [][2]string{
-		{"accept", "*/*"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/x-www-form-urlencoded"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+// RegistrationRetryInterval is how long GetRegistrationStatus waits before
+// asking again when the registration window should be open but Banner still
+// reports the time ticket, and MaxRegistrationRetries how often it asks.
+var (
+	RegistrationRetryInterval = 2 * time.Second
+	MaxRegistrationRetries    = 30
+)
 
-	values := url.Values{
-		"term":            {t.Term},
-		"studyPath":       {},
-		"startDatepicker": {},
-		"endDatepicker":   {},
-		"uniqueSessionId": {t.Session.UniqueSessionId},
-	}
+// GetRegistrationStatus checks that the account may register for the term,
+// waiting for its registration window to open if it has not yet.
+func (t *Task) GetRegistrationStatus() error {
+	for retries := 0; ; {
+		t.beginStep("Getting Registration Status")
+		eligibility, err := t.FetchEligibility()
+		if err != nil {
+			return err
+		}
+		for _, failure := range eligibility.Failures {
+			t.log().Info("eligibility failure", "kind", failure.Kind, "reason", failure.Message)
+		}
+		if !eligibility.Ready {
+			return ineligible(eligibility)
+		}
 
-	response, err := t.DoReq(t.MakeReq("POST", "https://reg-prod.ec.fhda.edu/StudentRegistrationSsb/ssb/term/search?mode=registration", headers, []byte(values.Encode())))
-	if err != nil {
-		discardResp(response)
-		return err
-	}
+		timeTicket := eligibility.TimeTicket()
+		targetTime := eligibility.RegistrationOpens
+		if timeTicket == nil || targetTime == nil {
+			return nil
+		}
+		now := time.Now().In(targetTime.Location())
+		if closes := eligibility.RegistrationCloses; closes != nil && now.After(*closes) {
+			return errors.New("Registration window closed")
+		}
 
-	body, _ := readBody(response)
-	fmt.Println(string(body))
+		if now.Before(*targetTime) {
+			timeToWait := targetTime.Sub(now)
 
-	var registrationStatus RegistrationStatus
-	if err := json.Unmarshal(body, &registrationStatus); err != nil {
-		return err
-	}
+			t.SetStatus(fmt.Sprintf("Waiting til %s", targetTime.Format(time.RFC1123)))
+			t.log().Info("waiting for registration to open", "opens_at", *targetTime, "wait", formatDuration(timeToWait))
 
-	var hasFailure, hasRegistrationTime bool
-	var timeFailure string
+			t.setWaitUntil(targetTime)
+			t.setPhase(PhaseWaiting)
 
-	for _, failure := range registrationStatus.StudentEligFailures {
-		fmt.Println(failure)
-		hasFailure = true
-		if strings.Contains(failure, "You can register from") {
-			hasRegistrationTime = true
-			timeFailure = failure
-			break
+			if !t.sleep(timeToWait) {
+				return errStopped
+			}
+			t.setWaitUntil(nil)
+			t.setPhase(PhaseEligibility)
+			continue
 		}
-	}
 
-	if hasFailure && !hasRegistrationTime {
-		return errors.New(registrationStatus.StudentEligFailures[len(registrationStatus.StudentEligFailures)-1])
+		// The window should be open; Banner's clock may be behind ours.
+		if retries == MaxRegistrationRetries {
+			return errors.New(timeTicket.Message)
+		}
+		retries++
+		if !t.sleep(RegistrationRetryInterval) {
+			return errStopped
+		}
 	}
+}
 
-	if !hasFailure && !hasRegistrationTime {
-		pattern := regexp.MustCompile(`\d{2}/\d{2}/\d{4} \d{2}:\d{2} [APM]{2}`)
-		matches := pattern.FindAllString(timeFailure, -1)
-
-		if len(matches) > 0 {
-			location, _ := time.LoadLocation("America/Los_Angeles")
-			targetTime, _ := time.ParseInLocation("01/02/2006 03:04 PM", matches[0], location)
-			now := time.Now().In(location)
-
-			if now.After(targetTime) {
-				time.Sleep(2 * time.Second)
-				return t.GetRegistrationStatus()
-			} else if now.Before(targetTime) {
-				timeToWait := targetTime.Sub(now)
-
-				t.Status = fmt.Sprintf("Waiting til %s", targetTime.Format(time.RFC1123))
-				fmt.Printf("Waiting for Registration to open: %s\n", targetTime.Format(time.RFC1123))
-				fmt.Printf("Will continue in %s\n", formatDuration(timeToWait))
-
-				go func() {
-					ticker := time.NewTicker(5 * time.Minute)
-					defer ticker.Stop()
-
-					endTime := time.Now().Add(timeToWait)
-					for now := range ticker.C {
-						if now.After(endTime) {
-							break
-						}
-					}
-				}()
-
-				time.Sleep(timeToWait)
-				return t.GetRegistrationStatus()
-			}
+// ineligible explains why an account cannot register even once its
+// registration window opens.
+func ineligible(eligibility *Eligibility) error {
+	for i := len(eligibility.Failures) - 1; i >= 0; i-- {
+		if failure := eligibility.Failures[i]; failure.Kind != EligibilityTimeTicket {
+			return errors.New(failure.Message)
 		}
 	}
-	return nil
+	return errors.New("Not eligible to register")
 }
 
 func (t *Task) VisitClassRegistration() error {
-	t.Status = "Visiting Class Registration"
+	t.beginStep("Visiting Class Registration")
 
-	headers := [][2]string{
-		{"accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+	headers := t.headers(acceptHTML, "")
 
-	response, err := t.DoReq(t.MakeReq("HEAD", "https://reg-prod.ec.fhda.edu/StudentRegistrationSsb/ssb/classRegistration/classRegistration", headers, nil))
+	response, err := t.DoReq(t.MakeReq("HEAD", t.institution().bannerURL("/ssb/classRegistration/classRegistration"), headers, nil))
 	if err != nil {
 		discardResp(response)
 		return err
@@ -120,44 +103,72 @@ func (t *Task) VisitClassRegistration() error {
 }
 
 func (t *Task) AddCourse(course string) error {
-	t.Status = "Adding Course"
+	t.beginStep("Adding Course")
+	addCourse, err := t.addRegistrationItem(course)
+	if err != nil {
+		return err
+	}
 
-	headers := [][2]string{
-		{"accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
+	if addCourse.Success {
+		model := addCourse.Model
+		model["selectedAction"] = "WL"
+		t.Session.SignupSession.Models = append(t.Session.SignupSession.Models, model)
+	} else {
+		t.log().Warn("course not added", "crn", course, "message", addCourse.Message)
+		t.SetStatus(addCourse.Message)
+		t.Session.SignupSession.Unsubmitted = append(t.Session.SignupSession.Unsubmitted, RegistrationResult{
+			CRN:    course,
+			Status: ResultFailed,
+			Errors: []string{addCourse.Message},
+		})
 	}
+	return nil
+}
 
-	url := fmt.Sprintf("https://reg-prod.ec.fhda.edu/StudentRegistrationSsb/ssb/classRegistration/addRegistrationItem?term=%s&courseReferenceNumber=%s&olr=false", t.Term, course)
+// addRegistrationItem adds a CRN to the pending registration and returns
+// Banner's verdict and the item's model.
+func (t *Task) addRegistrationItem(course string) (*AddCourse, error) {
+	headers := t.headers(acceptHTML, "")
+
+	url := t.institution().bannerURL(fmt.Sprintf("/ssb/classRegistration/addRegistrationItem?term=%s&courseReferenceNumber=%s&olr=false", t.Term, course))
 	response, err := t.DoReq(t.MakeReq("GET", url, headers, nil))
 	if err != nil {
 		discardResp(response)
-		return err
+		return nil, err
 	}
 
 	body, _ := readBody(response)
-	fmt.Println(string(body))
+	t.log().Debug("add course response", "crn", course, "body", string(body))
 
 	var addCourse AddCourse
 	if err := json.Unmarshal(body, &addCourse); err != nil {
-		return err
+		return nil, err
 	}
-
-	if addCourse.Success {
-		model, err := extractModel([]byte(body))
-		if err != nil {
-			return err
-		}
-		model["selectedAction"] = "WL"
-		t.Session.SignupSession.Model = model
-	} else {
-		t.Status = addCourse.Message
+	if addCourse.Success && addCourse.Model == nil {
+		addCourse.Model = make(map[string]interface{})
 	}
-	return nil
+	return &addCourse, nil
 }
 
+// AddCourses adds the task's CRNs to the pending registration, skipping
+// those already on the account's schedule.
 func (t *Task) AddCourses() error {
+	t.Session.SignupSession.Models = nil
+	t.Session.SignupSession.Unsubmitted = nil
+	schedule := t.currentSchedule()
 	for _, course := range t.CRNs {
+		if class := schedule.Class(course); class != nil && class.Holds() {
+			t.log().Info("course already on schedule", "crn", course, "status", class.Status)
+			t.Session.SignupSession.Unsubmitted = append(t.Session.SignupSession.Unsubmitted, RegistrationResult{
+				CRN:               course,
+				Title:             class.Title,
+				Status:            class.Status,
+				StatusDescription: class.StatusDescription,
+				CreditHours:       class.CreditHours,
+				Skipped:           true,
+			})
+			continue
+		}
 		if err := t.AddCourse(course); err != nil {
 			return err
 		}
@@ -165,18 +176,23 @@ func (t *Task) AddCourses() error {
 	return nil
 }
 
+// SendBatch submits the pending registration items and reports Banner's
+// result for each CRN.
 func (t *Task) SendBatch() error {
-	t.Status = "Submitting Batch"
-
-	headers := [][2]string{
-		{"accept", "application/json"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/json"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
+	unsubmitted := t.Session.SignupSession.Unsubmitted
+	if len(t.Session.SignupSession.Models) == 0 {
+		// Every CRN was held already or refused when added.
+		if len(unsubmitted) > 0 {
+			t.reportResults(unsubmitted)
+		}
+		return nil
 	}
+	t.beginStep("Submitting Batch")
+
+	headers := t.headers(acceptJSON, contentJSON)
 
 	batch := Batch{
-		Update:          []map[string]interface{}{t.Session.SignupSession.Model},
+		Update:          t.Session.SignupSession.Models,
 		UniqueSessionId: t.Session.UniqueSessionId,
 	}
 
@@ -185,46 +201,61 @@ func (t *Task) SendBatch() error {
 		return err
 	}
 
-	response, err := t.DoReq(t.MakeReq("POST", "https://reg-prod.ec.fhda.edu/StudentRegistrationSsb/ssb/classRegistration/submitRegistration/batch", headers, []byte(batchJson)))
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().bannerURL("/ssb/classRegistration/submitRegistration/batch"), headers, []byte(batchJson)))
 	if err != nil {
 		discardResp(response)
 		return err
 	}
 
 	body, _ := readBody(response)
-	fmt.Println(string(body))
+	t.log().Debug("batch response", "body", string(body))
 
 	var changes Changes
 	if err := json.Unmarshal(body, &changes); err != nil {
 		return err
 	}
 
-	for _, data := range changes.Data.Update {
-		for _, courseReferenceNumber := range t.CRNs {
-			if data.CourseReferenceNumber == courseReferenceNumber {
-				switch data.StatusDescription {
-				case "Registered":
-					t.Status = "Registered"
-					t.SendNotification(data.CourseTitle, "Registered")
-				case "Waitlisted":
-					t.Status = "Waitlisted"
-					t.SendNotification(data.CourseTitle, "Waitlisted")
-				case "Errors Preventing Registration":
-					t.Status = data.CrnErrors[0].Message
-					t.SendNotification(data.CourseTitle, data.CrnErrors[0].Message)
-				}
-			}
-		}
-	}
+	t.reportResults(append(unsubmitted, registrationResults(&changes)...))
 	return nil
 }
 
-func (t *Task) Signup() {
-	t.HomepageURL = "https://ssb-prod.ec.fhda.edu/ssomanager/saml/login?relayState=%2Fc%2Fauth%2FSSB%3Fpkg%3Dhttps%3A%2F%2Fssb-prod.ec.fhda.edu%2FPROD%2Ffhda_uportal.P_DeepLink_Post%3Fp_page%3Dbwskfreg.P_AltPin%26p_payload%3De30%3D"
-	t.SSOManagerURL = "https://ssb-prod.ec.fhda.edu/ssomanager/saml/SSO"
-	t.GenSession()
-	t.GetRegistrationStatus()
-	t.VisitClassRegistration()
-	t.AddCourses()
-	t.SendBatch()
+// useRegistrationURLs points the login chain at the institution's
+// registration portal.
+func (t *Task) useRegistrationURLs() {
+	t.state.Lock()
+	t.HomepageURL = t.institution().HomepageURL
+	t.SSOManagerURL = t.institution().SSOManagerURL
+	t.state.Unlock()
+}
+
+// Signup logs in and registers for the task's CRNs, stopping at the first
+// step that fails.
+func (t *Task) Signup() error {
+	t.useRegistrationURLs()
+	// Results from an earlier run would outlive a run that submits nothing.
+	t.setResults(nil)
+
+	// A task resumed from a checkpoint waits for its registration window
+	// before signing in, so the session is fresh when the window opens.
+	if t.WaitUntil != nil && time.Now().Before(*t.WaitUntil) {
+		t.setPhase(PhaseWaiting)
+		t.SetStatus(fmt.Sprintf("Waiting til %s", t.WaitUntil.Format(time.RFC1123)))
+		if !t.sleep(time.Until(*t.WaitUntil)) {
+			return errStopped
+		}
+	}
+	t.setWaitUntil(nil)
+
+	steps := []func() error{
+		t.inPhase(PhaseLogin, t.GenSession),
+		t.inPhase(PhaseEligibility, t.GetRegistrationStatus),
+		t.inPhase(PhaseAdding, t.VisitClassRegistration),
+		t.AddCourses,
+		t.inPhase(PhaseSubmitting, t.SendBatch),
+	}
+	if err := t.runSteps(steps); err != nil {
+		return err
+	}
+	t.setPhase(PhaseDone)
+	return nil
 }
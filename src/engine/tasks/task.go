@@ -2,11 +2,14 @@ package tasks
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
-	"strings"
+	"net/url"
+	"proj/apitypes"
 	"sync"
 	"time"
 
@@ -14,41 +17,239 @@ import (
 
 	http "github.com/bogdanfinn/fhttp"
 	tls_client "github.com/bogdanfinn/tls-client"
-	"github.com/bogdanfinn/tls-client/profiles"
 )
 
 type Task struct {
-	ID            string `json:"id"`
-	Mode          string `json:"mode"`
-	Term          string `json:"term"`
-	Crns          string `json:"crns"`
-	Status        string `json:"status"`
-	Username      string `json:"username"`
-	Password      string `json:"password"`
-	WebhookURL    string `json:"webhook_url"`
-	Client        tls_client.HttpClient
-	Session       Session
-	HomepageURL   string
-	SSOManagerURL string
-	CRNs          []string
-}
-
-type SanitizedTask struct {
-	ID            string `json:"id"`
-	Mode          string `json:"mode"`
-	Term          string `json:"term"`
-	Crns          string `json:"crns"`
-	Status        string `json:"status"`
-	Username      string `json:"username"`
-	Password      string `json:"password"`
-	WebhookURL    string `json:"webhook_url"`
-	HomepageURL   string `json:"homepage_url"`
-	SSOManagerURL string `json:"sso_manager_url"`
+	ID           string      `json:"id"`
+	Mode         string      `json:"mode"`
+	Term         string      `json:"term"`
+	Institution  string      `json:"institution,omitempty"`
+	Crns         string      `json:"crns"`
+	Subject      string      `json:"subject,omitempty"`
+	CourseNumber string      `json:"course_number,omitempty"`
+	Status       string      `json:"status"`
+	Username     string      `json:"username"`
+	Password     string      `json:"password"`
+	Account      string      `json:"account,omitempty"`
+	Proxy        string      `json:"proxy,omitempty"`
+	Fingerprint  string      `json:"fingerprint,omitempty"`
+	Polling      *PollPolicy `json:"polling,omitempty"`
+	Condition    string      `json:"condition,omitempty"`
+	WebhookURL   string      `json:"webhook_url"`
+	StartAt      *time.Time  `json:"start_at,omitempty"`
+	Phase        string      `json:"phase,omitempty"`
+	WaitUntil    *time.Time  `json:"wait_until,omitempty"`
+	Capture      bool        `json:"capture,omitempty"`
+	TimeTicket   bool        `json:"time_ticket,omitempty"`
+	// Readiness is the report of a finished DryRun task.
+	Readiness *DryRunReport `json:"readiness,omitempty"`
+	// Results are Banner's outcome for each CRN of the last submission.
+	Results       []RegistrationResult  `json:"results,omitempty"`
+	Client        tls_client.HttpClient `json:"-"`
+	Session       Session               `json:"-"`
+	HomepageURL   string                `json:"-"`
+	SSOManagerURL string                `json:"-"`
+	CRNs          []string              `json:"-"`
+	// state guards Status, Phase, WaitUntil, Readiness, Results and the
+	// login URLs, which the task's run writes while the API and checkpoints
+	// read them.
+	state         sync.Mutex
+	events        *EventBus
+	ctx           context.Context
+	cancel        context.CancelFunc
+	startTimer    *time.Timer
+	checkpoint    func()
+	running       bool
+	resuming      bool
+	step          string
+	har           *harRecorder
+	hostOverrides map[string]string
+	mfa           *mfaPrompt
+	accounts      CredentialStore
+	proxies       *ProxyPool
+	proxy         string
+	proxyPinned   bool
+	fingerprint   *Fingerprint
+	watches       *WatchScheduler
+	searchTerm    string
+	lastSearch    string
+	ticket        *Eligibility
+	ticketError   string
+	ticketOpens   time.Time
 }
 
+// SanitizedTask is a task as the API returns it, without its password.
+type SanitizedTask = apitypes.SanitizedTask
+
 type TaskManager struct {
-	Tasks map[string]*Task
-	mutex sync.Mutex
+	Tasks  map[string]*Task
+	Events *EventBus
+	Logs   *LogStore
+	mutex  sync.Mutex
+
+	// CaptureDir is where tasks with Capture set write their HAR files.
+	CaptureDir string
+	// HostOverrides sends requests for a host to another base URL, such as a
+	// local stand-in server.
+	HostOverrides map[string]string
+	// Accounts resolves the credentials of tasks that reference an account
+	// instead of carrying a username and password.
+	Accounts CredentialStore
+	// Proxies is the pool tasks with Proxy set to "pool" draw from.
+	Proxies *ProxyPool
+	// Watches polls the sections of every Watch task.
+	Watches *WatchScheduler
+	// TimeTicketLead is how long before its account's registration window
+	// opens a time ticket task starts, so it is signed in when it opens.
+	TimeTicketLead time.Duration
+
+	running            sync.WaitGroup
+	shuttingDown       bool
+	checkpointPath     string
+	checkpointRequests chan struct{}
+	ticketRequests     chan struct{}
+}
+
+// NewTaskManager creates an empty TaskManager with its own EventBus and
+// LogStore.
+func NewTaskManager() *TaskManager {
+	return &TaskManager{
+		Tasks:  make(map[string]*Task),
+		Events: NewEventBus(),
+		Logs:   NewLogStore(1000),
+
+		Watches:        NewWatchScheduler(),
+		CaptureDir:     "captures",
+		TimeTicketLead: DefaultTimeTicketLead,
+		ticketRequests: make(chan struct{}, 1),
+	}
+}
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskExists   = errors.New("task already exists")
+	ErrTaskRunning  = errors.New("task is already running")
+	errStopped      = errors.New("Stopped")
+)
+
+// TaskInput is the body that creates a task.
+type TaskInput = apitypes.TaskInput
+
+// NewTask builds a task from the fields a client may set, leaving the
+// engine's own state, such as its status and phase, unset.
+func NewTask(input *TaskInput) *Task {
+	return &Task{
+		ID:           input.ID,
+		Mode:         input.Mode,
+		Term:         input.Term,
+		Institution:  input.Institution,
+		Crns:         input.Crns,
+		Subject:      input.Subject,
+		CourseNumber: input.CourseNumber,
+		Username:     input.Username,
+		Password:     input.Password,
+		Account:      input.Account,
+		Proxy:        input.Proxy,
+		Fingerprint:  input.Fingerprint,
+		Polling:      input.Polling,
+		Condition:    input.Condition,
+		WebhookURL:   input.WebhookURL,
+		Capture:      input.Capture,
+		TimeTicket:   input.TimeTicket,
+	}
+}
+
+// input returns the fields of the task a client set.
+func (t *Task) input() *TaskInput {
+	return &TaskInput{
+		ID:           t.ID,
+		Mode:         t.Mode,
+		Term:         t.Term,
+		Institution:  t.Institution,
+		Crns:         t.Crns,
+		Subject:      t.Subject,
+		CourseNumber: t.CourseNumber,
+		Username:     t.Username,
+		Password:     t.Password,
+		Account:      t.Account,
+		Proxy:        t.Proxy,
+		Fingerprint:  t.Fingerprint,
+		Polling:      t.Polling,
+		Condition:    t.Condition,
+		WebhookURL:   t.WebhookURL,
+		Capture:      t.Capture,
+		TimeTicket:   t.TimeTicket,
+	}
+}
+
+// TaskPatch holds the task fields a client may change after creation.
+// Nil fields are left untouched.
+type TaskPatch = apitypes.TaskPatch
+
+// applyPatch copies the non-nil patch fields onto the task.
+func applyPatch(p *TaskPatch, task *Task) {
+	if p.Mode != nil {
+		task.Mode = *p.Mode
+	}
+	if p.Term != nil {
+		task.Term = *p.Term
+	}
+	if p.Institution != nil {
+		task.Institution = *p.Institution
+	}
+	if p.Crns != nil {
+		task.Crns = *p.Crns
+	}
+	if p.Subject != nil {
+		task.Subject = *p.Subject
+	}
+	if p.CourseNumber != nil {
+		task.CourseNumber = *p.CourseNumber
+	}
+	if p.Username != nil {
+		task.Username = *p.Username
+	}
+	if p.Password != nil {
+		task.Password = *p.Password
+	}
+	if p.Account != nil {
+		task.Account = *p.Account
+	}
+	if p.Proxy != nil {
+		task.Proxy = *p.Proxy
+	}
+	if p.Fingerprint != nil {
+		task.Fingerprint = *p.Fingerprint
+	}
+	if p.Polling != nil {
+		task.Polling = p.Polling
+	}
+	if p.Condition != nil {
+		task.Condition = *p.Condition
+	}
+	if p.WebhookURL != nil {
+		task.WebhookURL = *p.WebhookURL
+	}
+	if p.Capture != nil {
+		task.Capture = *p.Capture
+	}
+	if p.TimeTicket != nil {
+		task.TimeTicket = *p.TimeTicket
+	}
+}
+
+// BulkError reports which entry of a bulk request failed.
+type BulkError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("task %d: %v", e.Index, e.Err)
+}
+
+func (e *BulkError) Unwrap() error {
+	return e.Err
 }
 
 // GetTaskStatus returns the status of a task by its ID.
@@ -56,7 +257,7 @@ func (tm *TaskManager) GetTaskStatus(id string) string {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 	if task, exists := tm.Tasks[id]; exists {
-		return task.Status
+		return task.status()
 	}
 	return "Task not found"
 }
@@ -65,68 +266,347 @@ func (tm *TaskManager) GetTaskStatus(id string) string {
 func (tm *TaskManager) AddTask(task *Task) {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
+	task.events = tm.Events
 	tm.Tasks[task.ID] = task
+	tm.track(task)
+	tm.Events.Publish(Event{Type: EventTaskCreated, TaskID: task.ID, Status: task.Status})
+}
+
+// track hooks a newly stored task into checkpointing. Callers hold the mutex.
+func (tm *TaskManager) track(task *Task) {
+	if tm.checkpointRequests != nil {
+		task.checkpoint = tm.requestCheckpoint
+		tm.requestCheckpoint()
+	}
+}
+
+// GetTask returns a sanitized copy of a task by its ID.
+func (tm *TaskManager) GetTask(id string) (*SanitizedTask, bool) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if task, exists := tm.Tasks[id]; exists {
+		return SanitizeTask(task), true
+	}
+	return nil, false
+}
+
+// CreateTask validates a task and adds it, refusing duplicate IDs.
+func (tm *TaskManager) CreateTask(task *Task) error {
+	return tm.CreateTasks([]*Task{task})
+}
+
+// CreateTasks validates and adds several tasks at once. Either every task is
+// added or, on the first invalid or duplicate entry, none are.
+func (tm *TaskManager) CreateTasks(tasks []*Task) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	return tm.addTasks(tasks, false)
+}
+
+// addTasks validates and adds tasks, all or none. With replace set, stored
+// tasks with the same IDs are deleted, but only once every task is valid.
+// Callers hold the mutex.
+func (tm *TaskManager) addTasks(tasks []*Task, replace bool) error {
+	seen := make(map[string]bool, len(tasks))
+	for index, task := range tasks {
+		if err := task.Validate(); err != nil {
+			return &BulkError{index, err}
+		}
+		if err := tm.checkAccount(task); err != nil {
+			return &BulkError{index, err}
+		}
+		if task.Proxy == ProxyFromPool && tm.Proxies == nil {
+			return &BulkError{index, &ValidationError{"proxy", "no proxy pool is configured"}}
+		}
+		if _, exists := tm.Tasks[task.ID]; (exists && !replace) || seen[task.ID] {
+			return &BulkError{index, ErrTaskExists}
+		}
+		seen[task.ID] = true
+	}
+
+	for _, task := range tasks {
+		if replaced, exists := tm.Tasks[task.ID]; exists {
+			tm.removeTask(replaced)
+		}
+		if task.Status == "" {
+			task.Status = "Created"
+		}
+		task.events = tm.Events
+		tm.Tasks[task.ID] = task
+		tm.track(task)
+		if task.TimeTicket {
+			tm.requestTicketRefresh()
+		}
+		tm.Events.Publish(Event{Type: EventTaskCreated, TaskID: task.ID, Status: task.Status})
+	}
+	return nil
+}
+
+// UpdateTask applies a patch to a stored task. The patched task is validated
+// before anything is changed.
+func (tm *TaskManager) UpdateTask(id string, patch *TaskPatch) (*SanitizedTask, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	task, exists := tm.Tasks[id]
+	if !exists {
+		return nil, ErrTaskNotFound
+	}
+
+	updated := NewTask(task.input())
+	applyPatch(patch, updated)
+	if err := updated.Validate(); err != nil {
+		return nil, err
+	}
+	if err := tm.checkAccount(updated); err != nil {
+		return nil, err
+	}
+	if updated.Proxy == ProxyFromPool && tm.Proxies == nil {
+		return nil, &ValidationError{"proxy", "no proxy pool is configured"}
+	}
+	applyPatch(patch, task)
+	if task.TimeTicket {
+		tm.requestTicketRefresh()
+	}
+	tm.requestCheckpoint()
+	tm.Events.Publish(Event{Type: EventTaskUpdated, TaskID: task.ID, Status: task.status()})
+	return SanitizeTask(task), nil
 }
 
 // DeleteTask removes a task from the TaskManager by its ID.
 func (tm *TaskManager) DeleteTask(id string) bool {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
-	if _, exists := tm.Tasks[id]; exists {
-		delete(tm.Tasks, id)
+	if task, exists := tm.Tasks[id]; exists {
+		tm.removeTask(task)
 		return true
 	}
 	return false
 }
 
-// RunTask runs a task by its ID.
+// removeTask stops a stored task and removes it. Callers hold the mutex.
+func (tm *TaskManager) removeTask(task *Task) {
+	if task.cancel != nil {
+		task.cancel()
+	}
+	if task.startTimer != nil {
+		task.startTimer.Stop()
+	}
+	delete(tm.Tasks, task.ID)
+	tm.requestCheckpoint()
+	tm.Events.Publish(Event{Type: EventTaskDeleted, TaskID: task.ID})
+}
+
+// RunTask runs a task by its ID. It reports whether the task was started;
+// StartTask says why it was not.
 func (tm *TaskManager) RunTask(id string) bool {
+	return tm.StartTask(id) == nil
+}
+
+// StartTask runs a task by its ID. A task that is already running is not
+// started again.
+func (tm *TaskManager) StartTask(id string) error {
 	tm.mutex.Lock()
 	task, exists := tm.Tasks[id]
-	if exists {
-		task.Status = "Running"
+	switch {
+	case !exists:
+		tm.mutex.Unlock()
+		return ErrTaskNotFound
+	case tm.shuttingDown:
+		tm.mutex.Unlock()
+		return ErrShuttingDown
+	case task.running:
+		tm.mutex.Unlock()
+		return ErrTaskRunning
+	}
+	task.ctx, task.cancel = context.WithCancel(context.Background())
+	task.running = true
+	task.mfa = &mfaPrompt{}
+	task.accounts = tm.Accounts
+	task.proxies = tm.Proxies
+	task.watches = tm.Watches
+	// A task resumed from a checkpoint keeps the phase it stopped in until
+	// its run moves on.
+	if !task.resuming {
+		task.state.Lock()
+		task.Phase = ""
+		task.state.Unlock()
+	}
+	task.resuming = false
+	task.step = ""
+	task.hostOverrides = tm.HostOverrides
+	task.har = nil
+	if task.Capture {
+		task.har = newHARRecorder(task)
 	}
+	task.SetStatus("Running")
+	tm.running.Add(1)
+	tm.requestCheckpoint()
 	tm.mutex.Unlock()
 
-	if exists {
-		go func() {
-			// Perform the task's work without holding the mutex
-			task.InitClient()
-			task.CRNs = strings.Split(task.Crns, ",")
-			if task.Mode == "Watch" {
-				task.Watch()
-			} else if task.Mode == "Signup" {
-				task.Signup()
+	go func() {
+		defer tm.running.Done()
+
+		activeTasks.WithLabelValues(task.Mode).Inc()
+		defer activeTasks.WithLabelValues(task.Mode).Dec()
+
+		// Perform the task's work without holding the mutex
+		err := task.InitClient()
+		task.CRNs = splitCRNs(task.Crns)
+
+		if err == nil && task.Mode == "Watch" {
+			err = task.Watch()
+		} else if err == nil && task.Mode == "Notify" {
+			err = task.Notify()
+		} else if err == nil && task.Mode == "Signup" {
+			err = task.Signup()
+		} else if err == nil && task.Mode == "DryRun" {
+			err = task.DryRun()
+		}
+
+		if task.Stopped() {
+			task.SetStatus("Stopped")
+		} else if err != nil {
+			task.log().Error("task failed", "error", err)
+			task.SetStatus(err.Error())
+		}
+
+		if task.har != nil {
+			if path, err := task.har.write(tm.CaptureDir); err != nil {
+				task.log().Error("writing capture", "error", err)
+			} else {
+				task.log().Info("wrote capture", "path", path)
 			}
+		}
+
+		// Tasks interrupted by a shutdown stay marked as running so they
+		// resume from their checkpoint on the next start.
+		tm.mutex.Lock()
+		if !tm.shuttingDown {
+			task.running = false
+		}
+		tm.mutex.Unlock()
+		tm.requestCheckpoint()
+		tm.Events.Publish(Event{Type: EventTaskFinished, TaskID: task.ID, Status: task.status()})
+	}()
+	return nil
+}
+
+// StopTask asks a running task to stop at its next checkpoint.
+func (tm *TaskManager) StopTask(id string) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	task, exists := tm.Tasks[id]
+	if !exists {
+		return ErrTaskNotFound
+	}
+	if task.cancel != nil {
+		task.cancel()
+	}
+	return nil
+}
 
-			// Lock the mutex only when updating the status
-			tm.mutex.Lock()
-			defer tm.mutex.Unlock()
+// ScheduleTask arms a task to start at the given time, replacing any earlier
+// schedule. Times in the past start the task immediately.
+func (tm *TaskManager) ScheduleTask(id string, at time.Time) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	task, exists := tm.Tasks[id]
+	if !exists {
+		return ErrTaskNotFound
+	}
+	tm.schedule(task, at)
+	return nil
+}
 
-			/*
-				if task.Mode != "Watch" {
-					task.Status = "Completed"
-				}
-			*/
-		}()
+// schedule arms a stored task's start timer. Callers hold the mutex.
+func (tm *TaskManager) schedule(task *Task, at time.Time) {
+	if task.startTimer != nil {
+		task.startTimer.Stop()
+	}
+	task.StartAt = &at
+	task.SetStatus(fmt.Sprintf("Scheduled for %s", at.Format(time.RFC1123)))
+	task.startTimer = time.AfterFunc(time.Until(at), func() {
+		// A task rescheduled or deleted since the timer was armed is left
+		// to its newer schedule.
+		tm.mutex.Lock()
+		if tm.Tasks[task.ID] != task || task.StartAt == nil || !task.StartAt.Equal(at) {
+			tm.mutex.Unlock()
+			return
+		}
+		task.StartAt, task.startTimer = nil, nil
+		tm.mutex.Unlock()
+		tm.RunTask(task.ID)
+	})
+}
+
+// Stopped reports whether the task has been asked to stop.
+func (t *Task) Stopped() bool {
+	return t.ctx != nil && t.ctx.Err() != nil
+}
+
+// runSteps runs each step in order, stopping at the first error or when the
+// task is stopped.
+func (t *Task) runSteps(steps []func() error) error {
+	for _, step := range steps {
+		if t.Stopped() {
+			return errStopped
+		}
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleep waits for the duration and returns false early if the task is stopped.
+func (t *Task) sleep(duration time.Duration) bool {
+	if t.ctx == nil {
+		time.Sleep(duration)
 		return true
 	}
-	return false
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-t.ctx.Done():
+		return false
+	}
 }
 
 // SanitizeTask creates a sanitized version of the task.
 func SanitizeTask(task *Task) *SanitizedTask {
+	task.state.Lock()
+	defer task.state.Unlock()
 	return &SanitizedTask{
 		ID:            task.ID,
 		Mode:          task.Mode,
 		Term:          task.Term,
+		Institution:   task.Institution,
 		Crns:          task.Crns,
+		Subject:       task.Subject,
+		CourseNumber:  task.CourseNumber,
 		Status:        task.Status,
+		Running:       task.running,
 		Username:      task.Username,
-		Password:      task.Password,
+		Account:       task.Account,
+		Proxy:         task.Proxy,
+		Fingerprint:   task.Fingerprint,
+		Polling:       task.Polling,
+		Condition:     task.Condition,
 		WebhookURL:    task.WebhookURL,
 		HomepageURL:   task.HomepageURL,
 		SSOManagerURL: task.SSOManagerURL,
+		StartAt:       task.StartAt,
+		Phase:         task.Phase,
+		WaitUntil:     task.WaitUntil,
+		Capture:       task.Capture,
+		TimeTicket:    task.TimeTicket,
+		Readiness:     task.Readiness,
+		Results:       task.Results,
+		MFA:           task.mfa.pending(),
 	}
 }
 
@@ -141,36 +621,92 @@ func (tm *TaskManager) GetAllSanitizedTasks() []*SanitizedTask {
 	return tasks
 }
 
-// InitClient initializes the HTTP client for the task.
-func (t *Task) InitClient() {
+// InitClient initializes the HTTP client for the task, posing as the task's
+// fingerprint and routed through the task's proxy if it has one.
+func (t *Task) InitClient() error {
+	t.fingerprint = t.resolveFingerprint()
 	jar := tls_client.NewCookieJar()
 	clientOptions := []tls_client.HttpClientOption{
-		tls_client.WithClientProfile(profiles.Chrome_117),
+		tls_client.WithClientProfile(t.fingerprint.clientProfile),
 		tls_client.WithCookieJar(jar),
 	}
-	t.Client, _ = tls_client.NewHttpClient(tls_client.NewLogger(), clientOptions...)
+
+	t.proxyPinned = false
+	proxy, err := t.resolveProxy()
+	if err != nil {
+		t.log().Error("choosing proxy", "error", err)
+		return err
+	}
+	if t.proxy = proxy; proxy != "" {
+		clientOptions = append(clientOptions, tls_client.WithProxyUrl(proxy))
+		t.log().Info("using proxy", "proxy", redactProxy(proxy))
+	}
+	t.Client, err = tls_client.NewHttpClient(tls_client.NewLogger(), clientOptions...)
+	return err
 }
 
 // MakeReq creates a new HTTP request with the given method, URL, headers, and body.
 func (t *Task) MakeReq(method, url string, headers [][2]string, body []byte) *http.Request {
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
 	if err != nil {
-		fmt.Println(err)
+		t.log().Error("building request", "method", method, "url", url, "error", err)
 	}
 	for _, header := range headers {
 		req.Header.Add(header[0], header[1])
 	}
+	t.orderHeaders(req)
 	return req
 }
 
 // DoReq executes the given HTTP request.
 func (t *Task) DoReq(req *http.Request) (*http.Response, error) {
-	return t.Client.Do(req)
+	target := *req.URL
+	if base, ok := t.hostOverrides[req.URL.Host]; ok {
+		if override, err := url.Parse(base); err == nil {
+			req.URL.Scheme, req.URL.Host = override.Scheme, override.Host
+			req.Host = ""
+		}
+	}
+
+	for retried := false; ; retried = true {
+		started := time.Now()
+		resp, err := t.Client.Do(req)
+		duration := time.Since(started)
+		if t.har != nil {
+			t.har.record(t, &target, req, resp, started, duration, err)
+		}
+		if err != nil {
+			observeRequest(req.Method, req.URL, 0, duration)
+			t.log().Warn("request failed", "method", req.Method, "url", req.URL.String(), "duration", duration, "error", err)
+		} else {
+			observeRequest(req.Method, req.URL, resp.StatusCode, duration)
+			t.log().Debug("request", "method", req.Method, "url", req.URL.String(), "status", resp.StatusCode, "duration", duration)
+		}
+
+		// A pooled task that hits a dead or throttled proxy moves to the
+		// next one and retries the request once.
+		if retried || req.GetBody == nil || !t.shouldRotateProxy(resp, err) {
+			return resp, err
+		}
+		cause := err
+		if cause == nil {
+			cause = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if !t.rotateProxy(cause) {
+			return resp, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return resp, err
+		}
+		discardResp(resp)
+		req.Body = body
+	}
 }
 
 // discardResp discards the response body to free up resources.
 func discardResp(resp *http.Response) {
-	if resp.Body != nil {
+	if resp != nil && resp.Body != nil {
 		io.Copy(io.Discard, resp.Body)
 		defer resp.Body.Close()
 	}
@@ -217,37 +753,37 @@ func formatDuration(duration time.Duration) string {
 	return fmt.Sprintf("%dd %dh %dm %ds", days, hours, minutes, seconds)
 }
 
-// extractModel extracts the model from the JSON data.
-func extractModel(jsonData []byte) (map[string]interface{}, error) {
-	var data AddCourse
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		return nil, err
+// SendNotification sends a notification with the given action and message.
+func (t *Task) SendNotification(action string, message string) error {
+	if t.WebhookURL == "" {
+		return nil
 	}
-	return data.Model, nil
+	return t.sendEmbed(Embed{Title: action, Description: message})
 }
 
-// SendNotification sends a notification with the given action and message.
-func (t *Task) SendNotification(action string, message string) error {
+// sendEmbed posts an embed to the task's webhook.
+func (t *Task) sendEmbed(embed Embed) error {
+	if t.WebhookURL == "" {
+		return nil
+	}
+	embed.Footer = &Footer{Text: "Veil"}
+	embed.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
 	payload := WebhookPayload{
 		Username: "veil",
-		Embeds: []Embed{
-			{
-				Title:       action,
-				Description: message,
-				Footer: &Footer{
-					Text: "Veil",
-				},
-				Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
-			},
-		},
+		Embeds:   []Embed{embed},
 	}
 	jsonData, _ := json.Marshal(payload)
-	headers := [][2]string{
-		{"accept", "application/json"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/json"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
+	headers := t.headers(acceptJSON, contentJSON)
+	response, err := t.DoReq(t.MakeReq("POST", t.WebhookURL, headers, []byte(string(jsonData))))
+	discardResp(response)
+	if err == nil && response.StatusCode >= 300 {
+		err = fmt.Errorf("webhook returned %s", response.Status)
+	}
+	if err != nil {
+		notificationsTotal.WithLabelValues("discord", "failure").Inc()
+		t.log().Warn("notification failed", "error", err)
+		return err
 	}
-	t.DoReq(t.MakeReq("POST", t.WebhookURL, headers, []byte(string(jsonData))))
+	notificationsTotal.WithLabelValues("discord", "success").Inc()
 	return nil
 }
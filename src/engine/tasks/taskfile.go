@@ -0,0 +1,655 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"proj/apitypes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported task file formats.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// TaskFile is a declarative description of accounts, notifiers and tasks.
+type TaskFile struct {
+	Version   int                 `json:"version" yaml:"version" toml:"version"`
+	Accounts  []AccountSpec       `json:"accounts,omitempty" yaml:"accounts,omitempty" toml:"accounts,omitempty"`
+	Notifiers []NotifierSpec      `json:"notifiers,omitempty" yaml:"notifiers,omitempty" toml:"notifiers,omitempty"`
+	Terms     map[string]string   `json:"terms,omitempty" yaml:"terms,omitempty" toml:"terms,omitempty"`
+	CRNGroups map[string][]string `json:"crn_groups,omitempty" yaml:"crn_groups,omitempty" toml:"crn_groups,omitempty"`
+	Tasks     []TaskSpec          `json:"tasks" yaml:"tasks" toml:"tasks"`
+}
+
+// AccountSpec is a set of portal credentials tasks can refer to by ID. The
+// password may come from the file, from an environment variable, or from an
+// existing task signed in with the same username. A vault account carries no
+// credentials; its ID names an account in the engine's credential vault.
+// Tasks of the account use its proxy unless they set their own.
+type AccountSpec struct {
+	ID          string `json:"id" yaml:"id" toml:"id"`
+	Username    string `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty"`
+	Password    string `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty" yaml:"password_env,omitempty" toml:"password_env,omitempty"`
+	Vault       bool   `json:"vault,omitempty" yaml:"vault,omitempty" toml:"vault,omitempty"`
+	Proxy       string `json:"proxy,omitempty" yaml:"proxy,omitempty" toml:"proxy,omitempty"`
+}
+
+// NotifierSpec is a notification channel tasks can refer to by ID.
+type NotifierSpec struct {
+	ID         string `json:"id" yaml:"id" toml:"id"`
+	Type       string `json:"type" yaml:"type" toml:"type"`
+	WebhookURL string `json:"webhook_url" yaml:"webhook_url" toml:"webhook_url"`
+}
+
+// TaskSpec describes one task. Term may be a code or a key of Terms, and the
+// CRNs are the union of CRNs and the CRN group named by Group.
+type TaskSpec struct {
+	ID           string        `json:"id" yaml:"id" toml:"id"`
+	Mode         string        `json:"mode" yaml:"mode" toml:"mode"`
+	Account      string        `json:"account,omitempty" yaml:"account,omitempty" toml:"account,omitempty"`
+	Term         string        `json:"term" yaml:"term" toml:"term"`
+	Institution  string        `json:"institution,omitempty" yaml:"institution,omitempty" toml:"institution,omitempty"`
+	CRNs         []string      `json:"crns,omitempty" yaml:"crns,omitempty" toml:"crns,omitempty"`
+	Subject      string        `json:"subject,omitempty" yaml:"subject,omitempty" toml:"subject,omitempty"`
+	CourseNumber string        `json:"course_number,omitempty" yaml:"course_number,omitempty" toml:"course_number,omitempty"`
+	Group        string        `json:"group,omitempty" yaml:"group,omitempty" toml:"group,omitempty"`
+	Notifier     string        `json:"notifier,omitempty" yaml:"notifier,omitempty" toml:"notifier,omitempty"`
+	Proxy        string        `json:"proxy,omitempty" yaml:"proxy,omitempty" toml:"proxy,omitempty"`
+	Fingerprint  string        `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty" toml:"fingerprint,omitempty"`
+	Polling      *PollPolicy   `json:"polling,omitempty" yaml:"polling,omitempty" toml:"polling,omitempty"`
+	Condition    string        `json:"condition,omitempty" yaml:"condition,omitempty" toml:"condition,omitempty"`
+	Schedule     *ScheduleSpec `json:"schedule,omitempty" yaml:"schedule,omitempty" toml:"schedule,omitempty"`
+}
+
+// ScheduleSpec controls when an imported task starts.
+type ScheduleSpec struct {
+	StartAt   string `json:"start_at,omitempty" yaml:"start_at,omitempty" toml:"start_at,omitempty"`
+	Autostart bool   `json:"autostart,omitempty" yaml:"autostart,omitempty" toml:"autostart,omitempty"`
+	// TimeTicket starts the task shortly before its account's registration
+	// window opens.
+	TimeTicket bool `json:"time_ticket,omitempty" yaml:"time_ticket,omitempty" toml:"time_ticket,omitempty"`
+}
+
+// FileError is a single problem found in a task file.
+type FileError = apitypes.FileError
+
+// FileErrors collects every problem found in a task file.
+type FileErrors []FileError
+
+func (e FileErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fileErr := range e {
+		switch {
+		case fileErr.Line > 0 && fileErr.Path != "":
+			messages[i] = fmt.Sprintf("line %d: %s: %s", fileErr.Line, fileErr.Path, fileErr.Message)
+		case fileErr.Line > 0:
+			messages[i] = fmt.Sprintf("line %d: %s", fileErr.Line, fileErr.Message)
+		case fileErr.Path != "":
+			messages[i] = fmt.Sprintf("%s: %s", fileErr.Path, fileErr.Message)
+		default:
+			messages[i] = fileErr.Message
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// FormatFromName guesses a task file format from a file name or media type.
+func FormatFromName(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".toml"), strings.Contains(name, "toml"):
+		return FormatTOML
+	case strings.HasSuffix(name, ".json"), strings.Contains(name, "json"):
+		return FormatJSON
+	default:
+		return FormatYAML
+	}
+}
+
+// ParseTaskFile decodes and validates a task file. Every error carries the
+// line it was found on when the format allows it.
+func ParseTaskFile(data []byte, format string) (*TaskFile, error) {
+	var file TaskFile
+	var lines map[string]int
+
+	switch format {
+	case FormatYAML, FormatJSON:
+		// JSON is valid YAML, so both go through the YAML parser to keep
+		// line numbers.
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, yamlFileErrors(err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil {
+			return nil, yamlFileErrors(err)
+		}
+		lines = make(map[string]int)
+		collectYAMLLines(&root, "", lines)
+	case FormatTOML:
+		metadata, err := toml.Decode(string(data), &file)
+		if err != nil {
+			var parseErr toml.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, FileErrors{{Line: parseErr.Position.Line, Message: parseErr.Message}}
+			}
+			return nil, FileErrors{{Message: err.Error()}}
+		}
+		lines = collectTOMLLines(data)
+		var unknown FileErrors
+		for _, key := range metadata.Undecoded() {
+			path, line := findTOMLKey(lines, key)
+			unknown = append(unknown, FileError{Line: line, Path: path, Message: "unknown field"})
+		}
+		if len(unknown) > 0 {
+			return nil, unknown
+		}
+	default:
+		return nil, FileErrors{{Message: fmt.Sprintf("unsupported format %q", format)}}
+	}
+
+	if errs := file.validate(); len(errs) > 0 {
+		for i := range errs {
+			errs[i].Line = lineFor(lines, errs[i].Path)
+		}
+		return nil, errs
+	}
+	return &file, nil
+}
+
+// Encode writes the task file in the given format.
+func (f *TaskFile) Encode(format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(f, "", "  ")
+	case FormatTOML:
+		var buffer bytes.Buffer
+		err := toml.NewEncoder(&buffer).Encode(f)
+		return buffer.Bytes(), err
+	case FormatYAML:
+		return yaml.Marshal(f)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// validate checks the file against the task file schema and returns errors
+// keyed by path.
+func (f *TaskFile) validate() FileErrors {
+	var errs FileErrors
+	fail := func(path, format string, args ...any) {
+		errs = append(errs, FileError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if f.Version != 1 {
+		fail("version", "must be 1")
+	}
+
+	accounts := make(map[string]bool)
+	for i, account := range f.Accounts {
+		path := fmt.Sprintf("accounts[%d]", i)
+		switch {
+		case !taskIDPattern.MatchString(account.ID):
+			fail(path+".id", "must be 1-64 letters, digits, '-' or '_'")
+		case accounts[account.ID]:
+			fail(path+".id", "duplicate account %q", account.ID)
+		}
+		accounts[account.ID] = true
+		if account.Vault {
+			if account.Username != "" || account.Password != "" || account.PasswordEnv != "" {
+				fail(path+".vault", "vault accounts take their credentials from the vault")
+			}
+			continue
+		}
+		if strings.TrimSpace(account.Username) == "" {
+			fail(path+".username", "is required")
+		}
+		if account.Password != "" && account.PasswordEnv != "" {
+			fail(path+".password", "set either password or password_env, not both")
+		}
+	}
+
+	notifiers := make(map[string]bool)
+	for i, notifier := range f.Notifiers {
+		path := fmt.Sprintf("notifiers[%d]", i)
+		switch {
+		case !taskIDPattern.MatchString(notifier.ID):
+			fail(path+".id", "must be 1-64 letters, digits, '-' or '_'")
+		case notifiers[notifier.ID]:
+			fail(path+".id", "duplicate notifier %q", notifier.ID)
+		}
+		notifiers[notifier.ID] = true
+		if notifier.Type != "discord" {
+			fail(path+".type", "must be discord")
+		}
+		probe := Task{WebhookURL: notifier.WebhookURL}
+		if notifier.WebhookURL == "" || probe.validateWebhook() != nil {
+			fail(path+".webhook_url", "must be an http or https URL")
+		}
+	}
+
+	for alias, code := range f.Terms {
+		if !termPattern.MatchString(code) {
+			fail("terms."+alias, "must be a 6 digit term code such as 202442")
+		}
+	}
+	for name, crns := range f.CRNGroups {
+		for i, crn := range crns {
+			if !crnPattern.MatchString(crn) {
+				fail(fmt.Sprintf("crn_groups.%s[%d]", name, i), "%q is not a 5 digit CRN", crn)
+			}
+		}
+	}
+
+	if len(f.Tasks) == 0 {
+		fail("tasks", "must define at least one task")
+	}
+	ids := make(map[string]bool)
+	for i, spec := range f.Tasks {
+		path := fmt.Sprintf("tasks[%d]", i)
+		before := len(errs)
+		if ids[spec.ID] {
+			fail(path+".id", "duplicate task %q", spec.ID)
+		}
+		ids[spec.ID] = true
+		if spec.Account == "" && spec.Mode != "Notify" {
+			fail(path+".account", "is required")
+		} else if spec.Account != "" && !accounts[spec.Account] {
+			fail(path+".account", "unknown account %q", spec.Account)
+		}
+		if spec.Notifier != "" && !notifiers[spec.Notifier] {
+			fail(path+".notifier", "unknown notifier %q", spec.Notifier)
+		}
+		if _, exists := f.Terms[spec.Term]; !exists && !termPattern.MatchString(spec.Term) {
+			fail(path+".term", "must be a 6 digit term code or a key of terms")
+		}
+		if spec.Group != "" {
+			if _, exists := f.CRNGroups[spec.Group]; !exists {
+				fail(path+".group", "unknown CRN group %q", spec.Group)
+			}
+		}
+		if spec.Schedule != nil && spec.Schedule.StartAt != "" {
+			if _, err := time.Parse(time.RFC3339, spec.Schedule.StartAt); err != nil {
+				fail(path+".schedule.start_at", "must be an RFC3339 timestamp")
+			}
+		}
+		if len(errs) == before {
+			// Only check the assembled task once its references resolve.
+			task := f.buildTask(spec, "")
+			if task.Account == "" && task.Username != "" {
+				task.Password = "-"
+			}
+			if err := task.Validate(); err != nil {
+				var validationErr *ValidationError
+				if errors.As(err, &validationErr) {
+					fail(path+"."+specField(validationErr.Field), "%s", validationErr.Message)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// specField maps a Task JSON field onto the TaskSpec field that feeds it.
+func specField(field string) string {
+	switch field {
+	case "username", "password":
+		return "account"
+	case "webhook_url":
+		return "notifier"
+	}
+	return field
+}
+
+// buildTask assembles a Task from a spec, resolving aliases and groups.
+func (f *TaskFile) buildTask(spec TaskSpec, password string) *Task {
+	term := spec.Term
+	if code, exists := f.Terms[term]; exists {
+		term = code
+	}
+
+	crns := append([]string{}, spec.CRNs...)
+	for _, crn := range f.CRNGroups[spec.Group] {
+		if !contains(crns, crn) {
+			crns = append(crns, crn)
+		}
+	}
+
+	task := &Task{
+		ID:          spec.ID,
+		Mode:        spec.Mode,
+		Term:        term,
+		Institution: spec.Institution,
+		Crns:        strings.Join(crns, ","),
+		Password:    password,
+	}
+	for _, account := range f.Accounts {
+		if account.ID == spec.Account {
+			task.Proxy = account.Proxy
+		}
+		if account.ID == spec.Account && account.Vault {
+			task.Account = account.ID
+			task.Password = ""
+		} else if account.ID == spec.Account {
+			task.Username = account.Username
+		}
+	}
+	if spec.Proxy != "" {
+		task.Proxy = spec.Proxy
+	}
+	task.Fingerprint = spec.Fingerprint
+	task.Subject, task.CourseNumber = spec.Subject, spec.CourseNumber
+	task.Polling = spec.Polling
+	task.Condition = spec.Condition
+	for _, notifier := range f.Notifiers {
+		if notifier.ID == spec.Notifier {
+			task.WebhookURL = notifier.WebhookURL
+		}
+	}
+	if spec.Schedule != nil && spec.Schedule.StartAt != "" {
+		startAt, _ := time.Parse(time.RFC3339, spec.Schedule.StartAt)
+		task.StartAt = &startAt
+	}
+	task.TimeTicket = spec.Schedule != nil && spec.Schedule.TimeTicket
+	return task
+}
+
+// ImportTasks creates the tasks described by a parsed task file. With replace
+// set, existing tasks with the same IDs are replaced; if any task cannot be
+// created, the existing ones are left as they were. Scheduled tasks are armed
+// and autostart tasks are started.
+func (tm *TaskManager) ImportTasks(file *TaskFile, replace bool) ([]*Task, error) {
+	passwords := make(map[string]string)
+	var errs FileErrors
+	for i, account := range file.Accounts {
+		if account.Vault {
+			continue
+		}
+		password := account.Password
+		if account.PasswordEnv != "" {
+			password = os.Getenv(account.PasswordEnv)
+		}
+		if password == "" {
+			password = tm.passwordFor(account.Username)
+		}
+		if password == "" {
+			errs = append(errs, FileError{
+				Path:    fmt.Sprintf("accounts[%d].password", i),
+				Message: "no password given and no existing task signs in as this username",
+			})
+		}
+		passwords[account.ID] = password
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	imported := make([]*Task, 0, len(file.Tasks))
+	for _, spec := range file.Tasks {
+		imported = append(imported, file.buildTask(spec, passwords[spec.Account]))
+	}
+
+	tm.mutex.Lock()
+	err := tm.addTasks(imported, replace)
+	tm.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, spec := range file.Tasks {
+		task := imported[i]
+		switch {
+		case task.StartAt != nil:
+			tm.ScheduleTask(task.ID, *task.StartAt)
+		case spec.Schedule != nil && spec.Schedule.Autostart:
+			tm.RunTask(task.ID)
+		}
+	}
+	return imported, nil
+}
+
+// passwordFor returns the password of an existing task signed in as username.
+func (tm *TaskManager) passwordFor(username string) string {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	for _, task := range tm.Tasks {
+		if task.Username == username && task.Password != "" {
+			return task.Password
+		}
+	}
+	return ""
+}
+
+// ExportTasks describes every task as a task file. Passwords are never
+// exported; accounts are keyed by username so a re-import can reuse the
+// passwords of tasks already loaded, and vault accounts keep their IDs.
+func (tm *TaskManager) ExportTasks() *TaskFile {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	ids := make([]string, 0, len(tm.Tasks))
+	for id := range tm.Tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	file := &TaskFile{Version: 1, Tasks: []TaskSpec{}}
+	accounts := make(map[string]string)
+	notifiers := make(map[string]string)
+	// Vault account IDs are kept, so generated IDs must steer clear of them.
+	vaultAccounts := make(map[string]bool)
+	generated := 0
+	for _, task := range tm.Tasks {
+		if task.Account != "" {
+			vaultAccounts[task.Account] = false
+		}
+	}
+	for _, id := range ids {
+		task := tm.Tasks[id]
+
+		accountID, exists := accounts[task.Username]
+		if task.Account == "" && task.Username == "" {
+			// Notify tasks may run without credentials.
+			accountID = ""
+		} else if task.Account != "" {
+			accountID = task.Account
+			if !vaultAccounts[accountID] {
+				vaultAccounts[accountID] = true
+				file.Accounts = append(file.Accounts, AccountSpec{ID: accountID, Vault: true})
+			}
+		} else if !exists {
+			for taken := true; taken; _, taken = vaultAccounts[accountID] {
+				generated++
+				accountID = fmt.Sprintf("account-%d", generated)
+			}
+			accounts[task.Username] = accountID
+			file.Accounts = append(file.Accounts, AccountSpec{ID: accountID, Username: task.Username})
+		}
+
+		spec := TaskSpec{
+			ID:           task.ID,
+			Mode:         task.Mode,
+			Account:      accountID,
+			Term:         task.Term,
+			Institution:  task.Institution,
+			CRNs:         splitCRNs(task.Crns),
+			Subject:      task.Subject,
+			CourseNumber: task.CourseNumber,
+			Proxy:        task.Proxy,
+			Fingerprint:  task.Fingerprint,
+			Polling:      task.Polling,
+			Condition:    task.Condition,
+		}
+		if task.WebhookURL != "" {
+			notifierID, exists := notifiers[task.WebhookURL]
+			if !exists {
+				notifierID = fmt.Sprintf("notifier-%d", len(notifiers)+1)
+				notifiers[task.WebhookURL] = notifierID
+				file.Notifiers = append(file.Notifiers, NotifierSpec{ID: notifierID, Type: "discord", WebhookURL: task.WebhookURL})
+			}
+			spec.Notifier = notifierID
+		}
+		switch {
+		case task.TimeTicket:
+			// The start time follows the account's time ticket.
+			spec.Schedule = &ScheduleSpec{TimeTicket: true}
+		case task.StartAt != nil:
+			spec.Schedule = &ScheduleSpec{StartAt: task.StartAt.Format(time.RFC3339)}
+		}
+		file.Tasks = append(file.Tasks, spec)
+	}
+	return file
+}
+
+var yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+
+// yamlFileErrors converts a yaml.v3 error into FileErrors with line numbers.
+func yamlFileErrors(err error) FileErrors {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	errs := make(FileErrors, 0, len(messages))
+	for _, message := range messages {
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			errs = append(errs, FileError{Line: line, Message: match[2]})
+		} else {
+			errs = append(errs, FileError{Message: message})
+		}
+	}
+	return errs
+}
+
+// collectYAMLLines records the line of every key and sequence item by path.
+func collectYAMLLines(node *yaml.Node, path string, lines map[string]int) {
+	if path != "" {
+		lines[path] = node.Line
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectYAMLLines(child, path, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			collectYAMLLines(node.Content[i+1], key, lines)
+			lines[key] = node.Content[i].Line
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			collectYAMLLines(child, fmt.Sprintf("%s[%d]", path, i), lines)
+		}
+	}
+}
+
+var (
+	tomlArrayHeader = regexp.MustCompile(`^\[\[\s*([A-Za-z0-9_.-]+)\s*\]\]`)
+	tomlTableHeader = regexp.MustCompile(`^\[\s*([A-Za-z0-9_.-]+)\s*\]`)
+	tomlKeyLine     = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=`)
+)
+
+// collectTOMLLines records the line of tables and keys by path. It handles
+// the shapes a task file uses: top-level keys, [tables], [[arrays]] and
+// sub-tables of the last array entry.
+func collectTOMLLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	counts := make(map[string]int)
+	table := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if match := tomlArrayHeader.FindStringSubmatch(text); match != nil {
+			name := match[1]
+			table = fmt.Sprintf("%s[%d]", name, counts[name])
+			counts[name]++
+			lines[table] = number
+			continue
+		}
+		if match := tomlTableHeader.FindStringSubmatch(text); match != nil {
+			parts := strings.SplitN(match[1], ".", 2)
+			if count, exists := counts[parts[0]]; exists && len(parts) == 2 {
+				table = fmt.Sprintf("%s[%d].%s", parts[0], count-1, parts[1])
+			} else {
+				table = match[1]
+			}
+			lines[table] = number
+			continue
+		}
+		if match := tomlKeyLine.FindStringSubmatch(text); match != nil {
+			key := match[1]
+			if table != "" {
+				key = table + "." + key
+			}
+			lines[key] = number
+		}
+	}
+	return lines
+}
+
+// findTOMLKey finds the path and line of a decoded TOML key. TOML keys do
+// not carry array indexes, so the first matching array entry is used.
+func findTOMLKey(lines map[string]int, key toml.Key) (string, int) {
+	parts := make([]string, len(key))
+	for i, part := range key {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern := regexp.MustCompile("^" + strings.Join(parts, `(\[\d+\])?\.`) + "$")
+
+	bestPath, bestLine := key.String(), 0
+	for path, line := range lines {
+		if pattern.MatchString(path) && (bestLine == 0 || line < bestLine) {
+			bestPath, bestLine = path, line
+		}
+	}
+	return bestPath, bestLine
+}
+
+// lineFor returns the line of path, falling back to its closest parent.
+func lineFor(lines map[string]int, path string) int {
+	for path != "" {
+		if line, exists := lines[path]; exists {
+			return line
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return 0
+}
+
+// contains reports whether values holds value.
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
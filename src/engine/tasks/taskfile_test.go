@@ -0,0 +1,162 @@
+package tasks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The same task file in each format: a term alias, a CRN group and a vault
+// account.
+var taskFiles = map[string]string{
+	FormatYAML: `version: 1
+accounts:
+  - id: main
+    vault: true
+terms:
+  fall: "202442"
+crn_groups:
+  labs: ["23456", "34567"]
+tasks:
+  - id: fall-signup
+    mode: Signup
+    account: main
+    term: fall
+    crns: ["12345", "23456"]
+    group: labs
+`,
+	FormatJSON: `{
+  "version": 1,
+  "accounts": [{"id": "main", "vault": true}],
+  "terms": {"fall": "202442"},
+  "crn_groups": {"labs": ["23456", "34567"]},
+  "tasks": [
+    {"id": "fall-signup", "mode": "Signup", "account": "main", "term": "fall", "crns": ["12345", "23456"], "group": "labs"}
+  ]
+}
+`,
+	FormatTOML: `version = 1
+
+[terms]
+fall = "202442"
+
+[crn_groups]
+labs = ["23456", "34567"]
+
+[[accounts]]
+id = "main"
+vault = true
+
+[[tasks]]
+id = "fall-signup"
+mode = "Signup"
+account = "main"
+term = "fall"
+crns = ["12345", "23456"]
+group = "labs"
+`,
+}
+
+func TestParseTaskFile(t *testing.T) {
+	for format, data := range taskFiles {
+		file, err := ParseTaskFile([]byte(data), format)
+		if err != nil {
+			t.Errorf("%s: ParseTaskFile: %v", format, err)
+			continue
+		}
+		if len(file.Tasks) != 1 {
+			t.Fatalf("%s: tasks = %+v, want one", format, file.Tasks)
+		}
+		task := file.buildTask(file.Tasks[0], "")
+		if task.Term != "202442" || task.Crns != "12345,23456,34567" || task.Account != "main" || task.Username != "" {
+			t.Errorf("%s: built task = term %q, CRNs %q, account %q, username %q; want the alias, group and vault account resolved",
+				format, task.Term, task.Crns, task.Account, task.Username)
+		}
+	}
+}
+
+func TestParseTaskFileErrorLines(t *testing.T) {
+	tests := []struct {
+		name, format, data string
+		want               FileErrors
+	}{
+		{
+			"unknown YAML field",
+			FormatYAML,
+			"version: 1\ntasks:\n  - id: a\n    mode: Signup\n    color: blue\n",
+			FileErrors{{Line: 5, Message: "field color not found in type tasks.TaskSpec"}},
+		},
+		{
+			"YAML syntax",
+			FormatYAML,
+			"version: 1\ntasks:\n  - id: [a\n",
+			nil,
+		},
+		{
+			"unknown TOML field",
+			FormatTOML,
+			"version = 1\n\n[[tasks]]\nid = \"a\"\ncolor = \"blue\"\n",
+			FileErrors{{Line: 5, Path: "tasks[0].color", Message: "unknown field"}},
+		},
+		{
+			"unknown references",
+			FormatYAML,
+			"version: 1\ntasks:\n  - id: a\n    mode: Signup\n    account: nobody\n    term: spring\n    crns: [\"12345\"]\n",
+			FileErrors{
+				{Line: 5, Path: "tasks[0].account", Message: `unknown account "nobody"`},
+				{Line: 6, Path: "tasks[0].term", Message: "must be a 6 digit term code or a key of terms"},
+			},
+		},
+		{
+			"bad CRN group in JSON",
+			FormatJSON,
+			"{\n  \"version\": 1,\n  \"crn_groups\": {\"labs\": [\"1234\"]},\n  \"tasks\": []\n}\n",
+			FileErrors{
+				{Line: 3, Path: "crn_groups.labs[0]", Message: `"1234" is not a 5 digit CRN`},
+				{Line: 4, Path: "tasks", Message: "must define at least one task"},
+			},
+		},
+		{
+			"task validation",
+			FormatTOML,
+			"version = 1\n\n[[accounts]]\nid = \"main\"\nvault = true\n\n[[tasks]]\nid = \"a\"\nmode = \"Signup\"\naccount = \"main\"\nterm = \"202442\"\ncrns = [\"12345\", \"12345\"]\n",
+			FileErrors{{Line: 12, Path: "tasks[0].crns", Message: `"12345" is listed more than once`}},
+		},
+	}
+	for _, tc := range tests {
+		_, err := ParseTaskFile([]byte(tc.data), tc.format)
+		var errs FileErrors
+		if !errors.As(err, &errs) || len(errs) == 0 {
+			t.Errorf("%s: ParseTaskFile = %v, want FileErrors", tc.name, err)
+			continue
+		}
+		if tc.want == nil {
+			// Syntax errors only promise a line near the mistake.
+			if errs[0].Line == 0 || errs[0].Message == "" {
+				t.Errorf("%s: errors = %+v, want one with a line", tc.name, errs)
+			}
+			continue
+		}
+		if len(errs) != len(tc.want) {
+			t.Errorf("%s: errors = %+v, want %+v", tc.name, errs, tc.want)
+			continue
+		}
+		for i := range tc.want {
+			if errs[i] != tc.want[i] {
+				t.Errorf("%s: error %d = %+v, want %+v", tc.name, i, errs[i], tc.want[i])
+			}
+		}
+	}
+}
+
+func TestParseTaskFileFormat(t *testing.T) {
+	_, err := ParseTaskFile([]byte("version: 1"), "xml")
+	if err == nil || !strings.Contains(err.Error(), `unsupported format "xml"`) {
+		t.Errorf("ParseTaskFile(xml) = %v, want an unsupported format error", err)
+	}
+	for name, want := range map[string]string{"tasks.toml": FormatTOML, "application/json": FormatJSON, "tasks.yml": FormatYAML} {
+		if got := FormatFromName(name); got != want {
+			t.Errorf("FormatFromName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"proj/apitypes"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTimeTicketLead is how long before a registration window opens its
+// time ticket tasks start by default.
+const DefaultTimeTicketLead = 2 * time.Minute
+
+// Where a scheduled start came from.
+const (
+	StartFromTimeTicket = "time_ticket"
+	StartManual         = "manual"
+)
+
+// ScheduledStart is an upcoming start of a task, or a time ticket task whose
+// start is not known yet.
+type ScheduledStart = apitypes.ScheduledStart
+
+// ticketKey names the registration window one account has for a term.
+type ticketKey struct {
+	account, institution, term string
+}
+
+// ticketKey returns whose registration window the task waits on.
+func (t *Task) ticketKey() ticketKey {
+	account := t.Account
+	if account == "" {
+		account = "username:" + t.Username
+	}
+	return ticketKey{account, t.institution().ID, t.Term}
+}
+
+// requestTicketRefresh asks RunTimeTickets to refresh without blocking.
+func (tm *TaskManager) requestTicketRefresh() {
+	select {
+	case tm.ticketRequests <- struct{}{}:
+	default:
+	}
+}
+
+// RunTimeTickets refreshes the registration windows of time ticket tasks
+// every interval, and soon after such a task is created or changed, until
+// ctx is done.
+func (tm *TaskManager) RunTimeTickets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		tm.RefreshTimeTickets(ctx)
+		select {
+		case <-ticker.C:
+		case <-tm.ticketRequests:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RefreshTimeTickets signs in once per account, institution and term that
+// time ticket tasks wait on, reads the registration window and schedules
+// the tasks to start TimeTicketLead before it opens.
+func (tm *TaskManager) RefreshTimeTickets(ctx context.Context) {
+	tm.mutex.Lock()
+	groups := make(map[ticketKey][]*Task)
+	probes := make(map[ticketKey]*Task)
+	for _, task := range tm.Tasks {
+		if !task.TimeTicket || task.running || task.phase() == PhaseDone {
+			continue
+		}
+		key := task.ticketKey()
+		if _, exists := probes[key]; !exists {
+			probes[key] = tm.probe(&Task{
+				ID:          "time-ticket-" + task.ID,
+				Term:        task.Term,
+				Institution: task.Institution,
+				Username:    task.Username,
+				Password:    task.Password,
+				Account:     task.Account,
+				Proxy:       task.Proxy,
+				Fingerprint: task.Fingerprint,
+			})
+		}
+		groups[key] = append(groups[key], task)
+	}
+	tm.mutex.Unlock()
+
+	for key, probe := range probes {
+		eligibility, err := probe.checkEligibility(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("reading time ticket", "term", key.term, "institution", key.institution, "error", err)
+		}
+
+		tm.mutex.Lock()
+		for _, task := range groups[key] {
+			if tm.Tasks[task.ID] != task || task.running || !task.TimeTicket {
+				continue
+			}
+			tm.applyTimeTicket(task, eligibility, err)
+		}
+		tm.mutex.Unlock()
+	}
+	tm.requestCheckpoint()
+}
+
+// applyTimeTicket schedules a task by its account's eligibility. Callers
+// hold the mutex.
+func (tm *TaskManager) applyTimeTicket(task *Task, eligibility *Eligibility, err error) {
+	task.ticket, task.ticketError = eligibility, ""
+	switch {
+	case err != nil:
+		task.ticketError = err.Error()
+	case !eligibility.Ready:
+		for _, failure := range eligibility.Failures {
+			if failure.Kind != EligibilityTimeTicket {
+				task.ticketError = failure.Message
+				break
+			}
+		}
+		if task.ticketError == "" {
+			task.ticketError = "account is not eligible to register"
+		}
+	case eligibility.Valid, eligibility.RegistrationOpens != nil && !eligibility.RegistrationOpens.After(time.Now()):
+		task.ticketError = "registration is already open"
+	case eligibility.RegistrationOpens == nil:
+		task.ticketError = "Banner reported no registration window"
+	case task.phase() != "" || task.ticketOpens.Equal(*eligibility.RegistrationOpens):
+		// The task already ran, or was scheduled for this window; starting
+		// it again would repeat a run that was stopped or failed.
+	default:
+		// A window opening within the lead time starts the task right away.
+		start := eligibility.RegistrationOpens.Add(-tm.TimeTicketLead)
+		if !start.After(time.Now()) {
+			start = time.Now()
+		}
+		task.log().Info("scheduled by time ticket", "opens_at", *eligibility.RegistrationOpens, "start_at", start)
+		task.ticketOpens = *eligibility.RegistrationOpens
+		tm.schedule(task, start)
+	}
+}
+
+// Schedule lists the tasks that are due to start, and time ticket tasks
+// whose start is not known yet, soonest first.
+func (tm *TaskManager) Schedule() []ScheduledStart {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	now := time.Now()
+	starts := make([]ScheduledStart, 0)
+	for _, task := range tm.Tasks {
+		upcoming := task.StartAt != nil && task.StartAt.After(now)
+		if task.running || (!upcoming && (!task.TimeTicket || task.phase() == PhaseDone)) {
+			continue
+		}
+		start := ScheduledStart{
+			TaskID:      task.ID,
+			Mode:        task.Mode,
+			Term:        task.Term,
+			Institution: task.institution().ID,
+			Account:     task.Account,
+			CRNs:        splitCRNs(task.Crns),
+			Source:      StartManual,
+		}
+		if start.Account == "" {
+			start.Account = task.Username
+		}
+		if upcoming {
+			at := *task.StartAt
+			start.StartAt = &at
+		}
+		if task.TimeTicket {
+			start.Source = StartFromTimeTicket
+			start.Error = task.ticketError
+			if task.ticket != nil {
+				start.RegistrationOpens = task.ticket.RegistrationOpens
+				start.RegistrationCloses = task.ticket.RegistrationCloses
+				start.CheckedAt = &task.ticket.CheckedAt
+			}
+		}
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		a, b := starts[i].StartAt, starts[j].StartAt
+		switch {
+		case a != nil && b != nil && !a.Equal(*b):
+			return a.Before(*b)
+		case (a == nil) != (b == nil):
+			return a != nil
+		}
+		return starts[i].TaskID < starts[j].TaskID
+	})
+	return starts
+}
+
+// ICalendar renders the scheduled starts as an iCalendar feed, one event
+// per start running until its registration window opens.
+func ICalendar(starts []ScheduledStart) []byte {
+	const stamp = "20060102T150405Z"
+	var builder strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&builder, format+"\r\n", args...)
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//veil//schedule//EN")
+	line("CALSCALE:GREGORIAN")
+	now := time.Now().UTC().Format(stamp)
+	for _, start := range starts {
+		if start.StartAt == nil {
+			continue
+		}
+		end := start.StartAt.Add(15 * time.Minute)
+		if opens := start.RegistrationOpens; opens != nil && opens.After(*start.StartAt) {
+			end = *opens
+		}
+		summary := fmt.Sprintf("%s for %s", start.Mode, start.Term)
+		if len(start.CRNs) > 0 {
+			summary += " (" + strings.Join(start.CRNs, ", ") + ")"
+		}
+		description := fmt.Sprintf("Task %s starts", start.TaskID)
+		if start.Source == StartFromTimeTicket && start.RegistrationOpens != nil {
+			description += fmt.Sprintf("; registration opens %s", start.RegistrationOpens.Format(time.RFC3339))
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:%s-%s@veil", icalText(start.TaskID), start.StartAt.UTC().Format(stamp))
+		line("DTSTAMP:%s", now)
+		line("DTSTART:%s", start.StartAt.UTC().Format(stamp))
+		line("DTEND:%s", end.UTC().Format(stamp))
+		line("SUMMARY:%s", icalText(summary))
+		line("DESCRIPTION:%s", icalText(description))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return []byte(builder.String())
+}
+
+// icalText escapes a value for an iCalendar text property.
+var icalText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "").Replace
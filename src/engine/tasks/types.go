@@ -1,5 +1,7 @@
 package tasks
 
+import "proj/apitypes"
+
 type RegistrationStatus struct {
 	StudentEligValid    bool     `json:"studentEligValid"`
 	StudentEligFailures []string `json:"studentEligFailures"`
@@ -347,25 +349,8 @@ type Courses struct {
 	ZtcEncodedImage string `json:"ztcEncodedImage"`
 }
 
-type CourseInfo struct {
-	TermDesc              string
-	CourseReferenceNumber string
-	Subject               string
-	CourseNumber          string
-	SequenceNumber        string
-	CourseTitle           string
-	DisplayName           string
-	BeginTime             string
-	EndTime               string
-	StartDate             string
-	EndDate               string
-	MeetingType           string
-	Room                  string
-	MaximumEnrollment     int
-	Enrollment            int
-	SeatsAvailable        int
-	WaitAvailable         int
-}
+// CourseInfo is one section a class search found.
+type CourseInfo = apitypes.CourseInfo
 
 type UserInfo struct {
 	Embedded struct {
@@ -0,0 +1,158 @@
+package tasks
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	taskIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	termPattern   = regexp.MustCompile(`^\d{6}$`)
+	crnPattern    = regexp.MustCompile(`^\d{5}$`)
+	// subjectPattern and courseNumberPattern match Banner subject codes and
+	// course numbers such as CIS and 22A.
+	subjectPattern      = regexp.MustCompile(`^[A-Za-z0-9]{1,8}$`)
+	courseNumberPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,8}$`)
+)
+
+// reservedIDs are path segments of the task API that cannot be task IDs.
+var reservedIDs = []string{"bulk", "start", "import", "export"}
+
+// Modes lists every task mode the engine knows how to run.
+var Modes = []string{"Signup", "Watch", "Notify", "DryRun"}
+
+// ValidationError describes a single invalid task field.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// splitCRNs splits a comma separated CRN list, trimming blanks.
+func splitCRNs(crns string) []string {
+	var result []string
+	for _, crn := range strings.Split(crns, ",") {
+		if crn = strings.TrimSpace(crn); crn != "" {
+			result = append(result, crn)
+		}
+	}
+	return result
+}
+
+// validMode reports whether mode is one of the known task modes.
+func validMode(mode string) bool {
+	for _, known := range Modes {
+		if mode == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the task fields before the task is stored.
+func (t *Task) Validate() error {
+	if !taskIDPattern.MatchString(t.ID) {
+		return &ValidationError{"id", "must be 1-64 letters, digits, '-' or '_'"}
+	}
+	if contains(reservedIDs, t.ID) {
+		return &ValidationError{"id", fmt.Sprintf("%q is reserved", t.ID)}
+	}
+	if !validMode(t.Mode) {
+		return &ValidationError{"mode", fmt.Sprintf("must be one of %s", strings.Join(Modes, ", "))}
+	}
+	institution, exists := InstitutionForTerm(t.Institution, t.Term)
+	if !exists {
+		return &ValidationError{"institution", fmt.Sprintf("unknown institution %q", t.Institution)}
+	}
+	if !institution.ValidTerm(t.Term) {
+		return institution.termError()
+	}
+
+	crns := splitCRNs(t.Crns)
+	if len(crns) == 0 {
+		return &ValidationError{"crns", "must list at least one CRN"}
+	}
+	seen := make(map[string]bool, len(crns))
+	for _, crn := range crns {
+		if !crnPattern.MatchString(crn) {
+			return &ValidationError{"crns", fmt.Sprintf("%q is not a 5 digit CRN", crn)}
+		}
+		if seen[crn] {
+			return &ValidationError{"crns", fmt.Sprintf("%q is listed more than once", crn)}
+		}
+		seen[crn] = true
+	}
+	if t.Mode == "Watch" && len(crns) != 1 {
+		return &ValidationError{"crns", "Watch mode monitors exactly one CRN"}
+	}
+	if t.Subject != "" && !subjectPattern.MatchString(t.Subject) {
+		return &ValidationError{"subject", "must be 1-8 letters or digits, e.g. CIS"}
+	}
+	if t.CourseNumber != "" && t.Subject == "" {
+		return &ValidationError{"course_number", "requires a subject"}
+	}
+	if t.CourseNumber != "" && !courseNumberPattern.MatchString(t.CourseNumber) {
+		return &ValidationError{"course_number", "must be 1-8 letters or digits, e.g. 22A"}
+	}
+
+	if t.Account != "" {
+		if !taskIDPattern.MatchString(t.Account) {
+			return &ValidationError{"account", "must be 1-64 letters, digits, '-' or '_'"}
+		}
+		if t.Username != "" || t.Password != "" {
+			return &ValidationError{"account", "set either account or username and password, not both"}
+		}
+	} else if t.Mode != "Notify" {
+		// Notify tasks never sign in, so they need no credentials.
+		if strings.TrimSpace(t.Username) == "" {
+			return &ValidationError{"username", "is required"}
+		}
+		if t.Password == "" {
+			return &ValidationError{"password", "is required"}
+		}
+	}
+	if t.Proxy != "" && t.Proxy != ProxyFromPool {
+		if err := validateProxyURL(t.Proxy); err != nil {
+			return &ValidationError{"proxy", err.Error() + `, or "pool"`}
+		}
+	}
+	if _, exists := LookupFingerprint(t.Fingerprint); !exists && t.Fingerprint != FingerprintRandom {
+		return &ValidationError{"fingerprint", fmt.Sprintf("unknown fingerprint %q", t.Fingerprint)}
+	}
+	if t.Polling != nil {
+		if err := validatePolling(t.Polling); err != nil {
+			return err
+		}
+	}
+	if t.TimeTicket && t.Mode != "Signup" {
+		return &ValidationError{"time_ticket", "only applies to Signup tasks"}
+	}
+	if t.Condition != "" {
+		if t.Mode != "Watch" {
+			return &ValidationError{"condition", "only applies to Watch tasks"}
+		}
+		if _, err := ParseCondition(t.Condition); err != nil {
+			return &ValidationError{"condition", err.Error()}
+		}
+	}
+	if t.WebhookURL != "" {
+		if err := t.validateWebhook(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateWebhook checks that the webhook is an absolute http(s) URL.
+func (t *Task) validateWebhook() error {
+	webhook, err := url.Parse(t.WebhookURL)
+	if err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || webhook.Host == "" {
+		return &ValidationError{"webhook_url", "must be an http or https URL"}
+	}
+	return nil
+}
@@ -1,8 +1,10 @@
 package tasks
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
+	"proj/apitypes"
 	"strconv"
 	"strings"
 	"time"
@@ -10,67 +12,135 @@ import (
 	"goquery"
 )
 
-// Watch monitors the course enrollment status.
-func (t *Task) Watch() error {
-	headers := [][2]string{
-		{"accept", "*/*"},
-		{"accept-language", "en-US,en;q=0.9"},
-		{"content-type", "application/x-www-form-urlencoded"},
-		{"user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"},
-	}
+// ErrEnrollmentUnreadable is returned when an enrollment page lacks the seat
+// counts, as Banner's error and maintenance pages do.
+var ErrEnrollmentUnreadable = errors.New("enrollment info could not be read")
+
+// Enrollment is the seat counts of one section.
+type Enrollment = apitypes.Enrollment
+
+// enrollmentLabels are the labels of the seat counts on an enrollment page.
+var enrollmentLabels = []string{
+	"Enrollment Seats Available:",
+	"Waitlist Capacity:",
+	"Waitlist Actual:",
+	"Waitlist Seats Available:",
+}
 
+// FetchEnrollment reads the seat counts of a section from its enrollment
+// page. Throttled polls return a *ThrottledError.
+func (t *Task) FetchEnrollment(term, crn string) (*Enrollment, error) {
+	headers := t.headers(acceptAny, contentForm)
 	values := url.Values{
-		"term":                  {t.Term},
-		"courseReferenceNumber": {t.Crns},
+		"term":                  {term},
+		"courseReferenceNumber": {crn},
 	}
 
-	response, err := t.DoReq(t.MakeReq("POST", "https://reg-prod.ec.fhda.edu/StudentRegistrationSsb/ssb/searchResults/getEnrollmentInfo", headers, []byte(values.Encode())))
+	watchPollsTotal.WithLabelValues(term, crn).Inc()
+	response, err := t.DoReq(t.MakeReq("POST", t.institution().bannerURL("/ssb/searchResults/getEnrollmentInfo"), headers, []byte(values.Encode())))
 	if err != nil {
-		fmt.Println(err)
 		discardResp(response)
-		return err
+		return nil, err
+	}
+	defer discardResp(response)
+	if err := throttled(response); err != nil {
+		return nil, err
 	}
 
 	body, _ := readBody(response)
 	reader := strings.NewReader(string(body))
 	document, err := goquery.NewDocumentFromReader(reader)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var enrollmentSeatsAvailable, waitlistCapacity, waitlistActual, waitlistSeatsAvailable string
-
+	counts := make(map[string]int, len(enrollmentLabels))
 	document.Find("span.status-bold").Each(func(i int, s *goquery.Selection) {
-		switch {
-		case strings.Contains(s.Text(), "Enrollment Seats Available:"):
-			enrollmentSeatsAvailable = s.Next().Text()
-		case strings.Contains(s.Text(), "Waitlist Seats Available:"):
-			waitlistSeatsAvailable = s.Next().Text()
-		case strings.Contains(s.Text(), "Waitlist Capacity:"):
-			waitlistCapacity = s.Next().Text()
-		case strings.Contains(s.Text(), "Waitlist Actual:"):
-			waitlistActual = s.Next().Text()
+		for _, label := range enrollmentLabels {
+			if strings.Contains(s.Text(), label) {
+				if count, err := strconv.Atoi(strings.TrimSpace(s.Next().Text())); err == nil {
+					counts[label] = count
+				}
+			}
 		}
 	})
+	for _, label := range enrollmentLabels {
+		if _, found := counts[label]; !found {
+			watchParseFailuresTotal.WithLabelValues(term, crn).Inc()
+			return nil, fmt.Errorf("%w: no %q count (status %d)", ErrEnrollmentUnreadable, label, response.StatusCode)
+		}
+	}
+	return &Enrollment{
+		SeatsAvailable: counts["Enrollment Seats Available:"],
+		WaitCapacity:   counts["Waitlist Capacity:"],
+		WaitCount:      counts["Waitlist Actual:"],
+		WaitAvailable:  counts["Waitlist Seats Available:"],
+	}, nil
+}
 
-	numEnrollmentSeatsAvailable, _ := strconv.Atoi(enrollmentSeatsAvailable)
-	numWaitlistCapacity, _ := strconv.Atoi(waitlistCapacity)
-	numWaitlistActual, _ := strconv.Atoi(waitlistActual)
-	numWaitlistSeatsAvailable, _ := strconv.Atoi(waitlistSeatsAvailable)
+// Watch waits for a seat in the task's section to open, or for the task's
+// condition to hold, then signs up. The TaskManager's scheduler polls the
+// section for every task watching it.
+func (t *Task) Watch() error {
+	t.setPhase(PhaseWatching)
+	t.step = "Watching"
+	ready := (*Enrollment).Open
+	if t.Condition != "" {
+		condition, err := ParseCondition(t.Condition)
+		if err != nil {
+			return &ValidationError{"condition", err.Error()}
+		}
+		ready = condition.Match
+	}
+	watches := t.watches
+	if watches == nil {
+		watches = NewWatchScheduler()
+	}
+	observations, unsubscribe := watches.Subscribe(t, t.Term, t.Crns)
+	defer unsubscribe()
 
-	if numWaitlistCapacity > numWaitlistActual && numWaitlistSeatsAvailable > 0 || (numEnrollmentSeatsAvailable > 0 && numWaitlistSeatsAvailable > 0) {
-		t.Status = "Now available"
-		t.CRNs = []string{t.Crns}
-		t.Status = "Starting signup"
-		t.Signup()
-	} else {
-		if numEnrollmentSeatsAvailable >= 1 && numWaitlistSeatsAvailable == 0 {
-			t.Status = "Waitlist opening soon"
-		} else {
-			t.Status = "Not available"
+	var stopped <-chan struct{}
+	if t.ctx != nil {
+		stopped = t.ctx.Done()
+	}
+	for {
+		var observation SeatObservation
+		select {
+		case observation = <-observations:
+		case <-stopped:
+			return errStopped
+		}
+
+		enrollment, err, wait := observation.Enrollment, observation.Err, observation.Wait
+		var throttledErr *ThrottledError
+		switch {
+		case errors.As(err, &throttledErr):
+			t.log().Warn("watch poll throttled", "crn", t.Crns, "status", throttledErr.StatusCode, "retry_in", wait)
+			t.SetStatus(fmt.Sprintf("Rate limited, retrying in %s", wait.Round(time.Second)))
+		case errors.Is(err, ErrEnrollmentUnreadable):
+			t.log().Warn("watch poll unreadable", "crn", t.Crns, "error", err, "retry_in", wait)
+			t.SetStatus(fmt.Sprintf("Enrollment unreadable, retrying in %s", wait.Round(time.Second)))
+		case err != nil:
+			t.log().Warn("watch poll failed", "crn", t.Crns, "error", err, "retry_in", wait)
+			t.SetStatus(fmt.Sprintf("Poll failed, retrying in %s", wait.Round(time.Second)))
+		case ready(enrollment):
+			unsubscribe()
+			seatOpenEventsTotal.WithLabelValues(t.Term, t.Crns).Inc()
+			t.SetStatus("Now available")
+			t.CRNs = []string{t.Crns}
+			t.SetStatus("Starting signup")
+			return t.Signup()
+		default:
+			t.log().Debug("enrollment info", "crn", t.Crns,
+				"seats_available", enrollment.SeatsAvailable,
+				"waitlist_capacity", enrollment.WaitCapacity,
+				"waitlist_actual", enrollment.WaitCount,
+				"waitlist_seats_available", enrollment.WaitAvailable)
+			if enrollment.SeatsAvailable >= 1 && enrollment.WaitAvailable == 0 {
+				t.SetStatus("Waitlist opening soon")
+			} else {
+				t.SetStatus("Not available")
+			}
 		}
-		time.Sleep(1 * time.Second)
-		return t.Watch()
 	}
-	return nil
 }
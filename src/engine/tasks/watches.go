@@ -0,0 +1,432 @@
+package tasks
+
+import (
+	"errors"
+	"log/slog"
+	"proj/apitypes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Where the scheduler reads a section's seat counts from.
+const (
+	WatchSourceEnrollment = "enrollment_info"
+	WatchSourceSearch     = "class_search"
+)
+
+// SeatObservation is one poll of a watched section, as delivered to every
+// task watching it.
+type SeatObservation struct {
+	Enrollment *Enrollment
+	Err        error
+	At         time.Time
+	// Wait is how long the receiving task's own policy would wait before
+	// polling again.
+	Wait time.Duration
+}
+
+// WatchStatus describes one section the scheduler polls.
+type WatchStatus = apitypes.WatchStatus
+
+// watchKey names a section across institutions.
+type watchKey struct {
+	institution, term, crn string
+}
+
+// sessionKey names the Banner session the scheduler polls a term through.
+type sessionKey struct {
+	institution, term string
+}
+
+// watchSession is the scheduler's own client for one institution and term,
+// so polls never share a client or search state with a running task. Polls
+// through it take turns.
+type watchSession struct {
+	task  *Task
+	mutex sync.Mutex
+}
+
+// poll runs fetch through the session's client, creating the client first.
+func (session *watchSession) poll(fetch func(task *Task) error) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.task.Client == nil {
+		if err := session.task.InitClient(); err != nil {
+			return err
+		}
+	}
+	return fetch(session.task)
+}
+
+// newWatchSession creates a session that polls term with the task's
+// institution, proxy and fingerprint.
+func newWatchSession(task *Task, term string) *watchSession {
+	return &watchSession{task: &Task{
+		ID:            "watch-" + task.institution().ID + "-" + term,
+		Term:          term,
+		Institution:   task.Institution,
+		Proxy:         task.Proxy,
+		Fingerprint:   task.Fingerprint,
+		proxies:       task.proxies,
+		hostOverrides: task.hostOverrides,
+	}}
+}
+
+// searchKey names the class search a section's seat counts are read from.
+type searchKey struct {
+	institution, term, subject, courseNumber string
+}
+
+// watchSubscriber is a task waiting on a section's observations.
+type watchSubscriber struct {
+	task         *Task
+	poller       *poller
+	observations chan SeatObservation
+}
+
+// sectionWatch is the shared polling state of one section.
+type sectionWatch struct {
+	key         watchKey
+	subscribers []*watchSubscriber
+	// search is the class search that polls the section together with the
+	// rest of its subject or course; nil polls its enrollment page.
+	search *searchKey
+	// single polls the enrollment page once after a failed search.
+	single     bool
+	due        time.Time
+	inFlight   bool
+	polls      int
+	lastPoll   time.Time
+	enrollment *Enrollment
+	lastError  string
+}
+
+// WatchScheduler polls each watched section once for all the tasks watching
+// it, at the tightest interval any of them asks for, and spreads polls
+// evenly under a global request budget.
+type WatchScheduler struct {
+	// spacing is the shortest time between any two polls; zero is unlimited.
+	spacing  time.Duration
+	watches  map[watchKey]*sectionWatch
+	sessions map[sessionKey]*watchSession
+	lastPoll time.Time
+	running  bool
+	wake     chan struct{}
+	mutex    sync.Mutex
+}
+
+// NewWatchScheduler creates a scheduler without a request budget.
+func NewWatchScheduler() *WatchScheduler {
+	return &WatchScheduler{
+		watches:  make(map[watchKey]*sectionWatch),
+		sessions: make(map[sessionKey]*watchSession),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// SetBudget caps the polls the scheduler makes across all sections at
+// perMinute. Zero removes the cap.
+func (s *WatchScheduler) SetBudget(perMinute int) error {
+	if perMinute < 0 {
+		return errors.New("watch budget must not be negative")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.spacing = 0
+	if perMinute > 0 {
+		s.spacing = time.Minute / time.Duration(perMinute)
+	}
+	s.notify()
+	return nil
+}
+
+// Subscribe starts delivering observations of the task's section to the
+// task. The returned function unsubscribes it.
+func (s *WatchScheduler) Subscribe(task *Task, term, crn string) (<-chan SeatObservation, func()) {
+	subscriber := &watchSubscriber{
+		task:         task,
+		poller:       task.newPoller(),
+		observations: make(chan SeatObservation, 1),
+	}
+	key := watchKey{task.institution().ID, term, crn}
+
+	s.mutex.Lock()
+	watch, exists := s.watches[key]
+	if !exists {
+		watch = &sectionWatch{key: key, due: time.Now()}
+		s.watches[key] = watch
+	}
+	watch.subscribers = append(watch.subscribers, subscriber)
+	if session := (sessionKey{key.institution, term}); s.sessions[session] == nil {
+		s.sessions[session] = newWatchSession(task, term)
+	}
+	if task.Subject != "" && watch.search == nil && watch.polls == 0 {
+		watch.search = &searchKey{key.institution, term, task.Subject, task.CourseNumber}
+	}
+	if !s.running {
+		s.running = true
+		go s.run()
+	}
+	s.notify()
+	s.mutex.Unlock()
+
+	var once sync.Once
+	return subscriber.observations, func() {
+		once.Do(func() { s.unsubscribe(watch, subscriber) })
+	}
+}
+
+// unsubscribe drops a subscriber, and the section once nobody watches it.
+func (s *WatchScheduler) unsubscribe(watch *sectionWatch, subscriber *watchSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, other := range watch.subscribers {
+		if other == subscriber {
+			watch.subscribers = append(watch.subscribers[:i], watch.subscribers[i+1:]...)
+			break
+		}
+	}
+	if len(watch.subscribers) == 0 && s.watches[watch.key] == watch {
+		delete(s.watches, watch.key)
+		s.dropSession(sessionKey{watch.key.institution, watch.key.term})
+	}
+	s.notify()
+}
+
+// dropSession forgets a session once no section of its term is watched.
+// Callers hold the mutex.
+func (s *WatchScheduler) dropSession(session sessionKey) {
+	for key := range s.watches {
+		if key.institution == session.institution && key.term == session.term {
+			return
+		}
+	}
+	delete(s.sessions, session)
+}
+
+// notify wakes the scheduling loop. Callers hold the mutex.
+func (s *WatchScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run starts the polls as they fall due, until nothing is watched.
+func (s *WatchScheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mutex.Lock()
+		if len(s.watches) == 0 {
+			s.running = false
+			s.mutex.Unlock()
+			return
+		}
+		watch, at := s.nextDue()
+		if watch != nil && !time.Now().Before(at) {
+			s.start(watch)
+			s.mutex.Unlock()
+			continue
+		}
+		s.mutex.Unlock()
+
+		wait := time.Hour
+		if watch != nil {
+			wait = time.Until(at)
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+	}
+}
+
+// nextDue returns the idle section that is due first and when it may be
+// polled under the budget. Callers hold the mutex.
+func (s *WatchScheduler) nextDue() (*sectionWatch, time.Time) {
+	var next *sectionWatch
+	for _, watch := range s.watches {
+		if !watch.inFlight && (next == nil || watch.due.Before(next.due)) {
+			next = watch
+		}
+	}
+	if next == nil {
+		return nil, time.Time{}
+	}
+	at := next.due
+	if budgeted := s.lastPoll.Add(s.spacing); s.spacing > 0 && budgeted.After(at) {
+		at = budgeted
+	}
+	return next, at
+}
+
+// start polls a section in the background through the session of its
+// term. Sections read from a class search are polled together with every
+// idle section of the same search. Callers hold the mutex.
+func (s *WatchScheduler) start(watch *sectionWatch) {
+	session := s.sessions[sessionKey{watch.key.institution, watch.key.term}]
+	s.lastPoll = time.Now()
+
+	if watch.search == nil || watch.single {
+		watch.inFlight = true
+		go func() {
+			var enrollment *Enrollment
+			err := session.poll(func(task *Task) (err error) {
+				enrollment, err = task.FetchEnrollment(watch.key.term, watch.key.crn)
+				return err
+			})
+			s.finish(watch, enrollment, err)
+		}()
+		return
+	}
+
+	search := *watch.search
+	var batch []*sectionWatch
+	for _, other := range s.watches {
+		if !other.inFlight && !other.single && other.search != nil && *other.search == search {
+			other.inFlight = true
+			batch = append(batch, other)
+		}
+	}
+	go func() {
+		var enrollments map[string]*Enrollment
+		err := session.poll(func(task *Task) (err error) {
+			enrollments, err = task.FetchSearchEnrollments(search.subject, search.courseNumber)
+			return err
+		})
+		s.finishSearch(search, batch, enrollments, err)
+	}()
+}
+
+// finishSearch hands a class search's seat counts to the sections polled
+// with it. Sections the search does not list are polled on their own from
+// then on; after a failed search, other than throttling, each section is
+// polled on its own once.
+func (s *WatchScheduler) finishSearch(search searchKey, batch []*sectionWatch, enrollments map[string]*Enrollment, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var throttledErr *ThrottledError
+	for _, watch := range batch {
+		enrollment, listed := enrollments[watch.key.crn]
+		switch {
+		case err == nil && listed, errors.As(err, &throttledErr):
+			s.record(watch, enrollment, err)
+			continue
+		case err == nil:
+			watch.search = nil
+		default:
+			watch.single = true
+		}
+		watch.inFlight = false
+		watch.due = time.Now()
+	}
+	if err != nil && throttledErr == nil {
+		slog.Warn("class search failed, polling sections one by one", "term", search.term, "subject", search.subject, "course_number", search.courseNumber, "error", err)
+	}
+	s.notify()
+}
+
+// finish records a poll of one section.
+func (s *WatchScheduler) finish(watch *sectionWatch, enrollment *Enrollment, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	watch.single = false
+	s.record(watch, enrollment, err)
+}
+
+// record hands a poll to every subscriber of a section and schedules the
+// section's next poll at the earliest any subscriber wants it. Callers hold
+// the mutex.
+func (s *WatchScheduler) record(watch *sectionWatch, enrollment *Enrollment, err error) {
+	now := time.Now()
+	watch.inFlight = false
+	watch.polls++
+	watch.lastPoll = now
+	watch.enrollment, watch.lastError = enrollment, ""
+	if err != nil {
+		watch.lastError = err.Error()
+	}
+
+	var throttledErr *ThrottledError
+	errors.As(err, &throttledErr)
+	next := time.Duration(-1)
+	for _, subscriber := range watch.subscribers {
+		switch {
+		case throttledErr != nil:
+			subscriber.poller.failed(throttledErr.RetryAfter)
+		case err != nil:
+			subscriber.poller.failed(0)
+		default:
+			subscriber.poller.succeeded()
+		}
+		wait := subscriber.poller.next(now)
+		if next < 0 || wait < next {
+			next = wait
+		}
+		deliver(subscriber.observations, SeatObservation{Enrollment: enrollment, Err: err, At: now, Wait: wait})
+	}
+	watch.due = now.Add(max(next, 0))
+	s.notify()
+}
+
+// deliver hands a subscriber the latest observation, replacing one it has
+// not read yet.
+func deliver(observations chan SeatObservation, observation SeatObservation) {
+	for {
+		select {
+		case observations <- observation:
+			return
+		default:
+		}
+		select {
+		case <-observations:
+		default:
+		}
+	}
+}
+
+// Status lists the watched sections, ordered by term and CRN.
+func (s *WatchScheduler) Status() []WatchStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	statuses := make([]WatchStatus, 0, len(s.watches))
+	for _, watch := range s.watches {
+		status := WatchStatus{
+			Institution: watch.key.institution,
+			Term:        watch.key.term,
+			CRN:         watch.key.crn,
+			Tasks:       make([]string, 0, len(watch.subscribers)),
+			Source:      WatchSourceEnrollment,
+			Polls:       watch.polls,
+			NextPoll:    watch.due,
+			Enrollment:  watch.enrollment,
+			LastError:   watch.lastError,
+		}
+		for _, subscriber := range watch.subscribers {
+			status.Tasks = append(status.Tasks, subscriber.task.ID)
+		}
+		if watch.search != nil && !watch.single {
+			status.Source = WatchSourceSearch
+		}
+		if lastPoll := watch.lastPoll; !lastPoll.IsZero() {
+			status.LastPoll = &lastPoll
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Term != statuses[j].Term {
+			return statuses[i].Term < statuses[j].Term
+		}
+		if statuses[i].CRN != statuses[j].CRN {
+			return statuses[i].CRN < statuses[j].CRN
+		}
+		return statuses[i].Institution < statuses[j].Institution
+	})
+	return statuses
+}
@@ -0,0 +1,362 @@
+// Package vault keeps portal accounts encrypted at rest. The account list is
+// sealed with AES-GCM under a key derived from a passphrase with Argon2id, or
+// under a random key kept in the OS keyring.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"proj/apitypes"
+	"proj/tasks"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/argon2"
+)
+
+// Key sources a vault can be unlocked with.
+const (
+	KeyPassphrase = "passphrase"
+	KeyKeyring    = "keyring"
+)
+
+// keyringService is the OS keyring service vault keys are stored under.
+const keyringService = "veil"
+
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrAccountExists   = errors.New("account already exists")
+	ErrWrongKey        = errors.New("wrong passphrase or corrupted vault")
+)
+
+var accountIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Account is a named set of portal credentials.
+type Account struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccountInfo is an account without its password. It is all the vault ever
+// hands out besides Credentials.
+type AccountInfo = apitypes.AccountInfo
+
+// info strips the password from an account.
+func (a *Account) info() AccountInfo {
+	return AccountInfo{ID: a.ID, Username: a.Username, CreatedAt: a.CreatedAt, UpdatedAt: a.UpdatedAt}
+}
+
+// kdfParams records how a passphrase was stretched into the vault key.
+type kdfParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// vaultFile is the on-disk form. Only the ciphertext holds account data.
+type vaultFile struct {
+	Version    int        `json:"version"`
+	KeySource  string     `json:"key_source"`
+	KDF        *kdfParams `json:"kdf,omitempty"`
+	Nonce      []byte     `json:"nonce"`
+	Ciphertext []byte     `json:"ciphertext"`
+}
+
+// Vault is an encrypted account store backed by a file. Every change is
+// written through before it returns.
+type Vault struct {
+	path      string
+	keySource string
+	kdf       *kdfParams
+	aead      cipher.AEAD
+	accounts  map[string]*Account
+	mutex     sync.Mutex
+}
+
+// Open unlocks the vault at path with a key derived from passphrase,
+// creating an empty vault if the file does not exist.
+func Open(path string, passphrase []byte) (*Vault, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("vault passphrase is empty")
+	}
+	file, err := readVaultFile(path, KeyPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	kdf := &kdfParams{Name: "argon2id", Time: 1, Memory: 64 * 1024, Threads: 4}
+	if file != nil {
+		kdf = file.KDF
+		if kdf == nil || kdf.Name != "argon2id" {
+			return nil, fmt.Errorf("%s: unsupported key derivation", path)
+		}
+	} else {
+		kdf.Salt = make([]byte, 16)
+		if _, err := rand.Read(kdf.Salt); err != nil {
+			return nil, err
+		}
+	}
+	key := argon2.IDKey(passphrase, kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, 32)
+	return open(path, KeyPassphrase, kdf, key, file)
+}
+
+// OpenWithKeyring unlocks the vault at path with a random key kept in the OS
+// keyring, creating both the key and the vault on first use.
+func OpenWithKeyring(path string) (*Vault, error) {
+	file, err := readVaultFile(path, KeyKeyring)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are stored per vault file so several vaults can coexist.
+	user, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	stored, err := keyring.Get(keyringService, user)
+	switch {
+	case err == nil:
+		if key, err = base64.StdEncoding.DecodeString(stored); err != nil {
+			return nil, fmt.Errorf("reading vault key from the OS keyring: %w", err)
+		}
+	case errors.Is(err, keyring.ErrNotFound) && file == nil:
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := keyring.Set(keyringService, user, base64.StdEncoding.EncodeToString(key)); err != nil {
+			return nil, fmt.Errorf("storing vault key in the OS keyring: %w", err)
+		}
+	case errors.Is(err, keyring.ErrNotFound):
+		return nil, fmt.Errorf("%s: its key is missing from the OS keyring", path)
+	default:
+		return nil, fmt.Errorf("reading vault key from the OS keyring: %w", err)
+	}
+	return open(path, KeyKeyring, nil, key, file)
+}
+
+// readVaultFile loads the vault file, or returns nil if there is none yet.
+func readVaultFile(path, keySource string) (*vaultFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("%s: unsupported vault version %d", path, file.Version)
+	}
+	if file.KeySource != keySource {
+		return nil, fmt.Errorf("%s: vault is unlocked with its %s, not a %s", path, file.KeySource, keySource)
+	}
+	return &file, nil
+}
+
+// open decrypts an existing vault file, or writes a new empty vault.
+func open(path, keySource string, kdf *kdfParams, key []byte, file *vaultFile) (*Vault, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	vault := &Vault{path: path, keySource: keySource, kdf: kdf, aead: aead, accounts: make(map[string]*Account)}
+
+	if file == nil {
+		return vault, vault.save()
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, vault.additionalData())
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	var payload struct {
+		Accounts []*Account `json:"accounts"`
+	}
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, account := range payload.Accounts {
+		vault.accounts[account.ID] = account
+	}
+	return vault, nil
+}
+
+// additionalData binds the ciphertext to the vault format and key source.
+func (v *Vault) additionalData() []byte {
+	return []byte("veil-vault/1/" + v.keySource)
+}
+
+// save seals the accounts and replaces the vault file. Callers hold the
+// mutex, except while opening.
+func (v *Vault) save() error {
+	payload := struct {
+		Accounts []*Account `json:"accounts"`
+	}{Accounts: make([]*Account, 0, len(v.accounts))}
+	for _, account := range v.accounts {
+		payload.Accounts = append(payload.Accounts, account)
+	}
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(vaultFile{
+		Version:    1,
+		KeySource:  v.keySource,
+		KDF:        v.kdf,
+		Nonce:      nonce,
+		Ciphertext: v.aead.Seal(nil, nonce, plaintext, v.additionalData()),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file and rename it so a crash never leaves a
+	// half-written vault behind.
+	temp := v.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(temp, v.path)
+}
+
+// List returns every account without passwords, ordered by ID.
+func (v *Vault) List() []AccountInfo {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	infos := make([]AccountInfo, 0, len(v.accounts))
+	for _, account := range v.accounts {
+		infos = append(infos, account.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// Get returns an account without its password.
+func (v *Vault) Get(id string) (AccountInfo, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	account, exists := v.accounts[id]
+	if !exists {
+		return AccountInfo{}, ErrAccountNotFound
+	}
+	return account.info(), nil
+}
+
+// Credentials returns the username and password of an account, for signing
+// in. It satisfies tasks.CredentialStore.
+func (v *Vault) Credentials(id string) (string, string, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	account, exists := v.accounts[id]
+	if !exists {
+		return "", "", ErrAccountNotFound
+	}
+	return account.Username, account.Password, nil
+}
+
+// AccountFor returns the ID of an account that signs in with username and
+// password, the first by ID if several do. It satisfies tasks.AccountFinder.
+func (v *Vault) AccountFor(username, password string) (string, bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var found string
+	for id, account := range v.accounts {
+		if account.Username == username && account.Password == password && (found == "" || id < found) {
+			found = id
+		}
+	}
+	return found, found != ""
+}
+
+// Add stores a new account.
+func (v *Vault) Add(id, username, password string) (AccountInfo, error) {
+	switch {
+	case !accountIDPattern.MatchString(id):
+		return AccountInfo{}, &tasks.ValidationError{Field: "id", Message: "must be 1-64 letters, digits, '-' or '_'"}
+	case strings.TrimSpace(username) == "":
+		return AccountInfo{}, &tasks.ValidationError{Field: "username", Message: "is required"}
+	case password == "":
+		return AccountInfo{}, &tasks.ValidationError{Field: "password", Message: "is required"}
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if _, exists := v.accounts[id]; exists {
+		return AccountInfo{}, ErrAccountExists
+	}
+	now := time.Now().UTC()
+	account := &Account{ID: id, Username: username, Password: password, CreatedAt: now, UpdatedAt: now}
+	v.accounts[id] = account
+	if err := v.save(); err != nil {
+		delete(v.accounts, id)
+		return AccountInfo{}, err
+	}
+	return account.info(), nil
+}
+
+// Rotate replaces an account's password. Every task that references the
+// account signs in with the new password from its next login on.
+func (v *Vault) Rotate(id, password string) (AccountInfo, error) {
+	if password == "" {
+		return AccountInfo{}, &tasks.ValidationError{Field: "password", Message: "is required"}
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	account, exists := v.accounts[id]
+	if !exists {
+		return AccountInfo{}, ErrAccountNotFound
+	}
+	previous := *account
+	account.Password, account.UpdatedAt = password, time.Now().UTC()
+	if err := v.save(); err != nil {
+		*account = previous
+		return AccountInfo{}, err
+	}
+	return account.info(), nil
+}
+
+// Delete removes an account.
+func (v *Vault) Delete(id string) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	account, exists := v.accounts[id]
+	if !exists {
+		return ErrAccountNotFound
+	}
+	delete(v.accounts, id)
+	if err := v.save(); err != nil {
+		v.accounts[id] = account
+		return err
+	}
+	return nil
+}